@@ -0,0 +1,59 @@
+package main
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/events"
+	"StockOverflow/internal/server"
+	"fmt"
+	"os"
+)
+
+// eventdiff rebuilds the exchange's state from the latest snapshot in
+// SNAPSHOT_DIR and the events after it in EVENT_LOG, and compares its balances
+// and positions with the database's. It exits 1 if they diverge.
+// The database is the server's, from the same environment variables, opened
+// read-only.
+func main() {
+	path := os.Getenv("EVENT_LOG")
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "usage: EVENT_LOG=<path> [SNAPSHOT_DIR=<dir>] eventdiff")
+		os.Exit(2)
+	}
+	dir := os.Getenv("SNAPSHOT_DIR")
+	if dir == "" {
+		dir = "snapshots"
+	}
+
+	st, _, err := events.LoadSnapshot(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	seq, _, err := events.ReadLog(path, st.Seq, st.Apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// only read, a database that isn't there is not created or migrated
+	dbm := server.GetDatabaseMaster()
+	if err := dbm.ConnectReadOnly(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer dbm.Db.Close()
+
+	divergences, err := events.Diff(st, database.NewSQLStore(dbm.Db))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, divergence := range divergences {
+		fmt.Println(divergence.String())
+	}
+	if len(divergences) > 0 {
+		fmt.Printf("%d divergences at event %d\n", len(divergences), seq)
+		os.Exit(1)
+	}
+	fmt.Printf("state at event %d matches the database\n", seq)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/server"
+	"fmt"
+	"os"
+	"time"
+)
+
+// migrate up applies the pending migrations, migrate status lists them all.
+// The database is the server's, from the same environment variables.
+func main() {
+	if len(os.Args) != 2 || (os.Args[1] != "up" && os.Args[1] != "status") {
+		fmt.Fprintln(os.Stderr, "usage: migrate up|status")
+		os.Exit(2)
+	}
+
+	dbm := server.GetDatabaseMaster()
+	dbm.Connect()
+	dbm.CreateDB()
+	defer dbm.Db.Close()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := database.MigrateUp(dbm.Db)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+	case "status":
+		states, err := database.GetMigrationStatus(dbm.Db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt > 0 {
+				applied = "applied " + time.Unix(0, state.AppliedAt).UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+		if err := database.CheckSchemaVersion(dbm.Db); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -8,7 +8,10 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// DatabaseMaster sets up the database. Driver is "postgres" when empty, with
+// "sqlite" DbName is the path of the database file and ConnStr is unused.
 type DatabaseMaster struct {
+	Driver  string
 	ConnStr string
 	DbName  string
 	Db      *sql.DB
@@ -16,6 +19,15 @@ type DatabaseMaster struct {
 
 // connect to db
 func (dbm *DatabaseMaster) Connect() {
+	if dbm.Driver == "sqlite" {
+		db, err := sql.Open("sqlite", sqliteDSN(dbm.DbName))
+		dbm.Db = db
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	db, err := sql.Open("postgres", dbm.ConnStr)
 	dbm.Db = db
 	if err != nil {
@@ -23,6 +35,26 @@ func (dbm *DatabaseMaster) Connect() {
 	}
 }
 
+// ConnectReadOnly connects to the database as it is, for tools that only read it.
+// Nothing is created or migrated, a missing database or file is an error.
+func (dbm *DatabaseMaster) ConnectReadOnly() error {
+	driver, dsn := "postgres", dbm.ConnStr+" dbname="+dbm.DbName+" default_transaction_read_only=on"
+	if dbm.Driver == "sqlite" {
+		driver, dsn = "sqlite", sqliteReadOnlyDSN(dbm.DbName)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to open %s: %v", dbm.DbName, err)
+	}
+	dbm.Db = db
+	return nil
+}
+
 // check if db exist
 func (dbm *DatabaseMaster) CheckIfExist() bool {
 	var exists bool
@@ -36,6 +68,10 @@ func (dbm *DatabaseMaster) CheckIfExist() bool {
 
 // if no db, create it
 func (dbm *DatabaseMaster) CreateDB() {
+	// the sqlite file is created on connect
+	if dbm.Driver == "sqlite" {
+		return
+	}
 
 	exists := dbm.CheckIfExist()
 	if !exists {
@@ -56,86 +92,14 @@ func (dbm *DatabaseMaster) CreateDB() {
 	}
 }
 
-// init all tables
+// init all tables by applying the pending migrations
 func (dbm *DatabaseMaster) Init() {
-	dbm.initAccountTable()
-	dbm.initPositionTable()
-	dbm.initOrderTable()
-	dbm.initExecutionTable()
-}
-
-// init account table
-func (dbm *DatabaseMaster) initAccountTable() {
-
-	createTableSQL := `CREATE TABLE IF NOT EXISTS accounts (
-		id VARCHAR(255) PRIMARY KEY,
-		balance NUMERIC(20, 2) NOT NULL 
-		);`
-
-	_, err := dbm.Db.Exec(createTableSQL)
+	applied, err := MigrateUp(dbm.Db)
 	if err != nil {
-		log.Fatal("Failed to create table:", err)
-	} else {
-		fmt.Println("Table <Account> checked/created successfully.")
+		log.Fatal("Failed to migrate database:", err)
 	}
-}
-
-// init position table
-func (dbm *DatabaseMaster) initPositionTable() {
-
-	createTableSQL := `CREATE TABLE IF NOT EXISTS positions (
-    account_id VARCHAR(255) REFERENCES accounts(id),
-    symbol VARCHAR(255) NOT NULL,
-    amount NUMERIC(20, 6) NOT NULL,
-    PRIMARY KEY (account_id, symbol)
-);`
-
-	_, err := dbm.Db.Exec(createTableSQL)
-	if err != nil {
-		log.Fatal("Failed to create table:", err)
-	} else {
-		fmt.Println("Table <Position> checked/created successfully.")
-	}
-}
-
-// init orders table
-func (dbm *DatabaseMaster) initOrderTable() {
-
-	createTableSQL := `CREATE TABLE IF NOT EXISTS orders (
-    id VARCHAR(255) PRIMARY KEY,
-    account_id VARCHAR(255) REFERENCES accounts(id),
-    symbol VARCHAR(255) NOT NULL,
-    amount NUMERIC(20, 6) NOT NULL,
-	price NUMERIC(20, 6) NOT NULL,
-    status VARCHAR(10) NOT NULL,
-    remaining NUMERIC(20, 6) NOT NULL,
-    timestamp BIGINT NOT NULL,
-    canceled_time BIGINT
-);`
-
-	_, err := dbm.Db.Exec(createTableSQL)
-	if err != nil {
-		log.Fatal("Failed to create table:", err)
-	} else {
-		fmt.Println("Table <Orders> checked/created successfully.")
-	}
-}
-
-// init execution table
-func (dbm *DatabaseMaster) initExecutionTable() {
-
-	createTableSQL := `CREATE TABLE IF NOT EXISTS executions (
-    order_id VARCHAR(255) REFERENCES orders(id),
-    shares NUMERIC(20, 6) NOT NULL,
-    price NUMERIC(20, 6) NOT NULL,
-    timestamp BIGINT NOT NULL,
-    PRIMARY KEY (order_id, timestamp)
-);`
-
-	_, err := dbm.Db.Exec(createTableSQL)
-	if err != nil {
-		log.Fatal("Failed to create table:", err)
-	} else {
-		fmt.Println("Table <Exxcution> checked/created successfully.")
+	for _, migration := range applied {
+		fmt.Printf("Migration %d_%s applied.\n", migration.Version, migration.Name)
 	}
+	fmt.Println("Schema checked/migrated successfully.")
 }
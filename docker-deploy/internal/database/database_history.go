@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HistoryFilter selects the orders or executions of an account for a history query.
+// Empty fields match everything, the time range is in nanoseconds and half open.
+type HistoryFilter struct {
+	AccountID string
+	Symbol    string
+	Status    string // order history only
+	Side      string // "buy" or "sell"
+	From      int64  // inclusive
+	To        int64  // exclusive, zero means now
+	Limit     int
+}
+
+// HistoryCursor is where a history page ended, the next page starts after it.
+// History runs newest first.
+type HistoryCursor struct {
+	Timestamp int64
+	OrderID   string
+	TradeID   int64 // execution history only
+}
+
+// Encode returns the cursor as an opaque token for clients
+func (cursor *HistoryCursor) Encode() string {
+	raw := fmt.Sprintf("%d|%s|%d", cursor.Timestamp, cursor.OrderID, cursor.TradeID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeHistoryCursor parses a token made by Encode
+func DecodeHistoryCursor(token string) (*HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	tradeID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &HistoryCursor{Timestamp: timestamp, OrderID: parts[1], TradeID: tradeID}, nil
+}
+
+// HistoryExecution is an execution with the order details history needs
+type HistoryExecution struct {
+	Execution
+	Symbol string
+	IsBuy  bool
+}
+
+// historyConditions builds the WHERE clause shared by both histories.
+// prefix qualifies the order columns, args gets the parameters appended.
+func historyConditions(filter *HistoryFilter, prefix string, timeColumn string, args []any) (string, []any) {
+	add := func(condition string, value any) string {
+		args = append(args, value)
+		return fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	args = append(args, filter.AccountID)
+	where := " WHERE " + prefix + "account_id = $1"
+	if filter.Symbol != "" {
+		where += add(prefix+"symbol = $%d", filter.Symbol)
+	}
+	switch filter.Side {
+	case "buy":
+		where += " AND " + prefix + "amount > 0"
+	case "sell":
+		where += " AND " + prefix + "amount < 0"
+	}
+	if filter.From > 0 {
+		where += add(timeColumn+" >= $%d", filter.From)
+	}
+	if filter.To > 0 {
+		where += add(timeColumn+" < $%d", filter.To)
+	}
+	return where, args
+}
+
+// GetOrderHistory retrieves a page of an account's orders, newest first.
+// It returns the cursor of the next page, nil on the last one.
+func GetOrderHistory(db *sql.DB, filter *HistoryFilter, cursor *HistoryCursor) ([]Order, *HistoryCursor, error) {
+	where, args := historyConditions(filter, "", "timestamp", nil)
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if cursor != nil {
+		args = append(args, cursor.Timestamp, cursor.OrderID)
+		where += fmt.Sprintf(" AND (timestamp, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	// one more than asked tells whether there is a next page
+	args = append(args, filter.Limit+1)
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders"+where+
+			fmt.Sprintf(" ORDER BY timestamp DESC, id DESC LIMIT $%d", len(args)),
+		args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving order history: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	if len(orders) <= filter.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:filter.Limit]
+	last := orders[len(orders)-1]
+	return orders, &HistoryCursor{Timestamp: last.Timestamp, OrderID: last.ID}, nil
+}
+
+// GetExecutionHistory retrieves a page of the executions of an account's orders, newest first.
+// It returns the cursor of the next page, nil on the last one.
+func GetExecutionHistory(db *sql.DB, filter *HistoryFilter, cursor *HistoryCursor) ([]HistoryExecution, *HistoryCursor, error) {
+	where, args := historyConditions(filter, "o.", "e.timestamp", nil)
+	if cursor != nil {
+		args = append(args, cursor.Timestamp, cursor.OrderID, cursor.TradeID)
+		where += fmt.Sprintf(" AND (e.timestamp, e.order_id, COALESCE(e.trade_id, 0)) < ($%d, $%d, $%d)",
+			len(args)-2, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Limit+1)
+	rows, err := db.Query(
+		"SELECT e.order_id, e.shares, e.price, e.fee, e.liquidity, COALESCE(e.trade_id, 0), e.timestamp, o.symbol, o.amount > 0 "+
+			"FROM executions e JOIN orders o ON o.id = e.order_id"+where+
+			fmt.Sprintf(" ORDER BY e.timestamp DESC, e.order_id DESC, COALESCE(e.trade_id, 0) DESC LIMIT $%d", len(args)),
+		args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving execution history: %v", err)
+	}
+	defer rows.Close()
+
+	var executions []HistoryExecution
+	for rows.Next() {
+		var exec HistoryExecution
+		if err := rows.Scan(&exec.OrderID, &exec.Shares, &exec.Price, &exec.Fee, &exec.Liquidity, &exec.TradeID,
+			&exec.Timestamp, &exec.Symbol, &exec.IsBuy); err != nil {
+			return nil, nil, fmt.Errorf("error scanning execution: %v", err)
+		}
+		executions = append(executions, exec)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating executions: %v", err)
+	}
+
+	if len(executions) <= filter.Limit {
+		return executions, nil, nil
+	}
+	executions = executions[:filter.Limit]
+	last := executions[len(executions)-1]
+	return executions, &HistoryCursor{Timestamp: last.Timestamp, OrderID: last.OrderID, TradeID: last.TradeID}, nil
+}
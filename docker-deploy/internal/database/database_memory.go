@@ -0,0 +1,899 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// MemoryStore is the Store kept in memory, for running and testing the engine
+// without a database. A transaction writes to its own overlay, which is applied
+// at once on commit and dropped on error, so nothing it does is seen before it
+// commits. One transaction or write runs at a time, standing in for row locks.
+type MemoryStore struct {
+	txMutex sync.Mutex   // held by the running transaction or write
+	mutex   sync.RWMutex // guards the tables
+
+	accounts      map[string]*memoryAccount
+	positions     map[positionKey]decimal.Decimal
+	orders        map[string]*Order
+	executions    []Execution
+	trades        map[int64]*Trade
+	symbols       map[string]*Symbol
+	feeTiers      map[string]*FeeTier
+	stpEvents     []STPEvent
+	breakerEvents []BreakerEvent
+	nextTradeID   int64 // like a sequence, IDs of rolled back trades are not reused
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// memoryAccount is a row of the accounts table
+type memoryAccount struct {
+	Account
+	stpMode string
+	feeTier string
+}
+
+// positionKey is the primary key of the positions table
+type positionKey struct {
+	accountID string
+	symbol    string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts:    make(map[string]*memoryAccount),
+		positions:   make(map[positionKey]decimal.Decimal),
+		orders:      make(map[string]*Order),
+		trades:      make(map[int64]*Trade),
+		symbols:     make(map[string]*Symbol),
+		feeTiers:    make(map[string]*FeeTier),
+		nextTradeID: 1,
+	}
+}
+
+// numeric rounds a value the way the NUMERIC(20, 6) columns store it
+func numeric(value decimal.Decimal) decimal.Decimal {
+	return value.Round(6)
+}
+
+// WithTx runs fn in a transaction
+func (s *MemoryStore) WithTx(fn func(tx Tx) error) error {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+
+	tx := &memoryTx{
+		store:     s,
+		accounts:  make(map[string]*memoryAccount),
+		positions: make(map[positionKey]decimal.Decimal),
+		orders:    make(map[string]*Order),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+// write runs a single statement outside of a transaction
+func (s *MemoryStore) write(fn func() error) error {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return fn()
+}
+
+// ===================== Account Operations =====================
+
+func (s *MemoryStore) CreateAccount(id string, balance decimal.Decimal) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.CreateAccount(id, balance)
+	})
+}
+
+func (s *MemoryStore) GetAccount(id string) (*Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, fmt.Errorf("account not found: %s", id)
+	}
+	result := account.Account
+	return &result, nil
+}
+
+func (s *MemoryStore) GetAccounts() ([]Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	accounts := make([]Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account.Account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
+	return accounts, nil
+}
+
+func (s *MemoryStore) GetAccountSTPMode(id string) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return "", fmt.Errorf("account not found: %s", id)
+	}
+	return account.stpMode, nil
+}
+
+func (s *MemoryStore) SetAccountSTPMode(id string, mode string) error {
+	return s.write(func() error {
+		if account, ok := s.accounts[id]; ok {
+			account.stpMode = mode
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetAccountFeeTier(id string, tier string) error {
+	return s.write(func() error {
+		if account, ok := s.accounts[id]; ok {
+			account.feeTier = tier
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) EnsureAccount(id string) error {
+	return s.write(func() error {
+		if _, ok := s.accounts[id]; !ok {
+			s.accounts[id] = &memoryAccount{Account: Account{ID: id, Balance: decimal.Zero}}
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) UpdateAccountBalance(id string, balance decimal.Decimal) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.UpdateAccountBalance(id, balance)
+	})
+}
+
+// ===================== Position Operations =====================
+
+func (s *MemoryStore) GetPositions(accountID string) ([]Position, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var positions []Position
+	for key, amount := range s.positions {
+		if key.accountID == accountID {
+			positions = append(positions, Position{AccountID: accountID, Symbol: key.symbol, Amount: amount})
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions, nil
+}
+
+func (s *MemoryStore) GetPosition(accountID string, symbol string) (*Position, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	amount, ok := s.positions[positionKey{accountID, symbol}]
+	if !ok {
+		return nil, fmt.Errorf("position not found for account %s and symbol %s", accountID, symbol)
+	}
+	return &Position{AccountID: accountID, Symbol: symbol, Amount: amount}, nil
+}
+
+func (s *MemoryStore) CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.CreateOrUpdatePosition(accountID, symbol, amount)
+	})
+}
+
+// ===================== Symbol Operations =====================
+
+func (s *MemoryStore) CreateOrUpdateSymbol(symbol *Symbol) error {
+	return s.write(func() error {
+		stored := *symbol
+		s.symbols[symbol.Symbol] = &stored
+		return nil
+	})
+}
+
+func (s *MemoryStore) GetSymbol(name string) (*Symbol, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	symbol, ok := s.symbols[name]
+	if !ok {
+		return &Symbol{Symbol: name, LotSize: DefaultLotSize, Matching: MatchingPriceTime}, nil
+	}
+	result := *symbol
+	return &result, nil
+}
+
+func (s *MemoryStore) GetSymbolNames() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for name := range s.symbols {
+		add(name)
+	}
+	for key := range s.positions {
+		add(key.symbol)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStore) CreateOrUpdateFeeTier(tier *FeeTier) error {
+	return s.write(func() error {
+		stored := *tier
+		s.feeTiers[tier.Name] = &stored
+		return nil
+	})
+}
+
+func (s *MemoryStore) GetAccountFeeTier(accountID string) (*FeeTier, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, ok := s.accounts[accountID]
+	if !ok {
+		return nil, nil
+	}
+	tier, ok := s.feeTiers[account.feeTier]
+	if !ok {
+		return nil, nil
+	}
+	result := *tier
+	return &result, nil
+}
+
+// ===================== Order Operations =====================
+
+func (s *MemoryStore) CreateOrder(order *Order) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.CreateOrder(order)
+	})
+}
+
+func (s *MemoryStore) GetOrder(orderID string) (*Order, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order not found: %s", orderID)
+	}
+	result := *order
+	return &result, nil
+}
+
+func (s *MemoryStore) UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.UpdateOrderStatus(orderID, status, remaining, canceledTime)
+	})
+}
+
+func (s *MemoryStore) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.UpdateOrderSlice(orderID, visible, priorityTime)
+	})
+}
+
+func (s *MemoryStore) ActivateStopOrder(orderID string, orderType string) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.ActivateStopOrder(orderID, orderType)
+	})
+}
+
+// selectOrders copies the orders keep returns true for, sorted by less
+func (s *MemoryStore) selectOrders(keep func(order *Order) bool, less func(a, b *Order) bool) []Order {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var orders []Order
+	for _, order := range s.orders {
+		if keep(order) {
+			orders = append(orders, *order)
+		}
+	}
+	// ties are broken on the ID so results do not depend on map order
+	sort.Slice(orders, func(i, j int) bool {
+		if less(&orders[i], &orders[j]) {
+			return true
+		}
+		if less(&orders[j], &orders[i]) {
+			return false
+		}
+		return orders[i].ID < orders[j].ID
+	})
+	return orders
+}
+
+func (s *MemoryStore) GetOpenOrdersBySymbolForHeap(symbol string, target string, limit int) ([]Order, error) {
+	var isBuy bool
+	switch target {
+	case "buyer":
+		isBuy = true
+	case "seller":
+		isBuy = false
+	default:
+		return nil, fmt.Errorf("target should be buyer or seller, but get%s", target)
+	}
+
+	orders := s.selectOrders(
+		func(order *Order) bool {
+			return order.Symbol == symbol && order.Status == "open" && order.Amount.IsPositive() == isBuy
+		},
+		func(a, b *Order) bool {
+			if !a.Price.Equal(b.Price) {
+				return a.Price.GreaterThan(b.Price) == isBuy
+			}
+			return a.PriorityTime < b.PriorityTime
+		})
+
+	// a limit of zero returns the whole side of the book
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (s *MemoryStore) GetOpenOrdersAtPrice(symbol string, isBuy bool, price decimal.Decimal) ([]Order, error) {
+	return s.selectOrders(
+		func(order *Order) bool {
+			return order.Symbol == symbol && order.Status == "open" && order.Price.Equal(price) &&
+				order.Amount.IsPositive() == isBuy
+		},
+		func(a, b *Order) bool {
+			return a.PriorityTime < b.PriorityTime
+		}), nil
+}
+
+func (s *MemoryStore) GetOpenOrdersByAccount(accountID string) ([]Order, error) {
+	return s.selectOrders(
+		func(order *Order) bool {
+			return order.AccountID == accountID && (order.Status == "open" || order.Status == "pending")
+		},
+		func(a, b *Order) bool {
+			return a.Timestamp < b.Timestamp
+		}), nil
+}
+
+func (s *MemoryStore) GetPendingStopsBySymbol(symbol string) ([]Order, error) {
+	return s.selectOrders(
+		func(order *Order) bool {
+			return order.Symbol == symbol && order.Status == "pending"
+		},
+		func(a, b *Order) bool {
+			return a.Timestamp < b.Timestamp
+		}), nil
+}
+
+func (s *MemoryStore) GetExpiredOrders(now int64) ([]Order, error) {
+	return s.selectOrders(
+		func(order *Order) bool {
+			return order.Expired(now) && (order.Status == "open" || order.Status == "pending")
+		},
+		func(a, b *Order) bool {
+			return a.ExpireTime < b.ExpireTime
+		}), nil
+}
+
+func (s *MemoryStore) GetBookLevels(symbol string, isBuy bool, depth int, now int64) ([]BookLevel, error) {
+	orders := s.selectOrders(
+		func(order *Order) bool {
+			return order.Symbol == symbol && order.Status == "open" && !order.Expired(now) &&
+				order.Amount.IsPositive() == isBuy
+		},
+		func(a, b *Order) bool {
+			return !a.Price.Equal(b.Price) && a.Price.GreaterThan(b.Price) == isBuy
+		})
+
+	var levels []BookLevel
+	for _, order := range orders {
+		if len(levels) == 0 || !levels[len(levels)-1].Price.Equal(order.Price) {
+			if depth > 0 && len(levels) == depth {
+				break
+			}
+			levels = append(levels, BookLevel{Price: order.Price, Shares: decimal.Zero})
+		}
+		level := &levels[len(levels)-1]
+		level.Shares = level.Shares.Add(order.Shown())
+		level.Orders++
+	}
+	return levels, nil
+}
+
+func (s *MemoryStore) GetCrossingOrders(symbol string, isBuy bool, price decimal.Decimal, now int64) ([]Order, error) {
+	return s.selectOrders(
+		func(order *Order) bool {
+			if order.Symbol != symbol || order.Status != "open" || order.Expired(now) {
+				return false
+			}
+			if isBuy {
+				return order.Amount.IsNegative() && order.Price.LessThanOrEqual(price)
+			}
+			return order.Amount.IsPositive() && order.Price.GreaterThanOrEqual(price)
+		},
+		func(a, b *Order) bool {
+			if !a.Price.Equal(b.Price) {
+				return a.Price.LessThan(b.Price) == isBuy
+			}
+			return a.PriorityTime < b.PriorityTime
+		}), nil
+}
+
+// historyMatches reports whether an order, or an execution of it at timestamp,
+// passes the filters both histories share
+func historyMatches(filter *HistoryFilter, order *Order, timestamp int64) bool {
+	if order.AccountID != filter.AccountID {
+		return false
+	}
+	if filter.Symbol != "" && order.Symbol != filter.Symbol {
+		return false
+	}
+	if (filter.Side == "buy" && !order.Amount.IsPositive()) || (filter.Side == "sell" && !order.Amount.IsNegative()) {
+		return false
+	}
+	if filter.From > 0 && timestamp < filter.From {
+		return false
+	}
+	return filter.To <= 0 || timestamp < filter.To
+}
+
+func (s *MemoryStore) GetOrderHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]Order, *HistoryCursor, error) {
+	// newest first, the cursor is the last order of the previous page
+	newer := func(a, b *Order) bool {
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp > b.Timestamp
+		}
+		return a.ID > b.ID
+	}
+	orders := s.selectOrders(
+		func(order *Order) bool {
+			if !historyMatches(filter, order, order.Timestamp) {
+				return false
+			}
+			if filter.Status != "" && order.Status != filter.Status {
+				return false
+			}
+			return cursor == nil || newer(&Order{Timestamp: cursor.Timestamp, ID: cursor.OrderID}, order)
+		},
+		newer)
+
+	if len(orders) <= filter.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:filter.Limit]
+	last := orders[len(orders)-1]
+	return orders, &HistoryCursor{Timestamp: last.Timestamp, OrderID: last.ID}, nil
+}
+
+func (s *MemoryStore) GetMaxOrderID() (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	maxID := 0
+	for id := range s.orders {
+		// non-numeric IDs are skipped
+		if value, err := strconv.Atoi(id); err == nil && value > maxID {
+			maxID = value
+		}
+	}
+	return maxID, nil
+}
+
+// ===================== Execution Operations =====================
+
+func (s *MemoryStore) RecordExecution(execution *Execution) error {
+	return s.WithTx(func(tx Tx) error {
+		return tx.RecordExecution(execution)
+	})
+}
+
+func (s *MemoryStore) GetOrderExecutions(orderID string) ([]Execution, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var executions []Execution
+	for _, exec := range s.executions {
+		if exec.OrderID == orderID {
+			executions = append(executions, exec)
+		}
+	}
+	sort.SliceStable(executions, func(i, j int) bool {
+		if executions[i].Timestamp != executions[j].Timestamp {
+			return executions[i].Timestamp < executions[j].Timestamp
+		}
+		return executions[i].TradeID < executions[j].TradeID
+	})
+	return executions, nil
+}
+
+func (s *MemoryStore) GetExecutionHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]HistoryExecution, *HistoryCursor, error) {
+	newer := func(a, b *HistoryExecution) bool {
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp > b.Timestamp
+		}
+		if a.OrderID != b.OrderID {
+			return a.OrderID > b.OrderID
+		}
+		return a.TradeID > b.TradeID
+	}
+
+	s.mutex.RLock()
+	var executions []HistoryExecution
+	for _, exec := range s.executions {
+		order, ok := s.orders[exec.OrderID]
+		if !ok || !historyMatches(filter, order, exec.Timestamp) {
+			continue
+		}
+		entry := HistoryExecution{Execution: exec, Symbol: order.Symbol, IsBuy: order.Amount.IsPositive()}
+		if cursor != nil {
+			after := HistoryExecution{Execution: Execution{Timestamp: cursor.Timestamp, OrderID: cursor.OrderID, TradeID: cursor.TradeID}}
+			if !newer(&after, &entry) {
+				continue
+			}
+		}
+		executions = append(executions, entry)
+	}
+	s.mutex.RUnlock()
+
+	sort.SliceStable(executions, func(i, j int) bool {
+		return newer(&executions[i], &executions[j])
+	})
+
+	if len(executions) <= filter.Limit {
+		return executions, nil, nil
+	}
+	executions = executions[:filter.Limit]
+	last := executions[len(executions)-1]
+	return executions, &HistoryCursor{Timestamp: last.Timestamp, OrderID: last.OrderID, TradeID: last.TradeID}, nil
+}
+
+func (s *MemoryStore) GetTrade(id int64) (*Trade, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	trade, ok := s.trades[id]
+	if !ok {
+		return nil, fmt.Errorf("trade not found: %d", id)
+	}
+	result := *trade
+	return &result, nil
+}
+
+func (s *MemoryStore) GetLastTradePrice(symbol string) (decimal.Decimal, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// executions are kept in commit order, the later one wins a tie
+	price, latest, found := decimal.Zero, int64(0), false
+	for _, exec := range s.executions {
+		order, ok := s.orders[exec.OrderID]
+		if !ok || order.Symbol != symbol {
+			continue
+		}
+		if !found || exec.Timestamp >= latest {
+			price, latest, found = exec.Price, exec.Timestamp, true
+		}
+	}
+	return price, nil
+}
+
+// ===================== Self-Trade Prevention Operations =====================
+
+func (s *MemoryStore) RecordSTPEvent(event *STPEvent) error {
+	return s.write(func() error {
+		event.ID = int64(len(s.stpEvents) + 1)
+		s.stpEvents = append(s.stpEvents, *event)
+		return nil
+	})
+}
+
+func (s *MemoryStore) GetSTPEventsByAccount(accountID string) ([]STPEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var events []STPEvent
+	for _, event := range s.stpEvents {
+		if event.TakerAccount == accountID || event.MakerAccount == accountID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ===================== Circuit Breaker Operations =====================
+
+func (s *MemoryStore) RecordBreakerEvent(event *BreakerEvent) error {
+	return s.write(func() error {
+		event.ID = int64(len(s.breakerEvents) + 1)
+		s.breakerEvents = append(s.breakerEvents, *event)
+		return nil
+	})
+}
+
+func (s *MemoryStore) GetHaltedUntil(symbol string, now int64) (int64, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var haltedUntil int64
+	for _, event := range s.breakerEvents {
+		if event.Symbol == symbol && event.HaltedUntil > now && event.HaltedUntil > haltedUntil {
+			haltedUntil = event.HaltedUntil
+		}
+	}
+	return haltedUntil, nil
+}
+
+// ===================== Transactions =====================
+
+// memoryTx is a transaction of a MemoryStore. Rows it reads are copied into
+// its overlay, and it changes the copies until commit puts them in the tables.
+type memoryTx struct {
+	store      *MemoryStore
+	accounts   map[string]*memoryAccount
+	positions  map[positionKey]decimal.Decimal
+	orders     map[string]*Order
+	executions []Execution
+	trades     []Trade
+}
+
+// account returns the transaction's copy of an account, nil if there is none
+func (tx *memoryTx) account(id string) *memoryAccount {
+	if account, ok := tx.accounts[id]; ok {
+		return account
+	}
+
+	tx.store.mutex.RLock()
+	defer tx.store.mutex.RUnlock()
+	account, ok := tx.store.accounts[id]
+	if !ok {
+		return nil
+	}
+	copied := *account
+	tx.accounts[id] = &copied
+	return &copied
+}
+
+// position returns the transaction's view of a position
+func (tx *memoryTx) position(key positionKey) (decimal.Decimal, bool) {
+	if amount, ok := tx.positions[key]; ok {
+		return amount, true
+	}
+
+	tx.store.mutex.RLock()
+	defer tx.store.mutex.RUnlock()
+	amount, ok := tx.store.positions[key]
+	return amount, ok
+}
+
+// order returns the transaction's copy of an order, nil if there is none
+func (tx *memoryTx) order(id string) *Order {
+	if order, ok := tx.orders[id]; ok {
+		return order
+	}
+
+	tx.store.mutex.RLock()
+	defer tx.store.mutex.RUnlock()
+	order, ok := tx.store.orders[id]
+	if !ok {
+		return nil
+	}
+	copied := *order
+	tx.orders[id] = &copied
+	return &copied
+}
+
+// commit puts everything the transaction changed in the tables
+func (tx *memoryTx) commit() {
+	s := tx.store
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, account := range tx.accounts {
+		s.accounts[id] = account
+	}
+	for key, amount := range tx.positions {
+		s.positions[key] = amount
+	}
+	for id, order := range tx.orders {
+		s.orders[id] = order
+	}
+	s.executions = append(s.executions, tx.executions...)
+	for i := range tx.trades {
+		trade := tx.trades[i]
+		s.trades[trade.ID] = &trade
+	}
+}
+
+func (tx *memoryTx) CreateAccount(id string, balance decimal.Decimal) error {
+	if tx.account(id) != nil {
+		return fmt.Errorf("account already exists: %s", id)
+	}
+	tx.accounts[id] = &memoryAccount{Account: Account{ID: id, Balance: numeric(balance)}}
+	return nil
+}
+
+func (tx *memoryTx) GetBalanceForUpdate(id string) (decimal.Decimal, error) {
+	account := tx.account(id)
+	if account == nil {
+		return decimal.Zero, fmt.Errorf("account not found: %s", id)
+	}
+	return account.Balance, nil
+}
+
+func (tx *memoryTx) UpdateAccountBalance(id string, balance decimal.Decimal) error {
+	if account := tx.account(id); account != nil {
+		account.Balance = numeric(balance)
+	}
+	return nil
+}
+
+func (tx *memoryTx) CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error {
+	key := positionKey{accountID, symbol}
+	if _, ok := tx.position(key); !ok && tx.account(accountID) == nil {
+		return fmt.Errorf("error creating position in transaction: account not found: %s", accountID)
+	}
+	tx.positions[key] = numeric(amount)
+	return nil
+}
+
+func (tx *memoryTx) GetPositionForUpdate(accountID string, symbol string) (decimal.Decimal, error) {
+	amount, ok := tx.position(positionKey{accountID, symbol})
+	if !ok {
+		return decimal.Zero, nil
+	}
+	return amount, nil
+}
+
+func (tx *memoryTx) CreateOrder(order *Order) error {
+	if tx.order(order.ID) != nil {
+		return fmt.Errorf("error creating order in transaction: order already exists: %s", order.ID)
+	}
+	if order.AccountID != "" && tx.account(order.AccountID) == nil {
+		return fmt.Errorf("error creating order in transaction: account not found: %s", order.AccountID)
+	}
+
+	stored := *order
+	stored.Amount = numeric(order.Amount)
+	stored.Price = numeric(order.Price)
+	stored.Remaining = numeric(order.Remaining)
+	stored.StopPrice = numeric(order.StopPrice)
+	stored.Display = numeric(order.Display)
+	stored.Visible = numeric(order.Visible)
+	stored.CanceledTime = 0
+	tx.orders[order.ID] = &stored
+	return nil
+}
+
+func (tx *memoryTx) GetOrderForUpdate(orderID string) (*Order, error) {
+	order := tx.order(orderID)
+	if order == nil {
+		return nil, fmt.Errorf("order not found: %s", orderID)
+	}
+	result := *order
+	return &result, nil
+}
+
+func (tx *memoryTx) UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
+	if order := tx.order(orderID); order != nil {
+		order.Status = status
+		order.Remaining = numeric(remaining)
+		if canceledTime > 0 {
+			order.CanceledTime = canceledTime
+		}
+	}
+	return nil
+}
+
+func (tx *memoryTx) AmendOrder(amended *Order) error {
+	if order := tx.order(amended.ID); order != nil {
+		order.Amount = numeric(amended.Amount)
+		order.Price = numeric(amended.Price)
+		order.Remaining = numeric(amended.Remaining)
+		order.Visible = numeric(amended.Visible)
+		order.PriorityTime = amended.PriorityTime
+	}
+	return nil
+}
+
+func (tx *memoryTx) RepriceOrder(orderID string, price decimal.Decimal) error {
+	if order := tx.order(orderID); order != nil {
+		order.Price = numeric(price)
+	}
+	return nil
+}
+
+func (tx *memoryTx) DecrementOrder(orderID string, amount decimal.Decimal) error {
+	order := tx.order(orderID)
+	if order == nil || order.Status != "open" || !order.Remaining.GreaterThan(amount) {
+		return fmt.Errorf("order %s cannot be decremented by %s", orderID, amount.String())
+	}
+	order.Remaining = numeric(order.Remaining.Sub(amount))
+	order.Visible = decimal.Max(decimal.Min(order.Visible, order.Remaining), decimal.Zero)
+	return nil
+}
+
+func (tx *memoryTx) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	if order := tx.order(orderID); order != nil {
+		order.Visible = numeric(visible)
+		order.PriorityTime = priorityTime
+	}
+	return nil
+}
+
+func (tx *memoryTx) ActivateStopOrder(orderID string, orderType string) error {
+	order := tx.order(orderID)
+	if order == nil || order.Status != "pending" {
+		return fmt.Errorf("stop order is not pending: %s", orderID)
+	}
+	order.Status = "open"
+	order.OrderType = orderType
+	return nil
+}
+
+func (tx *memoryTx) RecordTrade(trade *Trade) error {
+	tx.store.mutex.Lock()
+	trade.ID = tx.store.nextTradeID
+	tx.store.nextTradeID++
+	tx.store.mutex.Unlock()
+
+	stored := *trade
+	stored.Price = numeric(trade.Price)
+	stored.Shares = numeric(trade.Shares)
+	tx.trades = append(tx.trades, stored)
+	return nil
+}
+
+func (tx *memoryTx) RecordExecution(execution *Execution) error {
+	// an order executes once per trade
+	if execution.TradeID != 0 {
+		duplicate := func(executions []Execution) bool {
+			for _, exec := range executions {
+				if exec.OrderID == execution.OrderID && exec.TradeID == execution.TradeID {
+					return true
+				}
+			}
+			return false
+		}
+		tx.store.mutex.RLock()
+		exists := duplicate(tx.store.executions)
+		tx.store.mutex.RUnlock()
+		if exists || duplicate(tx.executions) {
+			return fmt.Errorf("error creating execution in transaction: order %s already executed in trade %d",
+				execution.OrderID, execution.TradeID)
+		}
+	}
+
+	stored := *execution
+	stored.Shares = numeric(execution.Shares)
+	stored.Price = numeric(execution.Price)
+	stored.Fee = numeric(execution.Fee)
+	tx.executions = append(tx.executions, stored)
+	return nil
+}
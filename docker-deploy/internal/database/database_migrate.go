@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations/<dialect>/NNNN_name.sql, applied in version order
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock servers starting together take
+// to apply migrations one at a time. SQLite transactions lock the database already.
+const migrationLockID = 7310420231
+
+// Migration is one versioned change of the schema
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState is a migration and when it was applied, 0 if it is pending
+type MigrationState struct {
+	Migration
+	AppliedAt int64
+}
+
+// GetMigrations returns the migrations of the database's dialect in version order
+func GetMigrations(db *sql.DB) ([]Migration, error) {
+	dir := "migrations/postgres"
+	if isSQLite(db) {
+		dir = "migrations/sqlite"
+	}
+
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %v", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		number, err := strconv.Atoi(version)
+		if !ok || err != nil || !strings.HasSuffix(entry.Name(), ".sql") {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: number, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	// versions go 1, 2, 3... so a missing or doubled file is caught here
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d_%s is out of sequence", migration.Version, migration.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations, each in its own transaction, and
+// returns the ones it applied. It refuses a schema newer than its migrations.
+// Servers starting together apply each migration once, the others skip it.
+func MigrateUp(db *sql.DB) ([]Migration, error) {
+	migrations, err := GetMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		var done bool
+		err := ExecuteWithTransaction(db, func(tx *sql.Tx) error {
+			var err error
+			done, err = applyMigration(db, tx, migration, len(migrations))
+			return err
+		})
+		if err != nil {
+			return applied, err
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// applyMigration applies migration within a transaction unless the schema has it already
+func applyMigration(db *sql.DB, tx *sql.Tx, migration Migration, latest int) (bool, error) {
+	if !isSQLite(db) {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return false, fmt.Errorf("error locking migrations: %v", err)
+		}
+	}
+
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at BIGINT NOT NULL
+);`)
+	if err != nil {
+		return false, fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+
+	var version int
+	err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving schema version: %v", err)
+	}
+	if version > latest {
+		return false, fmt.Errorf("database schema version %d is newer than this server's %d", version, latest)
+	}
+	if version >= migration.Version {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return false, fmt.Errorf("error applying migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		migration.Version, migration.Name, time.Now().UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("error recording migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+
+	return true, nil
+}
+
+// GetSchemaVersion retrieves the version of the database schema, 0 before any migration
+func GetSchemaVersion(db *sql.DB) (int, error) {
+	exists, err := tableExists(db, "schema_migrations")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving schema version: %v", err)
+	}
+	return version, nil
+}
+
+// GetMigrationStatus retrieves every migration with when it was applied
+func GetMigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := GetMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]int64)
+	exists, err := tableExists(db, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving applied migrations: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version int
+			var at int64
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, fmt.Errorf("error scanning applied migration: %v", err)
+			}
+			appliedAt[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating applied migrations: %v", err)
+		}
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, migration := range migrations {
+		states[i] = MigrationState{Migration: migration, AppliedAt: appliedAt[migration.Version]}
+	}
+	return states, nil
+}
+
+// CheckSchemaVersion makes sure the database schema is the one of this server's migrations
+func CheckSchemaVersion(db *sql.DB) error {
+	migrations, err := GetMigrations(db)
+	if err != nil {
+		return err
+	}
+	version, err := GetSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than this server's %d", version, latest)
+	}
+	if version < latest {
+		return fmt.Errorf("database schema version %d is behind this server's %d, run the migrations", version, latest)
+	}
+	return nil
+}
+
+// tableExists checks if a table exists in the database
+func tableExists(db *sql.DB, table string) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_name = $1)"
+	if isSQLite(db) {
+		query = "SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)"
+	}
+
+	var exists bool
+	if err := db.QueryRow(query, table).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking if %s table exists: %v", table, err)
+	}
+	return exists, nil
+}
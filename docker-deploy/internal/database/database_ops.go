@@ -13,7 +13,7 @@ import (
 // CreateAccount creates a new account in the database
 func CreateAccount(db *sql.DB, id string, balance decimal.Decimal) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
+		txFuncs := newTxFunctions(db, tx)
 		return txFuncs.CreateAccount(id, balance)
 	})
 }
@@ -32,10 +32,74 @@ func GetAccount(db *sql.DB, id string) (*Account, error) {
 	return &account, nil
 }
 
+// GetAccounts retrieves every account ordered by ID
+func GetAccounts(db *sql.DB) ([]Account, error) {
+	rows, err := db.Query("SELECT id, balance FROM accounts ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving accounts: %v", err)
+	}
+	defer rows.Close()
+
+	var accounts []Account
+	for rows.Next() {
+		var account Account
+		if err := rows.Scan(&account.ID, &account.Balance); err != nil {
+			return nil, fmt.Errorf("error scanning account: %v", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounts: %v", err)
+	}
+
+	return accounts, nil
+}
+
+// GetAccountSTPMode returns the default self-trade prevention mode of an account
+func GetAccountSTPMode(db *sql.DB, id string) (string, error) {
+	var mode string
+	err := db.QueryRow("SELECT stp_mode FROM accounts WHERE id = $1", id).Scan(&mode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("account not found: %s", id)
+		}
+		return "", fmt.Errorf("error retrieving account: %v", err)
+	}
+
+	return mode, nil
+}
+
+// SetAccountSTPMode sets the default self-trade prevention mode of an account
+func SetAccountSTPMode(db *sql.DB, id string, mode string) error {
+	_, err := db.Exec("UPDATE accounts SET stp_mode = $1 WHERE id = $2", mode, id)
+	if err != nil {
+		return fmt.Errorf("error updating account stp mode: %v", err)
+	}
+	return nil
+}
+
+// SetAccountFeeTier puts an account in a fee tier, an empty tier means the defaults
+func SetAccountFeeTier(db *sql.DB, id string, tier string) error {
+	_, err := db.Exec("UPDATE accounts SET fee_tier = $1 WHERE id = $2", tier, id)
+	if err != nil {
+		return fmt.Errorf("error updating account fee tier: %v", err)
+	}
+	return nil
+}
+
+// EnsureAccount creates an empty account unless it already exists
+func EnsureAccount(db *sql.DB, id string) error {
+	_, err := db.Exec("INSERT INTO accounts (id, balance) VALUES ($1, 0) ON CONFLICT (id) DO NOTHING", id)
+	if err != nil {
+		return fmt.Errorf("error creating account: %v", err)
+	}
+	return nil
+}
+
 // UpdateAccountBalance updates an account's balance
 func UpdateAccountBalance(db *sql.DB, id string, balance decimal.Decimal) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
+		txFuncs := newTxFunctions(db, tx)
 		return txFuncs.UpdateAccountBalance(id, balance)
 	})
 }
@@ -86,37 +150,127 @@ func GetPosition(db *sql.DB, accountID string, symbol string) (*Position, error)
 // CreateOrUpdatePosition creates or updates a position
 func CreateOrUpdatePosition(db *sql.DB, accountID string, symbol string, amount decimal.Decimal) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
+		txFuncs := newTxFunctions(db, tx)
 		return txFuncs.CreateOrUpdatePosition(accountID, symbol, amount)
 	})
 }
 
+// ===================== Symbol Operations =====================
+
+// CreateOrUpdateSymbol stores the reference data of a symbol
+func CreateOrUpdateSymbol(db *sql.DB, symbol *Symbol) error {
+	_, err := db.Exec(
+		"INSERT INTO symbols (symbol, lot_size, tick_size, min_qty, max_qty, min_notional, matching, maker_fee_bps, taker_fee_bps) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) "+
+			"ON CONFLICT (symbol) DO UPDATE SET lot_size = $2, tick_size = $3, min_qty = $4, max_qty = $5, min_notional = $6, "+
+			"matching = $7, maker_fee_bps = $8, taker_fee_bps = $9",
+		symbol.Symbol, symbol.LotSize, symbol.TickSize, symbol.MinQty, symbol.MaxQty, symbol.MinNotional, symbol.Matching,
+		symbol.MakerFee, symbol.TakerFee)
+	if err != nil {
+		return fmt.Errorf("error saving symbol: %v", err)
+	}
+	return nil
+}
+
+// GetSymbol retrieves the reference data of a symbol,
+// symbols that never had any get the defaults
+func GetSymbol(db *sql.DB, name string) (*Symbol, error) {
+	symbol := Symbol{Symbol: name}
+	err := db.QueryRow("SELECT lot_size, tick_size, min_qty, max_qty, min_notional, matching, maker_fee_bps, taker_fee_bps "+
+		"FROM symbols WHERE symbol = $1", name).
+		Scan(&symbol.LotSize, &symbol.TickSize, &symbol.MinQty, &symbol.MaxQty, &symbol.MinNotional, &symbol.Matching,
+			&symbol.MakerFee, &symbol.TakerFee)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			symbol.LotSize = DefaultLotSize
+			symbol.Matching = MatchingPriceTime
+			return &symbol, nil
+		}
+		return nil, fmt.Errorf("error retrieving symbol: %v", err)
+	}
+
+	return &symbol, nil
+}
+
+// CreateOrUpdateFeeTier stores the rates of a fee tier
+func CreateOrUpdateFeeTier(db *sql.DB, tier *FeeTier) error {
+	_, err := db.Exec(
+		"INSERT INTO fee_tiers (name, maker_bps, taker_bps) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (name) DO UPDATE SET maker_bps = $2, taker_bps = $3",
+		tier.Name, tier.MakerBps, tier.TakerBps)
+	if err != nil {
+		return fmt.Errorf("error saving fee tier: %v", err)
+	}
+	return nil
+}
+
+// GetAccountFeeTier retrieves the fee tier of an account, nil if it has none
+func GetAccountFeeTier(db *sql.DB, accountID string) (*FeeTier, error) {
+	var tier FeeTier
+	err := db.QueryRow(
+		"SELECT t.name, t.maker_bps, t.taker_bps FROM accounts a JOIN fee_tiers t ON t.name = a.fee_tier WHERE a.id = $1",
+		accountID).Scan(&tier.Name, &tier.MakerBps, &tier.TakerBps)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error retrieving fee tier: %v", err)
+	}
+	return &tier, nil
+}
+
+// GetSymbolNames lists every symbol that has reference data or holders
+func GetSymbolNames(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT symbol FROM symbols UNION SELECT DISTINCT symbol FROM positions ORDER BY symbol")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving symbols: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning symbol: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating symbols: %v", err)
+	}
+
+	return names, nil
+}
+
 // ===================== Order Operations =====================
 
 // CreateOrder creates a new order in the database
 func CreateOrder(db *sql.DB, order *Order) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
+		txFuncs := newTxFunctions(db, tx)
 		return txFuncs.CreateOrder(order)
 	})
 }
 
-// GetOrder retrieves an order from the database
-func GetOrder(db *sql.DB, orderID string) (*Order, error) {
-	var order Order
-	var canceledTime sql.NullInt64 // Use sql.NullInt64 struct to handle NULL values
+// orderColumns lists the orders columns in the order scanOrder expects them
+const orderColumns = "id, account_id, symbol, amount, price, status, remaining, timestamp, canceled_time, order_type, tif, stop_price, " +
+	"display, visible, priority_time, stp_mode, stp_group, post_only, expire_time, fee_bps"
 
-	err := db.QueryRow(
-		"SELECT id, account_id, symbol, amount, price, status, remaining, timestamp, canceled_time "+
-			"FROM orders WHERE id = $1", orderID).Scan(
-		&order.ID, &order.AccountID, &order.Symbol, &order.Amount, &order.Price,
-		&order.Status, &order.Remaining, &order.Timestamp, &canceledTime)
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
+// scanOrder scans a row selected with orderColumns into an order
+func scanOrder(row rowScanner, order *Order) error {
+	var canceledTime sql.NullInt64 // Use sql.NullInt64 struct to handle NULL values
+
+	err := row.Scan(&order.ID, &order.AccountID, &order.Symbol, &order.Amount, &order.Price,
+		&order.Status, &order.Remaining, &order.Timestamp, &canceledTime, &order.OrderType, &order.TimeInForce, &order.StopPrice,
+		&order.Display, &order.Visible, &order.PriorityTime, &order.STPMode, &order.STPGroup, &order.PostOnly, &order.ExpireTime, &order.FeeBps)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("order not found: %s", orderID)
-		}
-		return nil, fmt.Errorf("error retrieving order: %v", err)
+		return err
 	}
 
 	// Convert NullInt64 to int64 (0 if NULL)
@@ -125,6 +279,20 @@ func GetOrder(db *sql.DB, orderID string) (*Order, error) {
 	} else {
 		order.CanceledTime = 0 // Use 0 or another default value for NULL
 	}
+	return nil
+}
+
+// GetOrder retrieves an order from the database
+func GetOrder(db *sql.DB, orderID string) (*Order, error) {
+	var order Order
+
+	err := scanOrder(db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1", orderID), &order)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("order not found: %s", orderID)
+		}
+		return nil, fmt.Errorf("error retrieving order: %v", err)
+	}
 
 	return &order, nil
 }
@@ -132,7 +300,7 @@ func GetOrder(db *sql.DB, orderID string) (*Order, error) {
 // UpdateOrderStatus updates an order's status and remaining amount
 func UpdateOrderStatus(db *sql.DB, orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
+		txFuncs := newTxFunctions(db, tx)
 		return txFuncs.UpdateOrderStatus(orderID, status, remaining, canceledTime)
 	})
 }
@@ -143,17 +311,21 @@ func GetOpenOrdersBySymbolForHeap(db *sql.DB, symbol string, target string, limi
 	orderStr := ""
 	if target == "buyer" {
 		condition = " AND amount > 0"
-		orderStr = " ORDER BY price DESC, timestamp ASC"
+		orderStr = " ORDER BY price DESC, priority_time ASC"
 	} else if target == "seller" {
 		condition = " AND amount < 0"
-		orderStr = " ORDER BY price ASC, timestamp ASC"
+		orderStr = " ORDER BY price ASC, priority_time ASC"
 	} else {
 		return nil, fmt.Errorf("target should be buyer or seller, but get%s", target)
 	}
 
-	limitStr := strconv.Itoa(limit)
-	sqlStr := "SELECT id, account_id, symbol, amount, price, status, remaining, timestamp, canceled_time " +
-		"FROM orders WHERE symbol = $1 AND status = 'open'" + condition + orderStr + " LIMIT " + limitStr
+	// a limit of zero returns the whole side of the book
+	limitStr := ""
+	if limit > 0 {
+		limitStr = " LIMIT " + strconv.Itoa(limit)
+	}
+	sqlStr := "SELECT " + orderColumns + " FROM orders WHERE symbol = $1 AND status = 'open'" +
+		condition + orderStr + limitStr
 	rows, err := db.Query(sqlStr, symbol)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving open orders: %v", err)
@@ -161,21 +333,212 @@ func GetOpenOrdersBySymbolForHeap(db *sql.DB, symbol string, target string, limi
 	defer rows.Close()
 
 	var orders []Order
-	var canceledTime sql.NullInt64 // Use sql.NullInt64 to handle NULL values
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
 
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// GetOpenOrdersAtPrice retrieves the open orders of one side resting at price, in time priority
+func GetOpenOrdersAtPrice(db *sql.DB, symbol string, isBuy bool, price decimal.Decimal) ([]Order, error) {
+	side := "amount < 0"
+	if isBuy {
+		side = "amount > 0"
+	}
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE symbol = $1 AND status = 'open' AND price = $2 AND "+side+
+			" ORDER BY priority_time ASC",
+		symbol, price)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving price level: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
 	for rows.Next() {
 		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// UpdateOrderSlice updates the shown iceberg slice and time priority of an order
+func UpdateOrderSlice(db *sql.DB, orderID string, visible decimal.Decimal, priorityTime int64) error {
+	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
+		txFuncs := newTxFunctions(db, tx)
+		return txFuncs.UpdateOrderSlice(orderID, visible, priorityTime)
+	})
+}
+
+// GetBookLevels aggregates the open orders of one side of a symbol's book by price,
+// best price first. Orders past their expire time at now are left out, depth 0 means every level.
+// The sizes are added up here, not in SQL, where SQLite would sum them in doubles.
+func GetBookLevels(db *sql.DB, symbol string, isBuy bool, depth int, now int64) ([]BookLevel, error) {
+	side, order := "amount < 0", "price ASC"
+	if isBuy {
+		side, order = "amount > 0", "price DESC"
+	}
+	rows, err := db.Query(
+		"SELECT price, CASE WHEN display > 0 THEN visible ELSE remaining END FROM orders"+
+			" WHERE symbol = $1 AND status = 'open' AND (expire_time = 0 OR expire_time > $2) AND "+side+
+			" ORDER BY "+order, symbol, now)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving book levels: %v", err)
+	}
+	defer rows.Close()
+
+	var levels []BookLevel
+	for rows.Next() {
+		var price, shares decimal.Decimal
+		if err := rows.Scan(&price, &shares); err != nil {
+			return nil, fmt.Errorf("error scanning book level: %v", err)
+		}
+		if n := len(levels); n > 0 && levels[n-1].Price.Equal(price) {
+			levels[n-1].Shares = levels[n-1].Shares.Add(shares)
+			levels[n-1].Orders++
+			continue
+		}
+		if depth > 0 && len(levels) == depth {
+			break
+		}
+		levels = append(levels, BookLevel{Price: price, Shares: shares, Orders: 1})
+	}
 
-		if err := rows.Scan(&order.ID, &order.AccountID, &order.Symbol, &order.Amount,
-			&order.Price, &order.Status, &order.Remaining, &order.Timestamp, &canceledTime); err != nil {
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating book levels: %v", err)
+	}
+
+	return levels, nil
+}
+
+// GetPendingStopsBySymbol retrieves all dormant stop orders of a symbol
+func GetPendingStopsBySymbol(db *sql.DB, symbol string) ([]Order, error) {
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE symbol = $1 AND status = 'pending' ORDER BY timestamp ASC",
+		symbol)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving pending stops: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
 			return nil, fmt.Errorf("error scanning order: %v", err)
 		}
+		orders = append(orders, order)
+	}
 
-		// Convert NullInt64 to int64 (0 if NULL)
-		if canceledTime.Valid {
-			order.CanceledTime = canceledTime.Int64
-		} else {
-			order.CanceledTime = 0 // Use 0 or another default value for NULL
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// GetOpenOrdersByAccount retrieves the open and pending orders of an account, oldest first
+func GetOpenOrdersByAccount(db *sql.DB, accountID string) ([]Order, error) {
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE account_id = $1 AND status IN ('open', 'pending') "+
+			"ORDER BY timestamp ASC",
+		accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving account orders: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// GetExpiredOrders retrieves the open and pending orders whose expire time has passed at now
+func GetExpiredOrders(db *sql.DB, now int64) ([]Order, error) {
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE expire_time > 0 AND expire_time <= $1 "+
+			"AND status IN ('open', 'pending') ORDER BY expire_time ASC",
+		now)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving expired orders: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// ActivateStopOrder turns a triggered stop into a live order of the given type
+func ActivateStopOrder(db *sql.DB, orderID string, orderType string) error {
+	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
+		txFuncs := newTxFunctions(db, tx)
+		return txFuncs.ActivateStopOrder(orderID, orderType)
+	})
+}
+
+// GetCrossingOrders returns the open orders on the opposite side of the book that
+// an order with the given side and limit price could trade against, in priority
+// order. Orders past their expire time at now are left out, they never trade.
+func GetCrossingOrders(db *sql.DB, symbol string, isBuy bool, price decimal.Decimal, now int64) ([]Order, error) {
+	condition := ""
+	if isBuy {
+		condition = " AND amount < 0 AND price <= $2 ORDER BY price ASC, priority_time ASC"
+	} else {
+		condition = " AND amount > 0 AND price >= $2 ORDER BY price DESC, priority_time ASC"
+	}
+
+	rows, err := db.Query("SELECT "+orderColumns+" FROM orders WHERE symbol = $1 AND status = 'open'"+
+		" AND (expire_time = 0 OR expire_time > $3)"+condition, symbol, price, now)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving crossing orders: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("error scanning order: %v", err)
 		}
 		orders = append(orders, order)
 	}
@@ -192,15 +555,16 @@ func GetOpenOrdersBySymbolForHeap(db *sql.DB, symbol string, target string, limi
 // RecordExecution creates a new execution record in the database
 func RecordExecution(db *sql.DB, execution *Execution) error {
 	return ExecuteWithTransaction(db, func(tx *sql.Tx) error {
-		txFuncs := &CommonTxFunctions{Tx: tx}
-		return txFuncs.RecordExecution(execution.OrderID, execution.Shares, execution.Price, execution.Timestamp)
+		txFuncs := newTxFunctions(db, tx)
+		return txFuncs.RecordExecution(execution)
 	})
 }
 
 // GetOrderExecutions retrieves all executions for an order
 func GetOrderExecutions(db *sql.DB, orderID string) ([]Execution, error) {
 	rows, err := db.Query(
-		"SELECT order_id, shares, price, timestamp FROM executions WHERE order_id = $1 ORDER BY timestamp",
+		"SELECT order_id, shares, price, fee, liquidity, COALESCE(trade_id, 0), timestamp FROM executions "+
+			"WHERE order_id = $1 ORDER BY timestamp, trade_id",
 		orderID)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving executions: %v", err)
@@ -210,7 +574,7 @@ func GetOrderExecutions(db *sql.DB, orderID string) ([]Execution, error) {
 	var executions []Execution
 	for rows.Next() {
 		var exec Execution
-		if err := rows.Scan(&exec.OrderID, &exec.Shares, &exec.Price, &exec.Timestamp); err != nil {
+		if err := rows.Scan(&exec.OrderID, &exec.Shares, &exec.Price, &exec.Fee, &exec.Liquidity, &exec.TradeID, &exec.Timestamp); err != nil {
 			return nil, fmt.Errorf("error scanning execution: %v", err)
 		}
 		executions = append(executions, exec)
@@ -223,10 +587,116 @@ func GetOrderExecutions(db *sql.DB, orderID string) ([]Execution, error) {
 	return executions, nil
 }
 
+// GetTrade retrieves a trade by ID
+func GetTrade(db *sql.DB, id int64) (*Trade, error) {
+	var trade Trade
+	err := db.QueryRow(
+		"SELECT id, symbol, buy_order_id, sell_order_id, buy_account, sell_account, price, shares, aggressor, timestamp "+
+			"FROM trades WHERE id = $1", id).
+		Scan(&trade.ID, &trade.Symbol, &trade.BuyOrderID, &trade.SellOrderID, &trade.BuyAccount, &trade.SellAccount,
+			&trade.Price, &trade.Shares, &trade.Aggressor, &trade.Timestamp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("trade not found: %d", id)
+		}
+		return nil, fmt.Errorf("error retrieving trade: %v", err)
+	}
+
+	return &trade, nil
+}
+
+// GetLastTradePrice retrieves the price of the most recent execution of a symbol
+// it returns zero if the symbol never traded
+func GetLastTradePrice(db *sql.DB, symbol string) (decimal.Decimal, error) {
+	var price decimal.Decimal
+	err := db.QueryRow(
+		"SELECT e.price FROM executions e JOIN orders o ON e.order_id = o.id "+
+			"WHERE o.symbol = $1 ORDER BY e.timestamp DESC LIMIT 1", symbol).Scan(&price)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return decimal.Zero, nil
+		}
+		return decimal.Zero, fmt.Errorf("error retrieving last trade price: %v", err)
+	}
+
+	return price, nil
+}
+
+// ===================== Self-Trade Prevention Operations =====================
+
+// RecordSTPEvent records a match prevented by self-trade prevention
+func RecordSTPEvent(db *sql.DB, event *STPEvent) error {
+	err := db.QueryRow(
+		"INSERT INTO stp_events (symbol, mode, taker_order_id, maker_order_id, taker_account, maker_account, stp_group, shares, timestamp) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		event.Symbol, event.Mode, event.TakerOrderID, event.MakerOrderID, event.TakerAccount, event.MakerAccount,
+		event.STPGroup, event.Shares, event.Timestamp).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("error recording stp event: %v", err)
+	}
+	return nil
+}
+
+// GetSTPEventsByAccount retrieves the prevented matches an account took part in, oldest first
+func GetSTPEventsByAccount(db *sql.DB, accountID string) ([]STPEvent, error) {
+	rows, err := db.Query(
+		"SELECT id, symbol, mode, taker_order_id, maker_order_id, taker_account, maker_account, stp_group, shares, timestamp "+
+			"FROM stp_events WHERE taker_account = $1 OR maker_account = $1 ORDER BY id ASC",
+		accountID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving stp events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []STPEvent
+	for rows.Next() {
+		var event STPEvent
+		err := rows.Scan(&event.ID, &event.Symbol, &event.Mode, &event.TakerOrderID, &event.MakerOrderID,
+			&event.TakerAccount, &event.MakerAccount, &event.STPGroup, &event.Shares, &event.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning stp event: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stp events: %v", err)
+	}
+
+	return events, nil
+}
+
+// RecordBreakerEvent records a circuit breaker halt
+func RecordBreakerEvent(db *sql.DB, event *BreakerEvent) error {
+	err := db.QueryRow(
+		"INSERT INTO breaker_events (symbol, kind, order_id, price, reference, lower_price, upper_price, halted_until, timestamp) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		event.Symbol, event.Kind, event.OrderID, event.Price, event.Reference, event.Lower, event.Upper,
+		event.HaltedUntil, event.Timestamp).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("error recording breaker event: %v", err)
+	}
+	return nil
+}
+
+// GetHaltedUntil returns when the latest circuit breaker halt of a symbol
+// still running at now ends, zero if it is not halted
+func GetHaltedUntil(db *sql.DB, symbol string, now int64) (int64, error) {
+	var haltedUntil int64
+	err := db.QueryRow(
+		"SELECT COALESCE(MAX(halted_until), 0) FROM breaker_events WHERE symbol = $1 AND halted_until > $2",
+		symbol, now).Scan(&haltedUntil)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving halt: %v", err)
+	}
+	return haltedUntil, nil
+}
+
 // ===================== Transaction Helpers =====================
 
-// ExecuteWithTransaction executes a function within a database transaction
-func ExecuteWithTransaction(db *sql.DB, fn func(*sql.Tx) error) error {
+// ExecuteWithTransaction executes a function within a database transaction,
+// a failed commit is returned like an error of fn
+func ExecuteWithTransaction(db *sql.DB, fn func(*sql.Tx) error) (err error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %v", err)
@@ -252,13 +722,28 @@ func ExecuteWithTransaction(db *sql.DB, fn func(*sql.Tx) error) error {
 
 // CommonTxFunctions contains common database operations that can be used within a transaction
 type CommonTxFunctions struct {
-	Tx *sql.Tx
+	Tx     *sql.Tx
+	sqlite bool
+}
+
+// newTxFunctions creates the transaction functions for a transaction on db
+func newTxFunctions(db *sql.DB, tx *sql.Tx) *CommonTxFunctions {
+	return &CommonTxFunctions{Tx: tx, sqlite: isSQLite(db)}
+}
+
+// forUpdate locks the rows read. SQLite has no row locks, its transactions
+// already hold the database's write lock, see sqliteDSN.
+func (f *CommonTxFunctions) forUpdate() string {
+	if f.sqlite {
+		return ""
+	}
+	return " FOR UPDATE"
 }
 
 // CreateAccount creates a new account within a transaction
 func (f *CommonTxFunctions) CreateAccount(id string, balance decimal.Decimal) error {
 	var exists bool
-	err := f.Tx.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 FOR UPDATE)", id).Scan(&exists)
+	err := f.Tx.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1"+f.forUpdate()+")", id).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("error checking if account exists in transaction: %v", err)
 	}
@@ -275,6 +760,19 @@ func (f *CommonTxFunctions) CreateAccount(id string, balance decimal.Decimal) er
 	return nil
 }
 
+// GetBalanceForUpdate reads and locks an account's balance within a transaction
+func (f *CommonTxFunctions) GetBalanceForUpdate(id string) (decimal.Decimal, error) {
+	var balance decimal.Decimal
+	err := f.Tx.QueryRow("SELECT balance FROM accounts WHERE id = $1"+f.forUpdate(), id).Scan(&balance)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return decimal.Zero, fmt.Errorf("account not found: %s", id)
+		}
+		return decimal.Zero, fmt.Errorf("error retrieving account balance in transaction: %v", err)
+	}
+	return balance, nil
+}
+
 // UpdateAccountBalance updates an account's balance within a transaction
 func (f *CommonTxFunctions) UpdateAccountBalance(id string, balance decimal.Decimal) error {
 	_, err := f.Tx.Exec("UPDATE accounts SET balance = $1 WHERE id = $2", balance, id)
@@ -289,7 +787,7 @@ func (f *CommonTxFunctions) CreateOrUpdatePosition(accountID string, symbol stri
 	// Check if position exists
 	var exists bool
 	err := f.Tx.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM positions WHERE account_id = $1 AND symbol = $2 FOR UPDATE)",
+		"SELECT EXISTS(SELECT 1 FROM positions WHERE account_id = $1 AND symbol = $2"+f.forUpdate()+")",
 		accountID, symbol).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("error checking if position exists in transaction: %v", err)
@@ -314,13 +812,30 @@ func (f *CommonTxFunctions) CreateOrUpdatePosition(accountID string, symbol stri
 	return nil
 }
 
+// GetPositionForUpdate reads and locks a position within a transaction, zero if there is none
+func (f *CommonTxFunctions) GetPositionForUpdate(accountID string, symbol string) (decimal.Decimal, error) {
+	var amount decimal.Decimal
+	err := f.Tx.QueryRow(
+		"SELECT amount FROM positions WHERE account_id = $1 AND symbol = $2"+f.forUpdate(),
+		accountID, symbol).Scan(&amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return decimal.Zero, nil
+		}
+		return decimal.Zero, fmt.Errorf("error retrieving position in transaction: %v", err)
+	}
+	return amount, nil
+}
+
 // CreateOrder creates a new order within a transaction
 func (f *CommonTxFunctions) CreateOrder(order *Order) error {
 	_, err := f.Tx.Exec(
-		"INSERT INTO orders (id, account_id, symbol, amount, price, status, remaining, timestamp) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		"INSERT INTO orders (id, account_id, symbol, amount, price, status, remaining, timestamp, order_type, tif, stop_price, "+
+			"display, visible, priority_time, stp_mode, stp_group, post_only, expire_time, fee_bps) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)",
 		order.ID, order.AccountID, order.Symbol, order.Amount, order.Price,
-		order.Status, order.Remaining, order.Timestamp)
+		order.Status, order.Remaining, order.Timestamp, order.OrderType, order.TimeInForce, order.StopPrice,
+		order.Display, order.Visible, order.PriorityTime, order.STPMode, order.STPGroup, order.PostOnly, order.ExpireTime, order.FeeBps)
 	if err != nil {
 		return fmt.Errorf("error creating order in transaction: %v", err)
 	}
@@ -328,11 +843,25 @@ func (f *CommonTxFunctions) CreateOrder(order *Order) error {
 	return nil
 }
 
+// RecordTrade records a trade within a transaction and sets its ID
+func (f *CommonTxFunctions) RecordTrade(trade *Trade) error {
+	err := f.Tx.QueryRow(
+		"INSERT INTO trades (symbol, buy_order_id, sell_order_id, buy_account, sell_account, price, shares, aggressor, timestamp) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		trade.Symbol, trade.BuyOrderID, trade.SellOrderID, trade.BuyAccount, trade.SellAccount,
+		trade.Price, trade.Shares, trade.Aggressor, trade.Timestamp).Scan(&trade.ID)
+	if err != nil {
+		return fmt.Errorf("error creating trade in transaction: %v", err)
+	}
+	return nil
+}
+
 // RecordExecution creates a new execution record within a transaction
-func (f *CommonTxFunctions) RecordExecution(orderID string, shares decimal.Decimal, price decimal.Decimal, timestamp int64) error {
+func (f *CommonTxFunctions) RecordExecution(execution *Execution) error {
 	_, err := f.Tx.Exec(
-		"INSERT INTO executions (order_id, shares, price, timestamp) VALUES ($1, $2, $3, $4)",
-		orderID, shares, price, timestamp)
+		"INSERT INTO executions (order_id, shares, price, fee, liquidity, trade_id, timestamp) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		execution.OrderID, execution.Shares, execution.Price, execution.Fee, execution.Liquidity,
+		sql.NullInt64{Int64: execution.TradeID, Valid: execution.TradeID != 0}, execution.Timestamp)
 	if err != nil {
 		return fmt.Errorf("error creating execution in transaction: %v", err)
 	}
@@ -360,21 +889,101 @@ func (f *CommonTxFunctions) UpdateOrderStatus(orderID string, status string, rem
 	return nil
 }
 
+// GetOrderForUpdate reads and locks an order within a transaction
+func (f *CommonTxFunctions) GetOrderForUpdate(orderID string) (*Order, error) {
+	var order Order
+	err := scanOrder(f.Tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1"+f.forUpdate(), orderID), &order)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("order not found: %s", orderID)
+		}
+		return nil, fmt.Errorf("error retrieving order in transaction: %v", err)
+	}
+	return &order, nil
+}
+
+// AmendOrder changes the size, price, iceberg slice and time priority of an order within a transaction
+func (f *CommonTxFunctions) AmendOrder(order *Order) error {
+	_, err := f.Tx.Exec(
+		"UPDATE orders SET amount = $1, price = $2, remaining = $3, visible = $4, priority_time = $5 WHERE id = $6",
+		order.Amount, order.Price, order.Remaining, order.Visible, order.PriorityTime, order.ID)
+	if err != nil {
+		return fmt.Errorf("error amending order in transaction: %v", err)
+	}
+	return nil
+}
+
+// RepriceOrder moves the limit price of an open order
+func (f *CommonTxFunctions) RepriceOrder(orderID string, price decimal.Decimal) error {
+	_, err := f.Tx.Exec("UPDATE orders SET price = $1 WHERE id = $2", price, orderID)
+	if err != nil {
+		return fmt.Errorf("error repricing order in transaction: %v", err)
+	}
+
+	return nil
+}
+
+// DecrementOrder takes amount off the remaining and visible size of an open order
+// without trading it. The sizes are worked out here, not in SQL, where SQLite
+// would do them in doubles.
+func (f *CommonTxFunctions) DecrementOrder(orderID string, amount decimal.Decimal) error {
+	var remaining, visible decimal.Decimal
+	err := f.Tx.QueryRow("SELECT remaining, visible FROM orders WHERE id = $1 AND status = 'open'"+f.forUpdate(),
+		orderID).Scan(&remaining, &visible)
+	if err == sql.ErrNoRows || (err == nil && !remaining.GreaterThan(amount)) {
+		return fmt.Errorf("order %s cannot be decremented by %s", orderID, amount.String())
+	}
+	if err != nil {
+		return fmt.Errorf("error decrementing order in transaction: %v", err)
+	}
+
+	remaining = remaining.Sub(amount)
+	_, err = f.Tx.Exec("UPDATE orders SET remaining = $1, visible = $2 WHERE id = $3",
+		remaining, decimal.Min(visible, remaining), orderID)
+	if err != nil {
+		return fmt.Errorf("error decrementing order in transaction: %v", err)
+	}
+	return nil
+}
+
+// UpdateOrderSlice updates the shown iceberg slice and time priority of an order within a transaction
+func (f *CommonTxFunctions) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	_, err := f.Tx.Exec("UPDATE orders SET visible = $1, priority_time = $2 WHERE id = $3",
+		visible, priorityTime, orderID)
+	if err != nil {
+		return fmt.Errorf("error updating order slice in transaction: %v", err)
+	}
+	return nil
+}
+
+// ActivateStopOrder turns a pending stop into an open order within a transaction
+func (f *CommonTxFunctions) ActivateStopOrder(orderID string, orderType string) error {
+	result, err := f.Tx.Exec(
+		"UPDATE orders SET status = 'open', order_type = $1 WHERE id = $2 AND status = 'pending'",
+		orderType, orderID)
+	if err != nil {
+		return fmt.Errorf("error activating stop order in transaction: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error activating stop order in transaction: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("stop order is not pending: %s", orderID)
+	}
+
+	return nil
+}
+
 // ===================== Server Start Helpers =====================
 
 // GetMaxOrderID retrieves the highest order ID from the database starting from server start
 func GetMaxOrderID(db *sql.DB) (int, error) {
 	// Check if orders table exists and has records
-	var exists bool
-	err := db.QueryRow(`
-        SELECT EXISTS (
-            SELECT 1 
-            FROM information_schema.tables 
-            WHERE table_name = 'orders'
-        )
-    `).Scan(&exists)
-	if err != nil {
-		return 0, fmt.Errorf("error checking if orders table exists: %v", err)
+	exists, err := tableExists(db, "orders")
+	if err != nil {
+		return 0, err
 	}
 
 	// If orders table doesn't exist, return default
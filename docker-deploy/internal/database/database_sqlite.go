@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"modernc.org/sqlite"
+)
+
+// The numbers of the SQLite schema are decimal strings, see 0017_exact_numbers.sql.
+// Their columns compare with the DECIMAL collation, so ORDER BY, = and < go by value.
+func init() {
+	sqlite.MustRegisterCollationUtf8("DECIMAL", compareDecimals)
+}
+
+// compareDecimals orders decimal strings by value. Anything that isn't a number
+// goes after the numbers, by its text.
+func compareDecimals(left, right string) int {
+	l, lerr := decimal.NewFromString(left)
+	r, rerr := decimal.NewFromString(right)
+	switch {
+	case lerr == nil && rerr == nil:
+		return l.Cmp(r)
+	case lerr == nil:
+		return -1
+	case rerr == nil:
+		return 1
+	}
+	return strings.Compare(left, right)
+}
+
+// sqliteDSN opens the database file with a busy wait instead of failing on a
+// locked database, WAL so reads don't wait for the writer, foreign keys on like
+// Postgres, and transactions that take the write lock when they begin. The
+// last one stands in for FOR UPDATE: a transaction holds the only write lock
+// from BEGIN to COMMIT, so what it reads can't change under it.
+func sqliteDSN(path string) string {
+	return "file:" + path +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+}
+
+// sqliteReadOnlyDSN opens an existing database file without writing to it
+func sqliteReadOnlyDSN(path string) string {
+	return "file:" + path + "?mode=ro&_pragma=busy_timeout(5000)"
+}
+
+// isSQLite tells if db is an embedded SQLite database rather than Postgres
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqlite.Driver)
+	return ok
+}
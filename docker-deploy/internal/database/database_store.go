@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/shopspring/decimal"
+)
+
+// Store is the storage the engine runs on. SQLStore keeps it in Postgres or
+// SQLite, MemoryStore in memory for running and testing without a database.
+type Store interface {
+	// accounts
+	CreateAccount(id string, balance decimal.Decimal) error
+	GetAccount(id string) (*Account, error)
+	GetAccounts() ([]Account, error)
+	GetAccountSTPMode(id string) (string, error)
+	SetAccountSTPMode(id string, mode string) error
+	SetAccountFeeTier(id string, tier string) error
+	EnsureAccount(id string) error
+	UpdateAccountBalance(id string, balance decimal.Decimal) error
+
+	// positions
+	GetPositions(accountID string) ([]Position, error)
+	GetPosition(accountID string, symbol string) (*Position, error)
+	CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error
+
+	// symbols and fee tiers
+	CreateOrUpdateSymbol(symbol *Symbol) error
+	GetSymbol(name string) (*Symbol, error)
+	GetSymbolNames() ([]string, error)
+	CreateOrUpdateFeeTier(tier *FeeTier) error
+	GetAccountFeeTier(accountID string) (*FeeTier, error)
+
+	// orders
+	CreateOrder(order *Order) error
+	GetOrder(orderID string) (*Order, error)
+	UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error
+	UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error
+	ActivateStopOrder(orderID string, orderType string) error
+	GetOpenOrdersBySymbolForHeap(symbol string, target string, limit int) ([]Order, error)
+	GetOpenOrdersAtPrice(symbol string, isBuy bool, price decimal.Decimal) ([]Order, error)
+	GetOpenOrdersByAccount(accountID string) ([]Order, error)
+	GetPendingStopsBySymbol(symbol string) ([]Order, error)
+	GetExpiredOrders(now int64) ([]Order, error)
+	GetBookLevels(symbol string, isBuy bool, depth int, now int64) ([]BookLevel, error)
+	GetCrossingOrders(symbol string, isBuy bool, price decimal.Decimal, now int64) ([]Order, error)
+	GetOrderHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]Order, *HistoryCursor, error)
+	GetMaxOrderID() (int, error)
+
+	// executions and trades
+	RecordExecution(execution *Execution) error
+	GetOrderExecutions(orderID string) ([]Execution, error)
+	GetExecutionHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]HistoryExecution, *HistoryCursor, error)
+	GetTrade(id int64) (*Trade, error)
+	GetLastTradePrice(symbol string) (decimal.Decimal, error)
+
+	// self-trade prevention and circuit breaker events
+	RecordSTPEvent(event *STPEvent) error
+	GetSTPEventsByAccount(accountID string) ([]STPEvent, error)
+	RecordBreakerEvent(event *BreakerEvent) error
+	GetHaltedUntil(symbol string, now int64) (int64, error)
+
+	// WithTx runs fn in a transaction, committed if fn returns nil and rolled back otherwise
+	WithTx(fn func(tx Tx) error) error
+}
+
+// Tx is what can be done within a transaction of a Store
+type Tx interface {
+	CreateAccount(id string, balance decimal.Decimal) error
+	GetBalanceForUpdate(id string) (decimal.Decimal, error)
+	UpdateAccountBalance(id string, balance decimal.Decimal) error
+	CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error
+	GetPositionForUpdate(accountID string, symbol string) (decimal.Decimal, error)
+	CreateOrder(order *Order) error
+	GetOrderForUpdate(orderID string) (*Order, error)
+	UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error
+	AmendOrder(order *Order) error
+	RepriceOrder(orderID string, price decimal.Decimal) error
+	DecrementOrder(orderID string, amount decimal.Decimal) error
+	UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error
+	ActivateStopOrder(orderID string, orderType string) error
+	RecordTrade(trade *Trade) error
+	RecordExecution(execution *Execution) error
+}
+
+var _ Tx = (*CommonTxFunctions)(nil)
+
+// SQLStore is the Store backed by Postgres or SQLite through the database functions
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore creates a Store on a database connection
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// DB returns the database connection of the store
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// WithTx runs fn in a database transaction
+func (s *SQLStore) WithTx(fn func(tx Tx) error) error {
+	return ExecuteWithTransaction(s.db, func(tx *sql.Tx) error {
+		return fn(newTxFunctions(s.db, tx))
+	})
+}
+
+func (s *SQLStore) CreateAccount(id string, balance decimal.Decimal) error {
+	return CreateAccount(s.db, id, balance)
+}
+
+func (s *SQLStore) GetAccount(id string) (*Account, error) {
+	return GetAccount(s.db, id)
+}
+
+func (s *SQLStore) GetAccounts() ([]Account, error) {
+	return GetAccounts(s.db)
+}
+
+func (s *SQLStore) GetAccountSTPMode(id string) (string, error) {
+	return GetAccountSTPMode(s.db, id)
+}
+
+func (s *SQLStore) SetAccountSTPMode(id string, mode string) error {
+	return SetAccountSTPMode(s.db, id, mode)
+}
+
+func (s *SQLStore) SetAccountFeeTier(id string, tier string) error {
+	return SetAccountFeeTier(s.db, id, tier)
+}
+
+func (s *SQLStore) EnsureAccount(id string) error {
+	return EnsureAccount(s.db, id)
+}
+
+func (s *SQLStore) UpdateAccountBalance(id string, balance decimal.Decimal) error {
+	return UpdateAccountBalance(s.db, id, balance)
+}
+
+func (s *SQLStore) GetPositions(accountID string) ([]Position, error) {
+	return GetPositions(s.db, accountID)
+}
+
+func (s *SQLStore) GetPosition(accountID string, symbol string) (*Position, error) {
+	return GetPosition(s.db, accountID, symbol)
+}
+
+func (s *SQLStore) CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error {
+	return CreateOrUpdatePosition(s.db, accountID, symbol, amount)
+}
+
+func (s *SQLStore) CreateOrUpdateSymbol(symbol *Symbol) error {
+	return CreateOrUpdateSymbol(s.db, symbol)
+}
+
+func (s *SQLStore) GetSymbol(name string) (*Symbol, error) {
+	return GetSymbol(s.db, name)
+}
+
+func (s *SQLStore) GetSymbolNames() ([]string, error) {
+	return GetSymbolNames(s.db)
+}
+
+func (s *SQLStore) CreateOrUpdateFeeTier(tier *FeeTier) error {
+	return CreateOrUpdateFeeTier(s.db, tier)
+}
+
+func (s *SQLStore) GetAccountFeeTier(accountID string) (*FeeTier, error) {
+	return GetAccountFeeTier(s.db, accountID)
+}
+
+func (s *SQLStore) CreateOrder(order *Order) error {
+	return CreateOrder(s.db, order)
+}
+
+func (s *SQLStore) GetOrder(orderID string) (*Order, error) {
+	return GetOrder(s.db, orderID)
+}
+
+func (s *SQLStore) UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
+	return UpdateOrderStatus(s.db, orderID, status, remaining, canceledTime)
+}
+
+func (s *SQLStore) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	return UpdateOrderSlice(s.db, orderID, visible, priorityTime)
+}
+
+func (s *SQLStore) ActivateStopOrder(orderID string, orderType string) error {
+	return ActivateStopOrder(s.db, orderID, orderType)
+}
+
+func (s *SQLStore) GetOpenOrdersBySymbolForHeap(symbol string, target string, limit int) ([]Order, error) {
+	return GetOpenOrdersBySymbolForHeap(s.db, symbol, target, limit)
+}
+
+func (s *SQLStore) GetOpenOrdersAtPrice(symbol string, isBuy bool, price decimal.Decimal) ([]Order, error) {
+	return GetOpenOrdersAtPrice(s.db, symbol, isBuy, price)
+}
+
+func (s *SQLStore) GetOpenOrdersByAccount(accountID string) ([]Order, error) {
+	return GetOpenOrdersByAccount(s.db, accountID)
+}
+
+func (s *SQLStore) GetPendingStopsBySymbol(symbol string) ([]Order, error) {
+	return GetPendingStopsBySymbol(s.db, symbol)
+}
+
+func (s *SQLStore) GetExpiredOrders(now int64) ([]Order, error) {
+	return GetExpiredOrders(s.db, now)
+}
+
+func (s *SQLStore) GetBookLevels(symbol string, isBuy bool, depth int, now int64) ([]BookLevel, error) {
+	return GetBookLevels(s.db, symbol, isBuy, depth, now)
+}
+
+func (s *SQLStore) GetCrossingOrders(symbol string, isBuy bool, price decimal.Decimal, now int64) ([]Order, error) {
+	return GetCrossingOrders(s.db, symbol, isBuy, price, now)
+}
+
+func (s *SQLStore) GetOrderHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]Order, *HistoryCursor, error) {
+	return GetOrderHistory(s.db, filter, cursor)
+}
+
+func (s *SQLStore) GetMaxOrderID() (int, error) {
+	return GetMaxOrderID(s.db)
+}
+
+func (s *SQLStore) RecordExecution(execution *Execution) error {
+	return RecordExecution(s.db, execution)
+}
+
+func (s *SQLStore) GetOrderExecutions(orderID string) ([]Execution, error) {
+	return GetOrderExecutions(s.db, orderID)
+}
+
+func (s *SQLStore) GetExecutionHistory(filter *HistoryFilter, cursor *HistoryCursor) ([]HistoryExecution, *HistoryCursor, error) {
+	return GetExecutionHistory(s.db, filter, cursor)
+}
+
+func (s *SQLStore) GetTrade(id int64) (*Trade, error) {
+	return GetTrade(s.db, id)
+}
+
+func (s *SQLStore) GetLastTradePrice(symbol string) (decimal.Decimal, error) {
+	return GetLastTradePrice(s.db, symbol)
+}
+
+func (s *SQLStore) RecordSTPEvent(event *STPEvent) error {
+	return RecordSTPEvent(s.db, event)
+}
+
+func (s *SQLStore) GetSTPEventsByAccount(accountID string) ([]STPEvent, error) {
+	return GetSTPEventsByAccount(s.db, accountID)
+}
+
+func (s *SQLStore) RecordBreakerEvent(event *BreakerEvent) error {
+	return RecordBreakerEvent(s.db, event)
+}
+
+func (s *SQLStore) GetHaltedUntil(symbol string, now int64) (int64, error) {
+	return GetHaltedUntil(s.db, symbol, now)
+}
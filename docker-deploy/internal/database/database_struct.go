@@ -17,17 +17,104 @@ type Position struct {
 	Amount    decimal.Decimal // amount of shares/units held
 }
 
+// order types
+const (
+	OrderTypeLimit     = "limit"
+	OrderTypeMarket    = "market"
+	OrderTypeStop      = "stop"       // becomes a market order once triggered
+	OrderTypeStopLimit = "stop_limit" // becomes a limit order once triggered
+)
+
+// time in force
+const (
+	TimeInForceGTC = "GTC" // good till canceled, rests in the book
+	TimeInForceIOC = "IOC" // immediate or cancel, remainder is canceled
+	TimeInForceFOK = "FOK" // fill or kill, fully executes or is canceled untouched
+	TimeInForceGTD = "GTD" // good till date, rests in the book until its expire time
+	TimeInForceDay = "DAY" // rests in the book until the end of the trading day
+)
+
+// TimeInForceRests reports whether orders with this time in force may rest in the book
+func TimeInForceRests(tif string) bool {
+	return tif == TimeInForceGTC || tif == TimeInForceGTD || tif == TimeInForceDay
+}
+
+// self-trade prevention modes, applied when an order would trade against
+// a resting order of the same account or STP group
+const (
+	STPCancelNewest = "CN" // cancel the incoming order
+	STPCancelOldest = "CO" // cancel the resting order
+	STPCancelBoth   = "CB" // cancel both orders
+	STPDecrement    = "DC" // decrement both by the smaller size, canceling whichever runs out
+)
+
+// what a post-only order does when it would cross the book on arrival
+const (
+	PostOnlyReject  = "reject"  // reject the order
+	PostOnlyReprice = "reprice" // move it one tick away from the best opposite price
+)
+
+// which price band a circuit breaker event breached
+const (
+	BreakerCollar = "collar" // static collar around the reference price
+	BreakerBand   = "band"   // dynamic volatility band around the last trade
+)
+
 // Order represents an order in the database
 type Order struct {
 	ID           string          // order ID
 	AccountID    string          // account ID that placed the order
 	Symbol       string          // symbol being traded
 	Amount       decimal.Decimal // amount to trade (negative for sell, positive for buy)
-	Price        decimal.Decimal // limit price
-	Status       string          // "open", "executed", or "canceled"
+	Price        decimal.Decimal // limit price, or protection price for market buys
+	OrderType    string          // "limit", "market", "stop" or "stop_limit"
+	TimeInForce  string          // "GTC", "IOC", "FOK", "GTD" or "DAY"
+	StopPrice    decimal.Decimal // trigger price of stop orders, zero otherwise
+	Status       string          // "pending", "open", "executed", "canceled" or "expired"
 	Remaining    decimal.Decimal // remaining amount to be executed
 	Timestamp    int64           // timestamp when order was placed
 	CanceledTime int64           // timestamp when order was canceled (if applicable)
+	Display      decimal.Decimal // iceberg slice size, zero if the whole order is shown
+	Visible      decimal.Decimal // what is left of the current iceberg slice
+	PriorityTime int64           // time priority in the book, reset when an iceberg slice is replenished
+	STPMode      string          // self-trade prevention mode, see the STP constants
+	STPGroup     string          // orders of different accounts in the same group never trade together
+	PostOnly     string          // "reject" or "reprice" for orders that may never take liquidity, empty otherwise
+	ExpireTime   int64           // when GTD and DAY orders expire, zero if never
+	FeeBps       decimal.Decimal // fee rate in basis points a buy order reserved its fees at
+}
+
+// Expired reports whether the order's expire time has passed at now
+func (order *Order) Expired(now int64) bool {
+	return order.ExpireTime > 0 && order.ExpireTime <= now
+}
+
+// SelfTrades reports whether two orders belong to the same account or STP group
+func (order *Order) SelfTrades(other *Order) bool {
+	if order.AccountID == other.AccountID {
+		return true
+	}
+	return order.STPGroup != "" && order.STPGroup == other.STPGroup
+}
+
+// IsIceberg reports whether only a slice of the order is shown in the book
+func (order *Order) IsIceberg() bool {
+	return order.Display.IsPositive()
+}
+
+// Shown returns the amount other orders can trade against right now
+func (order *Order) Shown() decimal.Decimal {
+	if order.IsIceberg() {
+		return order.Visible
+	}
+	return order.Remaining
+}
+
+// BookLevel aggregates the open orders of one side of the book at one price
+type BookLevel struct {
+	Price  decimal.Decimal // limit price of the level
+	Shares decimal.Decimal // shown quantity, hidden iceberg quantity is left out
+	Orders int             // number of orders at the level
 }
 
 // Execution represents an order execution (trade) in the database
@@ -35,10 +122,93 @@ type Execution struct {
 	OrderID   string          // order ID that was executed
 	Shares    decimal.Decimal // number of shares/units executed
 	Price     decimal.Decimal // execution price
+	Fee       decimal.Decimal // fee the order paid on it, negative for a rebate
+	Liquidity string          // LiquidityMaker or LiquidityTaker
+	TradeID   int64           // trade the execution is one side of, zero before trades were recorded
 	Timestamp int64           // timestamp when execution occurred
 }
 
-// Symbol represents a symbol in the database
+// Trade links the buy and sell side of one match
+type Trade struct {
+	ID          int64           // monotonically increasing trade ID
+	Symbol      string          // symbol traded
+	BuyOrderID  string          // buy order
+	SellOrderID string          // sell order
+	BuyAccount  string          // account of the buy order
+	SellAccount string          // account of the sell order
+	Price       decimal.Decimal // execution price
+	Shares      decimal.Decimal // quantity traded
+	Aggressor   string          // side that took liquidity, empty for auction trades
+	Timestamp   int64           // when the trade happened
+}
+
+// which side of a trade took liquidity
+const (
+	AggressorBuy  = "buy"
+	AggressorSell = "sell"
+)
+
+// which side of an execution an order was on
+const (
+	LiquidityMaker = "M" // the order rested in the book, or traded in an auction
+	LiquidityTaker = "T" // the order took liquidity from the book
+)
+
+// FeeTier is a named pair of fee rates accounts can be put in
+type FeeTier struct {
+	Name     string          // tier name
+	MakerBps decimal.Decimal // maker fee in basis points, negative for a rebate
+	TakerBps decimal.Decimal // taker fee in basis points
+}
+
+// STPEvent records a match that self-trade prevention stopped
+type STPEvent struct {
+	ID           int64           // event ID
+	Symbol       string          // symbol of both orders
+	Mode         string          // mode that was applied
+	TakerOrderID string          // incoming order
+	MakerOrderID string          // resting order
+	TakerAccount string          // account of the incoming order
+	MakerAccount string          // account of the resting order
+	STPGroup     string          // shared STP group, empty if matched on account
+	Shares       decimal.Decimal // amount that would have traded
+	Timestamp    int64           // when the match was prevented
+}
+
+// BreakerEvent records a trade that a price band stopped and the halt it caused
+type BreakerEvent struct {
+	ID          int64           // event ID
+	Symbol      string          // halted symbol
+	Kind        string          // band that was breached
+	OrderID     string          // incoming order that would have traded
+	Price       decimal.Decimal // price it would have traded at
+	Reference   decimal.Decimal // price the band is centered on
+	Lower       decimal.Decimal // lowest price inside the band
+	Upper       decimal.Decimal // highest price inside the band
+	HaltedUntil int64           // when trading resumes
+	Timestamp   int64           // when the breaker tripped
+}
+
+// Symbol represents a symbol and its trading rules in the database,
+// a zero rule other than the lot size means no limit
 type Symbol struct {
-	Symbol string // symbol name
+	Symbol      string              // symbol name
+	LotSize     decimal.Decimal     // order quantities must be multiples of it
+	TickSize    decimal.Decimal     // order prices must be multiples of it
+	MinQty      decimal.Decimal     // smallest order quantity
+	MaxQty      decimal.Decimal     // largest order quantity
+	MinNotional decimal.Decimal     // smallest quantity times price of an order
+	Matching    string              // matching policy, empty means price-time
+	MakerFee    decimal.NullDecimal // maker fee override in basis points
+	TakerFee    decimal.NullDecimal // taker fee override in basis points
 }
+
+// how each price level is shared between the orders resting at it
+const (
+	MatchingPriceTime = "price_time" // oldest order first
+	MatchingProRata   = "pro_rata"   // in proportion to order size
+	MatchingTopOrder  = "top_order"  // the oldest order first, then pro-rata
+)
+
+// DefaultLotSize applies to symbols without reference data, whole shares only
+var DefaultLotSize = decimal.NewFromInt(1)
@@ -0,0 +1,34 @@
+-- The schema of the first release. Databases it set up without migrations
+-- already have these tables, IF NOT EXISTS adopts them as version 1.
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id VARCHAR(255) PRIMARY KEY,
+    balance NUMERIC(20, 2) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS positions (
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 6) NOT NULL,
+    PRIMARY KEY (account_id, symbol)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id VARCHAR(255) PRIMARY KEY,
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 6) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    remaining NUMERIC(20, 6) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    canceled_time BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS executions (
+    order_id VARCHAR(255) REFERENCES orders(id),
+    shares NUMERIC(20, 6) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    PRIMARY KEY (order_id, timestamp)
+);
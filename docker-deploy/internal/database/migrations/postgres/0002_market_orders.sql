@@ -0,0 +1,2 @@
+-- limit or market
+ALTER TABLE orders ADD COLUMN order_type VARCHAR(10) NOT NULL DEFAULT 'limit';
@@ -0,0 +1,19 @@
+-- default mode of the account's orders
+ALTER TABLE accounts ADD COLUMN stp_mode VARCHAR(2) NOT NULL DEFAULT '';
+
+ALTER TABLE orders
+    ADD COLUMN stp_mode VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN stp_group VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE stp_events (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(255) NOT NULL,
+    mode VARCHAR(2) NOT NULL,
+    taker_order_id VARCHAR(255) REFERENCES orders(id),
+    maker_order_id VARCHAR(255) REFERENCES orders(id),
+    taker_account VARCHAR(255) NOT NULL,
+    maker_account VARCHAR(255) NOT NULL,
+    stp_group VARCHAR(255) NOT NULL DEFAULT '',
+    shares NUMERIC(20, 6) NOT NULL,
+    timestamp BIGINT NOT NULL
+);
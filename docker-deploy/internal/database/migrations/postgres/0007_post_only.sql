@@ -0,0 +1,2 @@
+-- reject or reprice, empty for orders that may take liquidity
+ALTER TABLE orders ADD COLUMN post_only VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- when GTD and DAY orders expire, 0 if never
+ALTER TABLE orders ADD COLUMN expire_time BIGINT NOT NULL DEFAULT 0;
+
+-- the expiry scheduler only looks at orders that can expire
+CREATE INDEX idx_orders_expire_time ON orders (expire_time) WHERE expire_time > 0;
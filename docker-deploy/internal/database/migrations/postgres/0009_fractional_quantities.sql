@@ -0,0 +1,7 @@
+-- cents are not enough once quantities are fractional
+ALTER TABLE accounts ALTER COLUMN balance TYPE NUMERIC(20, 6);
+
+CREATE TABLE symbols (
+    symbol VARCHAR(255) PRIMARY KEY,
+    lot_size NUMERIC(20, 6) NOT NULL DEFAULT 1
+);
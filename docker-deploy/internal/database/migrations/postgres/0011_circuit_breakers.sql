@@ -0,0 +1,15 @@
+CREATE TABLE breaker_events (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(255) NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    order_id VARCHAR(255) REFERENCES orders(id),
+    price NUMERIC(20, 6) NOT NULL,
+    reference NUMERIC(20, 6) NOT NULL,
+    lower_price NUMERIC(20, 6) NOT NULL,
+    upper_price NUMERIC(20, 6) NOT NULL,
+    halted_until BIGINT NOT NULL,
+    timestamp BIGINT NOT NULL
+);
+
+-- halts still running are looked up when a symbol is loaded
+CREATE INDEX idx_breaker_events_symbol ON breaker_events (symbol, halted_until);
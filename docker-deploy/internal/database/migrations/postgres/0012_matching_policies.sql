@@ -0,0 +1,2 @@
+-- how a symbol allocates fills among the orders at a price
+ALTER TABLE symbols ADD COLUMN matching VARCHAR(20) NOT NULL DEFAULT 'price_time';
@@ -0,0 +1,17 @@
+ALTER TABLE accounts ADD COLUMN fee_tier VARCHAR(255) NOT NULL DEFAULT '';
+
+-- the fee paid on each execution and whether it made or took liquidity
+ALTER TABLE executions
+    ADD COLUMN fee NUMERIC(20, 6) NOT NULL DEFAULT 0,
+    ADD COLUMN liquidity VARCHAR(1) NOT NULL DEFAULT '';
+
+-- per-symbol overrides of the fees, NULL keeps the account's
+ALTER TABLE symbols
+    ADD COLUMN maker_fee_bps NUMERIC(10, 4),
+    ADD COLUMN taker_fee_bps NUMERIC(10, 4);
+
+CREATE TABLE fee_tiers (
+    name VARCHAR(255) PRIMARY KEY,
+    maker_bps NUMERIC(10, 4) NOT NULL,
+    taker_bps NUMERIC(10, 4) NOT NULL
+);
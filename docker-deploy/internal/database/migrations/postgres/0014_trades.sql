@@ -0,0 +1,20 @@
+CREATE TABLE trades (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(255) NOT NULL,
+    buy_order_id VARCHAR(255) REFERENCES orders(id),
+    sell_order_id VARCHAR(255) REFERENCES orders(id),
+    buy_account VARCHAR(255) NOT NULL,
+    sell_account VARCHAR(255) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    shares NUMERIC(20, 6) NOT NULL,
+    aggressor VARCHAR(4) NOT NULL DEFAULT '',
+    timestamp BIGINT NOT NULL
+);
+
+-- two fills in the same nanosecond broke the (order_id, timestamp) key,
+-- the trade tells them apart
+ALTER TABLE executions
+    ADD COLUMN trade_id BIGINT REFERENCES trades(id),
+    DROP CONSTRAINT executions_pkey;
+
+CREATE UNIQUE INDEX idx_executions_order_trade ON executions (order_id, trade_id);
@@ -0,0 +1,5 @@
+-- order history is read per account, newest first
+CREATE INDEX idx_orders_account_timestamp ON orders (account_id, timestamp);
+
+-- status queries and trade history look executions up by order
+CREATE INDEX idx_executions_order ON executions (order_id);
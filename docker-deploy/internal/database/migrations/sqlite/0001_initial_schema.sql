@@ -0,0 +1,35 @@
+-- The Postgres migrations for SQLite. Numbers start as NUMERIC columns, which
+-- SQLite stores as integers or doubles, until 0017_exact_numbers makes them
+-- decimal strings as exact as the Postgres columns.
+
+CREATE TABLE accounts (
+    id VARCHAR(255) PRIMARY KEY,
+    balance NUMERIC(20, 2) NOT NULL
+);
+
+CREATE TABLE positions (
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 6) NOT NULL,
+    PRIMARY KEY (account_id, symbol)
+);
+
+CREATE TABLE orders (
+    id VARCHAR(255) PRIMARY KEY,
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount NUMERIC(20, 6) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    remaining NUMERIC(20, 6) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    canceled_time BIGINT
+);
+
+CREATE TABLE executions (
+    order_id VARCHAR(255) REFERENCES orders(id),
+    shares NUMERIC(20, 6) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    PRIMARY KEY (order_id, timestamp)
+);
@@ -0,0 +1,2 @@
+-- orders from before rest in the book
+ALTER TABLE orders ADD COLUMN tif VARCHAR(10) NOT NULL DEFAULT 'GTC';
@@ -0,0 +1,2 @@
+-- trigger price of stop and stop limit orders
+ALTER TABLE orders ADD COLUMN stop_price NUMERIC(20, 6) NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- slice size, what is left of the slice and the time priority it has in the book
+ALTER TABLE orders ADD COLUMN display NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN visible NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN priority_time BIGINT NOT NULL DEFAULT 0;
+
+-- older orders keep their placement time as priority
+UPDATE orders SET priority_time = timestamp;
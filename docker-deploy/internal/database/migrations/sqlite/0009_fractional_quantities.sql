@@ -0,0 +1,6 @@
+-- SQLite keeps balances at any precision, only the symbols are new
+
+CREATE TABLE symbols (
+    symbol VARCHAR(255) PRIMARY KEY,
+    lot_size NUMERIC(20, 6) NOT NULL DEFAULT 1
+);
@@ -0,0 +1,5 @@
+-- trading rules of a symbol, 0 turns a rule off
+ALTER TABLE symbols ADD COLUMN tick_size NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE symbols ADD COLUMN min_qty NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE symbols ADD COLUMN max_qty NUMERIC(20, 6) NOT NULL DEFAULT 0;
+ALTER TABLE symbols ADD COLUMN min_notional NUMERIC(20, 6) NOT NULL DEFAULT 0;
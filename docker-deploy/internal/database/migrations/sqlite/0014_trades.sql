@@ -0,0 +1,33 @@
+CREATE TABLE trades (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(255) NOT NULL,
+    buy_order_id VARCHAR(255) REFERENCES orders(id),
+    sell_order_id VARCHAR(255) REFERENCES orders(id),
+    buy_account VARCHAR(255) NOT NULL,
+    sell_account VARCHAR(255) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    shares NUMERIC(20, 6) NOT NULL,
+    aggressor VARCHAR(4) NOT NULL DEFAULT '',
+    timestamp BIGINT NOT NULL
+);
+
+-- two fills in the same nanosecond broke the (order_id, timestamp) key, the
+-- trade tells them apart. SQLite cannot drop a key, the table is rebuilt.
+CREATE TABLE executions_new (
+    order_id VARCHAR(255) REFERENCES orders(id),
+    shares NUMERIC(20, 6) NOT NULL,
+    price NUMERIC(20, 6) NOT NULL,
+    fee NUMERIC(20, 6) NOT NULL DEFAULT 0,
+    liquidity VARCHAR(1) NOT NULL DEFAULT '',
+    trade_id BIGINT REFERENCES trades(id),
+    timestamp BIGINT NOT NULL
+);
+
+INSERT INTO executions_new (order_id, shares, price, fee, liquidity, timestamp)
+    SELECT order_id, shares, price, fee, liquidity, timestamp FROM executions;
+
+DROP TABLE executions;
+
+ALTER TABLE executions_new RENAME TO executions;
+
+CREATE UNIQUE INDEX idx_executions_order_trade ON executions (order_id, trade_id);
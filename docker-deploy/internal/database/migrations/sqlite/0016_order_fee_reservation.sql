@@ -0,0 +1,3 @@
+-- the fee rate in basis points a buy order reserved its fees at, what is left of
+-- the reservation is given back at that rate
+ALTER TABLE orders ADD COLUMN fee_bps NUMERIC(10, 4) NOT NULL DEFAULT 0;
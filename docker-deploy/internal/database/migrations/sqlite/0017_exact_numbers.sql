@@ -0,0 +1,187 @@
+-- NUMERIC columns are stored as doubles by SQLite, so fractional money and
+-- quantities drift where Postgres is exact. Every number becomes TEXT, written
+-- and read as decimal strings, and compares as a number through the DECIMAL
+-- collation the server registers. SQLite cannot change a column's type, the
+-- tables are rebuilt. The old ones are renamed first so the references of their
+-- children follow them, and dropped children first once the rows are copied.
+
+ALTER TABLE accounts RENAME TO accounts_old;
+ALTER TABLE positions RENAME TO positions_old;
+ALTER TABLE orders RENAME TO orders_old;
+ALTER TABLE executions RENAME TO executions_old;
+ALTER TABLE stp_events RENAME TO stp_events_old;
+ALTER TABLE symbols RENAME TO symbols_old;
+ALTER TABLE breaker_events RENAME TO breaker_events_old;
+ALTER TABLE fee_tiers RENAME TO fee_tiers_old;
+ALTER TABLE trades RENAME TO trades_old;
+
+CREATE TABLE accounts (
+    id VARCHAR(255) PRIMARY KEY,
+    balance TEXT COLLATE DECIMAL NOT NULL,
+    stp_mode VARCHAR(2) NOT NULL DEFAULT '',
+    fee_tier VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE positions (
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount TEXT COLLATE DECIMAL NOT NULL,
+    PRIMARY KEY (account_id, symbol)
+);
+
+CREATE TABLE orders (
+    id VARCHAR(255) PRIMARY KEY,
+    account_id VARCHAR(255) REFERENCES accounts(id),
+    symbol VARCHAR(255) NOT NULL,
+    amount TEXT COLLATE DECIMAL NOT NULL,
+    price TEXT COLLATE DECIMAL NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    remaining TEXT COLLATE DECIMAL NOT NULL,
+    timestamp BIGINT NOT NULL,
+    canceled_time BIGINT,
+    order_type VARCHAR(10) NOT NULL DEFAULT 'limit',
+    tif VARCHAR(10) NOT NULL DEFAULT 'GTC',
+    stop_price TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    display TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    visible TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    priority_time BIGINT NOT NULL DEFAULT 0,
+    stp_mode VARCHAR(2) NOT NULL DEFAULT '',
+    stp_group VARCHAR(255) NOT NULL DEFAULT '',
+    post_only VARCHAR(10) NOT NULL DEFAULT '',
+    expire_time BIGINT NOT NULL DEFAULT 0,
+    fee_bps TEXT COLLATE DECIMAL NOT NULL DEFAULT '0'
+);
+
+CREATE TABLE trades (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(255) NOT NULL,
+    buy_order_id VARCHAR(255) REFERENCES orders(id),
+    sell_order_id VARCHAR(255) REFERENCES orders(id),
+    buy_account VARCHAR(255) NOT NULL,
+    sell_account VARCHAR(255) NOT NULL,
+    price TEXT COLLATE DECIMAL NOT NULL,
+    shares TEXT COLLATE DECIMAL NOT NULL,
+    aggressor VARCHAR(4) NOT NULL DEFAULT '',
+    timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE executions (
+    order_id VARCHAR(255) REFERENCES orders(id),
+    shares TEXT COLLATE DECIMAL NOT NULL,
+    price TEXT COLLATE DECIMAL NOT NULL,
+    fee TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    liquidity VARCHAR(1) NOT NULL DEFAULT '',
+    trade_id BIGINT REFERENCES trades(id),
+    timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE stp_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(255) NOT NULL,
+    mode VARCHAR(2) NOT NULL,
+    taker_order_id VARCHAR(255) REFERENCES orders(id),
+    maker_order_id VARCHAR(255) REFERENCES orders(id),
+    taker_account VARCHAR(255) NOT NULL,
+    maker_account VARCHAR(255) NOT NULL,
+    stp_group VARCHAR(255) NOT NULL DEFAULT '',
+    shares TEXT COLLATE DECIMAL NOT NULL,
+    timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE symbols (
+    symbol VARCHAR(255) PRIMARY KEY,
+    lot_size TEXT COLLATE DECIMAL NOT NULL DEFAULT '1',
+    tick_size TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    min_qty TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    max_qty TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    min_notional TEXT COLLATE DECIMAL NOT NULL DEFAULT '0',
+    matching VARCHAR(20) NOT NULL DEFAULT 'price_time',
+    maker_fee_bps TEXT COLLATE DECIMAL,
+    taker_fee_bps TEXT COLLATE DECIMAL
+);
+
+CREATE TABLE breaker_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(255) NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    order_id VARCHAR(255) REFERENCES orders(id),
+    price TEXT COLLATE DECIMAL NOT NULL,
+    reference TEXT COLLATE DECIMAL NOT NULL,
+    lower_price TEXT COLLATE DECIMAL NOT NULL,
+    upper_price TEXT COLLATE DECIMAL NOT NULL,
+    halted_until BIGINT NOT NULL,
+    timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE fee_tiers (
+    name VARCHAR(255) PRIMARY KEY,
+    maker_bps TEXT COLLATE DECIMAL NOT NULL,
+    taker_bps TEXT COLLATE DECIMAL NOT NULL
+);
+
+-- what the doubles held, rounded to the places of the Postgres columns,
+-- parents before the children that reference them
+INSERT INTO accounts (id, balance, stp_mode, fee_tier)
+    SELECT id, CAST(ROUND(balance, 6) AS TEXT), stp_mode, fee_tier FROM accounts_old;
+
+INSERT INTO positions (account_id, symbol, amount)
+    SELECT account_id, symbol, CAST(ROUND(amount, 6) AS TEXT) FROM positions_old;
+
+INSERT INTO orders (id, account_id, symbol, amount, price, status, remaining, timestamp, canceled_time,
+        order_type, tif, stop_price, display, visible, priority_time, stp_mode, stp_group, post_only,
+        expire_time, fee_bps)
+    SELECT id, account_id, symbol, CAST(ROUND(amount, 6) AS TEXT), CAST(ROUND(price, 6) AS TEXT), status,
+        CAST(ROUND(remaining, 6) AS TEXT), timestamp, canceled_time, order_type, tif,
+        CAST(ROUND(stop_price, 6) AS TEXT), CAST(ROUND(display, 6) AS TEXT), CAST(ROUND(visible, 6) AS TEXT),
+        priority_time, stp_mode, stp_group, post_only, expire_time, CAST(ROUND(fee_bps, 4) AS TEXT)
+    FROM orders_old;
+
+INSERT INTO trades (id, symbol, buy_order_id, sell_order_id, buy_account, sell_account, price, shares,
+        aggressor, timestamp)
+    SELECT id, symbol, buy_order_id, sell_order_id, buy_account, sell_account, CAST(ROUND(price, 6) AS TEXT),
+        CAST(ROUND(shares, 6) AS TEXT), aggressor, timestamp
+    FROM trades_old;
+
+INSERT INTO executions (order_id, shares, price, fee, liquidity, trade_id, timestamp)
+    SELECT order_id, CAST(ROUND(shares, 6) AS TEXT), CAST(ROUND(price, 6) AS TEXT), CAST(ROUND(fee, 6) AS TEXT),
+        liquidity, trade_id, timestamp
+    FROM executions_old;
+
+INSERT INTO stp_events (id, symbol, mode, taker_order_id, maker_order_id, taker_account, maker_account,
+        stp_group, shares, timestamp)
+    SELECT id, symbol, mode, taker_order_id, maker_order_id, taker_account, maker_account, stp_group,
+        CAST(ROUND(shares, 6) AS TEXT), timestamp
+    FROM stp_events_old;
+
+INSERT INTO symbols (symbol, lot_size, tick_size, min_qty, max_qty, min_notional, matching,
+        maker_fee_bps, taker_fee_bps)
+    SELECT symbol, CAST(ROUND(lot_size, 6) AS TEXT), CAST(ROUND(tick_size, 6) AS TEXT),
+        CAST(ROUND(min_qty, 6) AS TEXT), CAST(ROUND(max_qty, 6) AS TEXT), CAST(ROUND(min_notional, 6) AS TEXT),
+        matching, CAST(ROUND(maker_fee_bps, 4) AS TEXT), CAST(ROUND(taker_fee_bps, 4) AS TEXT)
+    FROM symbols_old;
+
+INSERT INTO breaker_events (id, symbol, kind, order_id, price, reference, lower_price, upper_price,
+        halted_until, timestamp)
+    SELECT id, symbol, kind, order_id, CAST(ROUND(price, 6) AS TEXT), CAST(ROUND(reference, 6) AS TEXT),
+        CAST(ROUND(lower_price, 6) AS TEXT), CAST(ROUND(upper_price, 6) AS TEXT), halted_until, timestamp
+    FROM breaker_events_old;
+
+INSERT INTO fee_tiers (name, maker_bps, taker_bps)
+    SELECT name, CAST(ROUND(maker_bps, 4) AS TEXT), CAST(ROUND(taker_bps, 4) AS TEXT) FROM fee_tiers_old;
+
+DROP TABLE executions_old;
+DROP TABLE stp_events_old;
+DROP TABLE breaker_events_old;
+DROP TABLE trades_old;
+DROP TABLE positions_old;
+DROP TABLE orders_old;
+DROP TABLE accounts_old;
+DROP TABLE symbols_old;
+DROP TABLE fee_tiers_old;
+
+-- the indexes went with the old tables
+CREATE INDEX idx_orders_expire_time ON orders (expire_time) WHERE expire_time > 0;
+CREATE INDEX idx_orders_account_timestamp ON orders (account_id, timestamp);
+CREATE INDEX idx_breaker_events_symbol ON breaker_events (symbol, halted_until);
+CREATE UNIQUE INDEX idx_executions_order_trade ON executions (order_id, trade_id);
+CREATE INDEX idx_executions_order ON executions (order_id);
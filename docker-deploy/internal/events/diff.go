@@ -0,0 +1,84 @@
+package events
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// Divergence is a balance or position the events and the store disagree on
+type Divergence struct {
+	AccountID string
+	Symbol    string // empty for the balance
+	Events    decimal.Decimal
+	Store     decimal.Decimal
+}
+
+func (d Divergence) String() string {
+	what := "balance"
+	if d.Symbol != "" {
+		what = "position in " + d.Symbol
+	}
+	return fmt.Sprintf("account %s %s: events %s, store %s", d.AccountID, what, d.Events.String(), d.Store.String())
+}
+
+// Diff compares the balances and positions folded from the events with the
+// store's. A missing account or position counts as zero.
+func Diff(st *State, store database.Store) ([]Divergence, error) {
+	accounts, err := store.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	positions := make(map[string]map[string]decimal.Decimal)
+	for _, account := range accounts {
+		balances[account.ID] = account.Balance
+		held, err := store.GetPositions(account.ID)
+		if err != nil {
+			return nil, err
+		}
+		positions[account.ID] = make(map[string]decimal.Decimal)
+		for _, position := range held {
+			positions[account.ID][position.Symbol] = position.Amount
+		}
+	}
+
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	var divergences []Divergence
+	compare := func(accountID string, symbol string, events, stored decimal.Decimal) {
+		if !events.Equal(stored) {
+			divergences = append(divergences, Divergence{AccountID: accountID, Symbol: symbol, Events: events, Store: stored})
+		}
+	}
+
+	for _, accountID := range union(balances, st.Accounts) {
+		compare(accountID, "", st.Accounts[accountID], balances[accountID])
+	}
+	for _, accountID := range union(positions, st.Positions) {
+		for _, symbol := range union(positions[accountID], st.Positions[accountID]) {
+			compare(accountID, symbol, st.Positions[accountID][symbol], positions[accountID][symbol])
+		}
+	}
+	return divergences, nil
+}
+
+// union returns the keys of two maps, sorted
+func union[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,181 @@
+package events
+
+import (
+	"StockOverflow/internal/database"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Event is a change of the exchange's state. Amounts are what the state is
+// after the change, so folding the events in order gives the state back.
+type Event interface {
+	Type() string
+}
+
+// AccountCreated is a new account with its opening balance
+type AccountCreated struct {
+	AccountID string          `json:"account_id"`
+	Balance   decimal.Decimal `json:"balance"`
+}
+
+// AccountEnsured is an account created empty unless it was there, like the house account
+type AccountEnsured struct {
+	AccountID string `json:"account_id"`
+}
+
+// BalanceChanged is the balance of an account after a reservation, fill, fee or refund
+type BalanceChanged struct {
+	AccountID string          `json:"account_id"`
+	Balance   decimal.Decimal `json:"balance"`
+}
+
+// PositionChanged is the shares of a symbol an account holds after a change
+type PositionChanged struct {
+	AccountID string          `json:"account_id"`
+	Symbol    string          `json:"symbol"`
+	Amount    decimal.Decimal `json:"amount"`
+}
+
+// OrderAccepted is an order written to the book, open or a pending stop
+type OrderAccepted struct {
+	Order database.Order `json:"order"`
+}
+
+// OrderUpdated is an order's status and remaining size after a fill
+type OrderUpdated struct {
+	OrderID   string          `json:"order_id"`
+	Status    string          `json:"status"`
+	Remaining decimal.Decimal `json:"remaining"`
+}
+
+// OrderCanceled is an order taken off the book, canceled or expired, with what was left of it
+type OrderCanceled struct {
+	OrderID   string          `json:"order_id"`
+	Status    string          `json:"status"`
+	Remaining decimal.Decimal `json:"remaining"`
+	Time      int64           `json:"time"`
+}
+
+// OrderAmended is an order after a replace changed its size or price
+type OrderAmended struct {
+	OrderID      string          `json:"order_id"`
+	Amount       decimal.Decimal `json:"amount"`
+	Price        decimal.Decimal `json:"price"`
+	Remaining    decimal.Decimal `json:"remaining"`
+	Visible      decimal.Decimal `json:"visible"`
+	PriorityTime int64           `json:"priority_time"`
+}
+
+// OrderRepriced is a post-only order moved to a price it can rest at
+type OrderRepriced struct {
+	OrderID string          `json:"order_id"`
+	Price   decimal.Decimal `json:"price"`
+}
+
+// OrderReduced is size taken off an order without trading, by self-trade prevention
+type OrderReduced struct {
+	OrderID string          `json:"order_id"`
+	Amount  decimal.Decimal `json:"amount"`
+}
+
+// OrderSliced is an iceberg order showing a new slice, behind the others at its price
+type OrderSliced struct {
+	OrderID      string          `json:"order_id"`
+	Visible      decimal.Decimal `json:"visible"`
+	PriorityTime int64           `json:"priority_time"`
+}
+
+// OrderActivated is a stop order that triggered and now trades as orderType
+type OrderActivated struct {
+	OrderID   string `json:"order_id"`
+	OrderType string `json:"order_type"`
+}
+
+// TradeExecuted is a trade between two orders
+type TradeExecuted struct {
+	Trade database.Trade `json:"trade"`
+}
+
+func (AccountCreated) Type() string  { return "account_created" }
+func (AccountEnsured) Type() string  { return "account_ensured" }
+func (BalanceChanged) Type() string  { return "balance_changed" }
+func (PositionChanged) Type() string { return "position_changed" }
+func (OrderAccepted) Type() string   { return "order_accepted" }
+func (OrderUpdated) Type() string    { return "order_updated" }
+func (OrderCanceled) Type() string   { return "order_canceled" }
+func (OrderAmended) Type() string    { return "order_amended" }
+func (OrderRepriced) Type() string   { return "order_repriced" }
+func (OrderReduced) Type() string    { return "order_reduced" }
+func (OrderSliced) Type() string     { return "order_sliced" }
+func (OrderActivated) Type() string  { return "order_activated" }
+func (TradeExecuted) Type() string   { return "trade_executed" }
+
+// Recorded is an event with its place in the log
+type Recorded struct {
+	Seq   uint64
+	Time  int64
+	Event Event
+}
+
+// envelope is a recorded event as it is written to the log
+type envelope struct {
+	Seq  uint64          `json:"seq"`
+	Time int64           `json:"time"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Marshal encodes a recorded event for the log
+func (r Recorded) Marshal() ([]byte, error) {
+	data, err := json.Marshal(r.Event)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s event: %v", r.Event.Type(), err)
+	}
+	return json.Marshal(envelope{Seq: r.Seq, Time: r.Time, Type: r.Event.Type(), Data: data})
+}
+
+// Unmarshal decodes a recorded event from the log
+func Unmarshal(body []byte) (Recorded, error) {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return Recorded{}, fmt.Errorf("error decoding event: %v", err)
+	}
+
+	var event Event
+	switch env.Type {
+	case "account_created":
+		event = &AccountCreated{}
+	case "account_ensured":
+		event = &AccountEnsured{}
+	case "balance_changed":
+		event = &BalanceChanged{}
+	case "position_changed":
+		event = &PositionChanged{}
+	case "order_accepted":
+		event = &OrderAccepted{}
+	case "order_updated":
+		event = &OrderUpdated{}
+	case "order_canceled":
+		event = &OrderCanceled{}
+	case "order_amended":
+		event = &OrderAmended{}
+	case "order_repriced":
+		event = &OrderRepriced{}
+	case "order_reduced":
+		event = &OrderReduced{}
+	case "order_sliced":
+		event = &OrderSliced{}
+	case "order_activated":
+		event = &OrderActivated{}
+	case "trade_executed":
+		event = &TradeExecuted{}
+	default:
+		return Recorded{}, fmt.Errorf("unknown event type %q at %d", env.Type, env.Seq)
+	}
+	if err := json.Unmarshal(env.Data, event); err != nil {
+		return Recorded{}, fmt.Errorf("error decoding %s event %d: %v", env.Type, env.Seq, err)
+	}
+	return Recorded{Seq: env.Seq, Time: env.Time, Event: event}, nil
+}
@@ -0,0 +1,182 @@
+package events
+
+import (
+	"StockOverflow/internal/journal"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log is an append-only file of recorded events, framed like the journal
+type Log struct {
+	file   *os.File
+	policy journal.SyncPolicy
+	mutex  sync.Mutex
+	seq    uint64
+	dirty  bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// ReadLog hands fn the events in the log at path after seq, in order, and
+// returns the last seq in it and where its valid records end. A last record
+// cut short by a crash is left out, a damaged record anywhere else is an error.
+func ReadLog(path string, after uint64, fn func(Recorded) error) (uint64, int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return after, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening event log: %v", err)
+	}
+	defer file.Close()
+	return readLog(file, after, fn)
+}
+
+// readLog reads the records of an open log from its start
+func readLog(file *os.File, after uint64, fn func(Recorded) error) (uint64, int64, error) {
+	reader := bufio.NewReader(file)
+	last := after
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("error reading event log: %v", err)
+		}
+
+		body, ok := journal.Unframe(line)
+		if !ok {
+			if _, err := reader.Peek(1); err == io.EOF {
+				break
+			}
+			return 0, 0, fmt.Errorf("event log is damaged at byte %d", offset)
+		}
+		recorded, err := Unmarshal(body)
+		if err != nil {
+			return 0, 0, fmt.Errorf("event log is damaged at byte %d: %v", offset, err)
+		}
+		offset += int64(len(line))
+
+		if recorded.Seq > last {
+			last = recorded.Seq
+		}
+		if recorded.Seq > after {
+			if err := fn(recorded); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return last, offset, nil
+}
+
+// OpenLog opens the event log at path, creating it if needed, hands fn the
+// events in it after seq and cuts off a torn last record
+func OpenLog(path string, policy journal.SyncPolicy, interval time.Duration, after uint64, fn func(Recorded) error) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening event log: %v", err)
+	}
+
+	last, offset, err := readLog(file, after, fn)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error repairing event log: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error seeking event log: %v", err)
+	}
+
+	l := &Log{file: file, policy: policy, seq: last}
+	if policy == journal.SyncInterval {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.syncEvery(interval)
+	}
+	return l, nil
+}
+
+// LastSeq returns the seq of the last event in the log
+func (l *Log) LastSeq() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.seq
+}
+
+// Append writes an event and syncs it if the policy says so
+func (l *Log) Append(recorded Recorded) error {
+	body, err := recorded.Marshal()
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.WriteString(journal.Frame(body)); err != nil {
+		return fmt.Errorf("error writing event log: %v", err)
+	}
+	l.seq = recorded.Seq
+	l.dirty = true
+
+	if l.policy == journal.SyncAlways {
+		if err := l.file.Sync(); err != nil {
+			return fmt.Errorf("error syncing event log: %v", err)
+		}
+		l.dirty = false
+	}
+	return nil
+}
+
+// syncEvery syncs what was written since the last sync every interval
+func (l *Log) syncEvery(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.sync()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// sync flushes the file if anything was written since the last sync
+func (l *Log) sync() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	return l.file.Sync()
+}
+
+// Close syncs and closes the log
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	if err := l.sync(); err != nil {
+		return fmt.Errorf("error syncing event log: %v", err)
+	}
+	return l.file.Close()
+}
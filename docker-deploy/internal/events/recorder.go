@@ -0,0 +1,232 @@
+package events
+
+import (
+	"StockOverflow/internal/database"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Handler is given every event the recorder publishes, in log order
+type Handler func(Recorded) error
+
+// Recorder is a Store that publishes the changes written through it as events.
+// Writes commit one at a time with their events, so the events are in the
+// order the changes were made. Reads go straight to the store.
+type Recorder struct {
+	database.Store
+	logger   *log.Logger
+	mutex    sync.Mutex // held from a commit until its events are published
+	seq      uint64
+	handlers []Handler
+}
+
+var _ database.Store = (*Recorder)(nil)
+
+// NewRecorder records the changes written to store
+func NewRecorder(store database.Store, logger *log.Logger) *Recorder {
+	return &Recorder{Store: store, logger: logger}
+}
+
+// Subscribe adds a handler for the events published from now on, numbered after seq
+func (r *Recorder) Subscribe(seq uint64, handler Handler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if seq > r.seq {
+		r.seq = seq
+	}
+	r.handlers = append(r.handlers, handler)
+}
+
+// Seq returns the number of the last event published
+func (r *Recorder) Seq() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.seq
+}
+
+// publish numbers events and hands them out, with the mutex held
+func (r *Recorder) publish(events []Event) {
+	now := time.Now().UnixNano()
+	for _, event := range events {
+		r.seq++
+		recorded := Recorded{Seq: r.seq, Time: now, Event: event}
+		for _, handler := range r.handlers {
+			if err := handler(recorded); err != nil {
+				r.logger.Printf("Failed to handle %s event %d: %v", event.Type(), recorded.Seq, err)
+			}
+		}
+	}
+}
+
+// WithTx runs fn in a transaction of the store and publishes its events once it commits
+func (r *Recorder) WithTx(fn func(tx database.Tx) error) error {
+	var recording *recordingTx
+	locked := false
+	err := r.Store.WithTx(func(tx database.Tx) error {
+		recording = &recordingTx{Tx: tx}
+		if err := fn(recording); err != nil {
+			return err
+		}
+		// the commit and its events go before any other's. Nothing waits on
+		// this transaction's locks while it commits, so holding the mutex is safe.
+		r.mutex.Lock()
+		locked = true
+		return nil
+	})
+	if locked {
+		if err == nil {
+			r.publish(recording.events)
+		}
+		r.mutex.Unlock()
+	}
+	return err
+}
+
+// Writes outside a transaction are made in one so they are ordered the same way
+
+func (r *Recorder) CreateAccount(id string, balance decimal.Decimal) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.CreateAccount(id, balance) })
+}
+
+func (r *Recorder) UpdateAccountBalance(id string, balance decimal.Decimal) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.UpdateAccountBalance(id, balance) })
+}
+
+func (r *Recorder) CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.CreateOrUpdatePosition(accountID, symbol, amount) })
+}
+
+func (r *Recorder) CreateOrder(order *database.Order) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.CreateOrder(order) })
+}
+
+func (r *Recorder) UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.UpdateOrderStatus(orderID, status, remaining, canceledTime) })
+}
+
+func (r *Recorder) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.UpdateOrderSlice(orderID, visible, priorityTime) })
+}
+
+func (r *Recorder) ActivateStopOrder(orderID string, orderType string) error {
+	return r.WithTx(func(tx database.Tx) error { return tx.ActivateStopOrder(orderID, orderType) })
+}
+
+// EnsureAccount has no transaction version, it is the same whenever it is folded
+func (r *Recorder) EnsureAccount(id string) error {
+	if err := r.Store.EnsureAccount(id); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.publish([]Event{&AccountEnsured{AccountID: id}})
+	return nil
+}
+
+// recordingTx keeps the events of the changes written in a transaction until it commits
+type recordingTx struct {
+	database.Tx
+	events []Event
+}
+
+func (t *recordingTx) CreateAccount(id string, balance decimal.Decimal) error {
+	if err := t.Tx.CreateAccount(id, balance); err != nil {
+		return err
+	}
+	t.events = append(t.events, &AccountCreated{AccountID: id, Balance: balance})
+	return nil
+}
+
+func (t *recordingTx) UpdateAccountBalance(id string, balance decimal.Decimal) error {
+	if err := t.Tx.UpdateAccountBalance(id, balance); err != nil {
+		return err
+	}
+	t.events = append(t.events, &BalanceChanged{AccountID: id, Balance: balance})
+	return nil
+}
+
+func (t *recordingTx) CreateOrUpdatePosition(accountID string, symbol string, amount decimal.Decimal) error {
+	if err := t.Tx.CreateOrUpdatePosition(accountID, symbol, amount); err != nil {
+		return err
+	}
+	t.events = append(t.events, &PositionChanged{AccountID: accountID, Symbol: symbol, Amount: amount})
+	return nil
+}
+
+func (t *recordingTx) CreateOrder(order *database.Order) error {
+	if err := t.Tx.CreateOrder(order); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderAccepted{Order: *order})
+	return nil
+}
+
+func (t *recordingTx) UpdateOrderStatus(orderID string, status string, remaining decimal.Decimal, canceledTime int64) error {
+	if err := t.Tx.UpdateOrderStatus(orderID, status, remaining, canceledTime); err != nil {
+		return err
+	}
+	if status == "canceled" || status == "expired" {
+		t.events = append(t.events, &OrderCanceled{OrderID: orderID, Status: status, Remaining: remaining, Time: canceledTime})
+	} else {
+		t.events = append(t.events, &OrderUpdated{OrderID: orderID, Status: status, Remaining: remaining})
+	}
+	return nil
+}
+
+func (t *recordingTx) AmendOrder(order *database.Order) error {
+	if err := t.Tx.AmendOrder(order); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderAmended{
+		OrderID:      order.ID,
+		Amount:       order.Amount,
+		Price:        order.Price,
+		Remaining:    order.Remaining,
+		Visible:      order.Visible,
+		PriorityTime: order.PriorityTime,
+	})
+	return nil
+}
+
+func (t *recordingTx) RepriceOrder(orderID string, price decimal.Decimal) error {
+	if err := t.Tx.RepriceOrder(orderID, price); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderRepriced{OrderID: orderID, Price: price})
+	return nil
+}
+
+func (t *recordingTx) DecrementOrder(orderID string, amount decimal.Decimal) error {
+	if err := t.Tx.DecrementOrder(orderID, amount); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderReduced{OrderID: orderID, Amount: amount})
+	return nil
+}
+
+func (t *recordingTx) UpdateOrderSlice(orderID string, visible decimal.Decimal, priorityTime int64) error {
+	if err := t.Tx.UpdateOrderSlice(orderID, visible, priorityTime); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderSliced{OrderID: orderID, Visible: visible, PriorityTime: priorityTime})
+	return nil
+}
+
+func (t *recordingTx) ActivateStopOrder(orderID string, orderType string) error {
+	if err := t.Tx.ActivateStopOrder(orderID, orderType); err != nil {
+		return err
+	}
+	t.events = append(t.events, &OrderActivated{OrderID: orderID, OrderType: orderType})
+	return nil
+}
+
+func (t *recordingTx) RecordTrade(trade *database.Trade) error {
+	if err := t.Tx.RecordTrade(trade); err != nil {
+		return err
+	}
+	t.events = append(t.events, &TradeExecuted{Trade: *trade})
+	return nil
+}
@@ -0,0 +1,275 @@
+package events
+
+import (
+	"StockOverflow/internal/database"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// State is the exchange's state folded from its events: balances, positions,
+// the book of open and pending orders, and the last trade price of each symbol
+type State struct {
+	mutex      sync.RWMutex
+	Seq        uint64                                // last event folded in
+	Accounts   map[string]decimal.Decimal            // balance by account
+	Positions  map[string]map[string]decimal.Decimal // shares by account and symbol
+	Orders     map[string]*database.Order            // open and pending orders by ID
+	LastPrices map[string]decimal.Decimal            // last trade price by symbol
+}
+
+// NewState creates the state of an exchange without events
+func NewState() *State {
+	return &State{
+		Accounts:   make(map[string]decimal.Decimal),
+		Positions:  make(map[string]map[string]decimal.Decimal),
+		Orders:     make(map[string]*database.Order),
+		LastPrices: make(map[string]decimal.Decimal),
+	}
+}
+
+// SeedState reads the state from a store, for an event log started on a store
+// that already has accounts. The events recorded from now on are folded onto it.
+func SeedState(store database.Store, seq uint64) (*State, error) {
+	st := NewState()
+	st.Seq = seq
+
+	accounts, err := store.GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		st.Accounts[account.ID] = account.Balance
+
+		positions, err := store.GetPositions(account.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, position := range positions {
+			st.setPosition(account.ID, position.Symbol, position.Amount)
+		}
+
+		orders, err := store.GetOpenOrdersByAccount(account.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range orders {
+			st.Orders[orders[i].ID] = &orders[i]
+		}
+	}
+	return st, nil
+}
+
+// Apply folds an event into the state. Events at or before the state's are
+// already in it and skipped, so a log can be replayed over a snapshot.
+func (st *State) Apply(recorded Recorded) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if recorded.Seq <= st.Seq {
+		return nil
+	}
+	st.Seq = recorded.Seq
+
+	switch event := recorded.Event.(type) {
+	case *AccountCreated:
+		st.Accounts[event.AccountID] = event.Balance
+	case *AccountEnsured:
+		if _, ok := st.Accounts[event.AccountID]; !ok {
+			st.Accounts[event.AccountID] = decimal.Zero
+		}
+	case *BalanceChanged:
+		st.Accounts[event.AccountID] = event.Balance
+	case *PositionChanged:
+		st.setPosition(event.AccountID, event.Symbol, event.Amount)
+	case *OrderAccepted:
+		if event.Order.Status == "open" || event.Order.Status == "pending" {
+			order := event.Order
+			st.Orders[order.ID] = &order
+		}
+	case *OrderUpdated:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Status, order.Remaining = event.Status, event.Remaining
+			if order.Status != "open" && order.Status != "pending" {
+				delete(st.Orders, event.OrderID)
+			}
+		}
+	case *OrderCanceled:
+		delete(st.Orders, event.OrderID)
+	case *OrderAmended:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Amount, order.Price, order.Remaining = event.Amount, event.Price, event.Remaining
+			order.Visible, order.PriorityTime = event.Visible, event.PriorityTime
+		}
+	case *OrderRepriced:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Price = event.Price
+		}
+	case *OrderReduced:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Remaining = order.Remaining.Sub(event.Amount)
+			order.Visible = decimal.Min(order.Visible, order.Remaining)
+		}
+	case *OrderSliced:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Visible, order.PriorityTime = event.Visible, event.PriorityTime
+		}
+	case *OrderActivated:
+		if order, ok := st.Orders[event.OrderID]; ok {
+			order.Status, order.OrderType = "open", event.OrderType
+		}
+	case *TradeExecuted:
+		st.LastPrices[event.Trade.Symbol] = event.Trade.Price
+	default:
+		return fmt.Errorf("cannot fold %s event %d", recorded.Event.Type(), recorded.Seq)
+	}
+	return nil
+}
+
+// setPosition sets the shares of a symbol an account holds
+func (st *State) setPosition(accountID string, symbol string, amount decimal.Decimal) {
+	if st.Positions[accountID] == nil {
+		st.Positions[accountID] = make(map[string]decimal.Decimal)
+	}
+	st.Positions[accountID][symbol] = amount
+}
+
+// Book aggregates one side of a symbol's open orders by price, best price first,
+// like the store's book levels
+func (st *State) Book(symbol string, isBuy bool) []database.BookLevel {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	levels := make(map[string]*database.BookLevel)
+	for _, order := range st.Orders {
+		if order.Symbol != symbol || order.Status != "open" || order.Amount.IsPositive() != isBuy {
+			continue
+		}
+		shown := order.Remaining
+		if order.Display.IsPositive() {
+			shown = order.Visible
+		}
+		level, ok := levels[order.Price.String()]
+		if !ok {
+			level = &database.BookLevel{Price: order.Price}
+			levels[order.Price.String()] = level
+		}
+		level.Shares = level.Shares.Add(shown)
+		level.Orders++
+	}
+
+	book := make([]database.BookLevel, 0, len(levels))
+	for _, level := range levels {
+		book = append(book, *level)
+	}
+	sort.Slice(book, func(i, j int) bool {
+		if isBuy {
+			return book[i].Price.GreaterThan(book[j].Price)
+		}
+		return book[i].Price.LessThan(book[j].Price)
+	})
+	return book
+}
+
+// Marshal encodes the state as a snapshot, taken as of its last event
+func (st *State) Marshal() ([]byte, uint64, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error encoding snapshot: %v", err)
+	}
+	return data, st.Seq, nil
+}
+
+// snapshotName is the file name of the snapshot as of event seq, they sort by seq
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("snapshot-%020d.json", seq)
+}
+
+// WriteSnapshot writes a snapshot to dir and removes the ones before it. The
+// file is written aside and renamed, a crash never leaves half a snapshot.
+func WriteSnapshot(dir string, seq uint64, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating snapshot directory: %v", err)
+	}
+
+	path := filepath.Join(dir, snapshotName(seq))
+	file, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("error syncing snapshot: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("error saving snapshot: %v", err)
+	}
+
+	names, err := snapshotNames(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name < snapshotName(seq) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return nil
+}
+
+// LoadSnapshot reads the latest snapshot in dir, an empty state if there is none
+func LoadSnapshot(dir string) (*State, bool, error) {
+	names, err := snapshotNames(dir)
+	if err != nil || len(names) == 0 {
+		return NewState(), false, err
+	}
+
+	name := names[len(names)-1]
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading snapshot %s: %v", name, err)
+	}
+	st := NewState()
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, false, fmt.Errorf("error decoding snapshot %s: %v", name, err)
+	}
+	return st, true, nil
+}
+
+// snapshotNames lists the snapshots in dir, oldest first
+func snapshotNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "snapshot-") && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,339 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AuctionResult is the outcome of a call auction, or what it would be if it uncrossed now
+type AuctionResult struct {
+	Symbol    string
+	Price     decimal.Decimal // equilibrium price, zero if the book does not cross
+	Volume    decimal.Decimal // shares that execute at the price
+	Imbalance decimal.Decimal // buy minus sell interest at the price, what is left unfilled
+}
+
+// StartAuction starts a call period for a symbol, from now on its orders
+// accumulate in the book without matching until Uncross
+func (e *Exchange) StartAuction(symbol string) error {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	stockNode.GetValue().SetAuction(true)
+	e.logger.Printf("Call auction started for %s", symbol)
+	return nil
+}
+
+// InAuction reports whether a symbol is in a call period
+func (e *Exchange) InAuction(symbol string) bool {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return false
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	return stockNode.GetValue().InAuction()
+}
+
+// IndicativeAuction returns the price, volume and imbalance the call auction
+// of a symbol would uncross at right now
+func (e *Exchange) IndicativeAuction(symbol string) (*AuctionResult, error) {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	if !stockNode.GetValue().InAuction() {
+		return nil, fmt.Errorf("%s is not in a call auction", symbol)
+	}
+
+	buys, sells, err := e.auctionBook(symbol)
+	if err != nil {
+		return nil, err
+	}
+	result := Equilibrium(buys, sells, stockNode.GetValue().GetLastPrice())
+	result.Symbol = symbol
+	return &result, nil
+}
+
+// Uncross ends the call period of a symbol. Every crossing order executes at the
+// single equilibrium price, the rest stays in the book for continuous trading.
+func (e *Exchange) Uncross(symbol string) (*AuctionResult, error) {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	node := stockNode.GetValue()
+	if !node.InAuction() {
+		return nil, fmt.Errorf("%s is not in a call auction", symbol)
+	}
+
+	buys, sells, err := e.auctionBook(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orders of one account or STP group never trade together, what self-trade
+	// prevention takes out changes the equilibrium so it is found again
+	result := Equilibrium(buys, sells, node.GetLastPrice())
+	for i, j := selfCross(buys, sells, result.Volume); i >= 0; i, j = selfCross(buys, sells, result.Volume) {
+		if err := e.preventAuctionSelfTrade(&buys[i], &sells[j]); err != nil {
+			return nil, fmt.Errorf("uncross of %s stopped by self-trade prevention: %v", symbol, err)
+		}
+		buys, sells = unfilled(buys), unfilled(sells)
+		result = Equilibrium(buys, sells, node.GetLastPrice())
+	}
+	result.Symbol = symbol
+
+	// Highest buys and lowest sells first, then by time priority,
+	// which is the order the book was loaded in
+	executed := decimal.Zero
+	timestamp := time.Now().UnixNano()
+	i, j := 0, 0
+	for executed.LessThan(result.Volume) && i < len(buys) && j < len(sells) {
+		buy, sell := &buys[i], &sells[j]
+		amount := decimal.Min(buy.Remaining, sell.Remaining, result.Volume.Sub(executed))
+
+		err := e.executeMatch(buy.ID, buy.AccountID, sell.ID, sell.AccountID,
+			symbol, amount, result.Price, buy.Price.Sub(result.Price), timestamp, "")
+		if err != nil {
+			e.logger.Printf("Error executing auction match: %v", err)
+			return nil, fmt.Errorf("uncross of %s stopped after %s shares: %v", symbol, executed.String(), err)
+		}
+
+		executed = executed.Add(amount)
+		buy.Remaining = buy.Remaining.Sub(amount)
+		sell.Remaining = sell.Remaining.Sub(amount)
+		if !buy.Remaining.IsPositive() {
+			i++
+		}
+		if !sell.Remaining.IsPositive() {
+			j++
+		}
+	}
+
+	node.SetAuction(false)
+	node.GetBuyers().Reload()
+	node.GetSellers().Reload()
+	if result.Volume.IsPositive() {
+		node.SetLastPrice(result.Price)
+		node.SetReferencePrice(result.Price)
+	}
+
+	e.logger.Printf("Uncrossed %s: %s shares at %s, imbalance %s",
+		symbol, result.Volume.String(), result.Price.String(), result.Imbalance.String())
+	e.triggerStops(stockNode)
+	return &result, nil
+}
+
+// selfCross returns the first buy and sell the uncross of volume would match
+// that belong to one account or STP group, -1 and -1 if there are none.
+// It pairs the orders the way Uncross does.
+func selfCross(buys, sells []database.Order, volume decimal.Decimal) (int, int) {
+	executed, buyFilled, sellFilled := decimal.Zero, decimal.Zero, decimal.Zero
+	i, j := 0, 0
+	for executed.LessThan(volume) && i < len(buys) && j < len(sells) {
+		if buys[i].SelfTrades(&sells[j]) {
+			return i, j
+		}
+		amount := decimal.Min(buys[i].Remaining.Sub(buyFilled), sells[j].Remaining.Sub(sellFilled), volume.Sub(executed))
+		executed = executed.Add(amount)
+		buyFilled, sellFilled = buyFilled.Add(amount), sellFilled.Add(amount)
+		if !buys[i].Remaining.Sub(buyFilled).IsPositive() {
+			i, buyFilled = i+1, decimal.Zero
+		}
+		if !sells[j].Remaining.Sub(sellFilled).IsPositive() {
+			j, sellFilled = j+1, decimal.Zero
+		}
+	}
+	return -1, -1
+}
+
+// preventAuctionSelfTrade applies self-trade prevention to a buy and a sell the
+// uncross would match. Neither of them arrived last, so the older one counts as
+// resting and its mode decides which side gives way. What is canceled or
+// decremented is taken off the orders' Remaining.
+// the caller must hold the stock node
+func (e *Exchange) preventAuctionSelfTrade(buy, sell *database.Order) error {
+	newer, older := buy, sell
+	if buy.Timestamp < sell.Timestamp {
+		newer, older = sell, buy
+	}
+	mode := older.STPMode
+	if mode == "" {
+		mode = database.STPCancelNewest
+	}
+	shares := decimal.Min(newer.Remaining, older.Remaining)
+	e.recordSTPEvent(newer, older, mode, shares)
+
+	var canceled, decremented []*database.Order
+	switch mode {
+	case database.STPCancelOldest:
+		canceled = append(canceled, older)
+	case database.STPCancelBoth:
+		canceled = append(canceled, newer, older)
+	case database.STPDecrement:
+		// The smaller order is canceled, the bigger one loses the same amount
+		switch {
+		case newer.Remaining.GreaterThan(older.Remaining):
+			canceled, decremented = append(canceled, older), append(decremented, newer)
+		case newer.Remaining.LessThan(older.Remaining):
+			canceled, decremented = append(canceled, newer), append(decremented, older)
+		default:
+			canceled = append(canceled, newer, older)
+		}
+	default:
+		canceled = append(canceled, newer)
+	}
+
+	for _, order := range decremented {
+		if err := e.decrementOrder(order, shares); err != nil {
+			return fmt.Errorf("failed to decrement order %s: %v", order.ID, err)
+		}
+		order.Remaining = order.Remaining.Sub(shares)
+	}
+	for _, order := range canceled {
+		if err := e.CancelOrder(order.ID); err != nil {
+			return fmt.Errorf("failed to cancel order %s: %v", order.ID, err)
+		}
+		order.Remaining = decimal.Zero
+	}
+	return nil
+}
+
+// unfilled drops the orders nothing is left of
+func unfilled(orders []database.Order) []database.Order {
+	kept := orders[:0]
+	for _, order := range orders {
+		if order.Remaining.IsPositive() {
+			kept = append(kept, order)
+		}
+	}
+	return kept
+}
+
+// auctionBook loads both sides of the book in priority order,
+// the heaps only hold the top of it
+func (e *Exchange) auctionBook(symbol string) ([]database.Order, []database.Order, error) {
+	buys, err := e.store.GetOpenOrdersBySymbolForHeap(symbol, "buyer", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	sells, err := e.store.GetOpenOrdersBySymbolForHeap(symbol, "seller", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// orders past their expire time wait for the scheduler, but never trade
+	now := time.Now().UnixNano()
+	live := func(orders []database.Order) []database.Order {
+		kept := orders[:0]
+		for _, order := range orders {
+			if !order.Expired(now) {
+				kept = append(kept, order)
+			}
+		}
+		return kept
+	}
+	return live(buys), live(sells), nil
+}
+
+// Equilibrium finds the price a call auction uncrosses at. Among the limit
+// prices in the book it picks, in this order:
+//  1. the price that executes the most shares
+//  2. the price that leaves the smallest imbalance
+//  3. the highest price if every candidate has surplus buyers,
+//     the lowest if every candidate has surplus sellers
+//  4. the price closest to the reference price, usually the last trade
+//  5. the lowest price
+//
+// Hidden iceberg quantity takes part in full.
+func Equilibrium(buys, sells []database.Order, reference decimal.Decimal) AuctionResult {
+	seen := make(map[string]bool)
+	var prices []decimal.Decimal
+	for _, side := range [][]database.Order{buys, sells} {
+		for _, order := range side {
+			if !seen[order.Price.String()] {
+				seen[order.Price.String()] = true
+				prices = append(prices, order.Price)
+			}
+		}
+	}
+	sort.Slice(prices, func(a, b int) bool { return prices[a].LessThan(prices[b]) })
+
+	// Rules 1 and 2, prices stay in ascending order
+	var candidates []AuctionResult
+	for _, price := range prices {
+		demand, supply := decimal.Zero, decimal.Zero
+		for _, buy := range buys {
+			if buy.Price.GreaterThanOrEqual(price) {
+				demand = demand.Add(buy.Remaining)
+			}
+		}
+		for _, sell := range sells {
+			if sell.Price.LessThanOrEqual(price) {
+				supply = supply.Add(sell.Remaining)
+			}
+		}
+
+		current := AuctionResult{Price: price, Volume: decimal.Min(demand, supply), Imbalance: demand.Sub(supply)}
+		if !current.Volume.IsPositive() {
+			continue
+		}
+		if len(candidates) > 0 {
+			best := candidates[0]
+			if current.Volume.LessThan(best.Volume) ||
+				(current.Volume.Equal(best.Volume) && current.Imbalance.Abs().GreaterThan(best.Imbalance.Abs())) {
+				continue
+			}
+			if current.Volume.GreaterThan(best.Volume) || current.Imbalance.Abs().LessThan(best.Imbalance.Abs()) {
+				candidates = candidates[:0]
+			}
+		}
+		candidates = append(candidates, current)
+	}
+
+	if len(candidates) == 0 {
+		return AuctionResult{Volume: decimal.Zero, Imbalance: decimal.Zero}
+	}
+
+	// Rule 3, market pressure
+	allBuyers, allSellers := true, true
+	for _, candidate := range candidates {
+		allBuyers = allBuyers && candidate.Imbalance.IsPositive()
+		allSellers = allSellers && candidate.Imbalance.IsNegative()
+	}
+	if allBuyers {
+		return candidates[len(candidates)-1]
+	}
+	if allSellers || !reference.IsPositive() {
+		return candidates[0]
+	}
+
+	// Rules 4 and 5, the first closest one is the lowest
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.Price.Sub(reference).Abs().LessThan(best.Price.Sub(reference).Abs()) {
+			best = candidate
+		}
+	}
+	return best
+}
@@ -0,0 +1,66 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BookSnapshot is the aggregated book of a symbol at one point in time
+type BookSnapshot struct {
+	Symbol string
+	Bids   []database.BookLevel // highest price first
+	Asks   []database.BookLevel // lowest price first
+}
+
+// BestBid returns the highest bid, false if there are no buyers
+func (b *BookSnapshot) BestBid() (decimal.Decimal, bool) {
+	if len(b.Bids) == 0 {
+		return decimal.Zero, false
+	}
+	return b.Bids[0].Price, true
+}
+
+// BestAsk returns the lowest ask, false if there are no sellers
+func (b *BookSnapshot) BestAsk() (decimal.Decimal, bool) {
+	if len(b.Asks) == 0 {
+		return decimal.Zero, false
+	}
+	return b.Asks[0].Price, true
+}
+
+// Spread returns the best ask minus the best bid, false if either side is empty
+func (b *BookSnapshot) Spread() (decimal.Decimal, bool) {
+	bid, hasBid := b.BestBid()
+	ask, hasAsk := b.BestAsk()
+	if !hasBid || !hasAsk {
+		return decimal.Zero, false
+	}
+	return ask.Sub(bid), true
+}
+
+// Book returns up to depth price levels of both sides of a symbol's book.
+// The heaps only hold a window of the orders, so the levels come from the
+// database, read under the symbol's lock so no match is half way through.
+func (e *Exchange) Book(symbol string, depth int) (*BookSnapshot, error) {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	now := time.Now().UnixNano()
+	bids, err := e.store.GetBookLevels(symbol, true, depth, now)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := e.store.GetBookLevels(symbol, false, depth, now)
+	if err != nil {
+		return nil, err
+	}
+	return &BookSnapshot{Symbol: symbol, Bids: bids, Asks: asks}, nil
+}
@@ -0,0 +1,129 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/pool"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// default halt length, the bands are off until SetPriceBands gives them a width
+const defaultHaltCooldown = 5 * time.Minute
+
+// SetPriceBands sets the static collar around the reference price, the volatility
+// band around the last trade and how long a breach halts the symbol.
+// A zero width turns that band off.
+func (e *Exchange) SetPriceBands(collar, band decimal.Decimal, cooldown time.Duration) {
+	e.priceCollar = collar
+	e.volatilityBand = band
+	e.haltCooldown = cooldown
+}
+
+// HaltedUntil returns when a halted symbol trades again, false if it is not halted
+func (e *Exchange) HaltedUntil(symbol string) (time.Time, bool) {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	node := stockNode.GetValue()
+	if !node.Halted(time.Now().UnixNano()) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, node.GetHaltedUntil()), true
+}
+
+// PriceBand returns the lowest and highest price within width, a fraction, of reference
+func PriceBand(reference, width decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	offset := reference.Mul(width)
+	return reference.Sub(offset), reference.Add(offset)
+}
+
+// breach is a trade price outside of one of the bands of a symbol
+type breach struct {
+	kind      string
+	reference decimal.Decimal
+	lower     decimal.Decimal
+	upper     decimal.Decimal
+}
+
+// outsideBands checks a trade price against the collar around reference and the
+// volatility band around last. It returns the band breached, false if none is.
+func (e *Exchange) outsideBands(reference, last, price decimal.Decimal) (breach, bool) {
+	bands := []struct {
+		kind      string
+		reference decimal.Decimal
+		width     decimal.Decimal
+	}{
+		{database.BreakerCollar, reference, e.priceCollar},
+		{database.BreakerBand, last, e.volatilityBand},
+	}
+	for _, band := range bands {
+		// no reference yet means nothing to compare against
+		if !band.width.IsPositive() || !band.reference.IsPositive() {
+			continue
+		}
+		lower, upper := PriceBand(band.reference, band.width)
+		if price.GreaterThanOrEqual(lower) && price.LessThanOrEqual(upper) {
+			continue
+		}
+		return breach{kind: band.kind, reference: band.reference, lower: lower, upper: upper}, true
+	}
+	return breach{}, false
+}
+
+// tripBreaker checks a trade price against the bands of its symbol. Outside of
+// them the symbol halts, the event is recorded and true is returned, the trade
+// must not happen. The caller must hold the stock node.
+func (e *Exchange) tripBreaker(stockNode *pool.LruNode[*pool.StockNode], order *database.Order, price decimal.Decimal) bool {
+	node := stockNode.GetValue()
+	band, breached := e.outsideBands(node.GetReferencePrice(), node.GetLastPrice(), price)
+	if !breached {
+		return false
+	}
+
+	now := time.Now()
+	haltedUntil := now.Add(e.haltCooldown).UnixNano()
+	node.SetHaltedUntil(haltedUntil)
+
+	e.logger.Printf("Circuit breaker: %s of %s at %s outside %s band [%s, %s], halted for %v",
+		order.ID, order.Symbol, price.String(), band.kind, band.lower.String(), band.upper.String(), e.haltCooldown)
+	err := e.store.RecordBreakerEvent(&database.BreakerEvent{
+		Symbol:      order.Symbol,
+		Kind:        band.kind,
+		OrderID:     order.ID,
+		Price:       price,
+		Reference:   band.reference,
+		Lower:       band.lower,
+		Upper:       band.upper,
+		HaltedUntil: haltedUntil,
+		Timestamp:   now.UnixNano(),
+	})
+	if err != nil {
+		e.logger.Printf("Error recording breaker event: %v", err)
+	}
+	return true
+}
+
+// setLastPrice records the price of a trade. The first trade of a symbol
+// without a reference price sets it, the collar applies from then on.
+func setLastPrice(node *pool.StockNode, price decimal.Decimal) {
+	node.SetLastPrice(price)
+	if !node.GetReferencePrice().IsPositive() {
+		node.SetReferencePrice(price)
+	}
+}
+
+// loadHalt restores a halt of a new stock node that is still running
+func (e *Exchange) loadHalt(symbol string, node *pool.StockNode) {
+	haltedUntil, err := e.store.GetHaltedUntil(symbol, time.Now().UnixNano())
+	if err != nil {
+		e.logger.Printf("Warning: Failed to load halt of %s: %v", symbol, err)
+		return
+	}
+	node.SetHaltedUntil(haltedUntil)
+}
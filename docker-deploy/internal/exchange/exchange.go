@@ -2,8 +2,8 @@ package exchange
 
 import (
 	"StockOverflow/internal/database"
+	"StockOverflow/internal/events"
 	"StockOverflow/internal/pool"
-	"database/sql"
 	"fmt"
 	"log"
 	"time"
@@ -11,97 +11,441 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// defaultMarketProtection is how far above the best ask a market buy may trade
+var defaultMarketProtection = decimal.NewFromFloat(0.05)
+
 // Exchange represents the core matching engine
 type Exchange struct {
-	db        *sql.DB
+	store     database.Store
+	events    *events.Recorder // the store, publishing every change as an event
 	stockPool *pool.StockPool
 	logger    *log.Logger
+
+	// market buys are reserved and capped at best ask * (1 + marketProtection)
+	marketProtection decimal.Decimal
+
+	// circuit breakers, trades outside the bands halt the symbol for haltCooldown
+	priceCollar    decimal.Decimal
+	volatilityBand decimal.Decimal
+	haltCooldown   time.Duration
+
+	// default fees in basis points, the house account collects them
+	makerFee     decimal.Decimal
+	takerFee     decimal.Decimal
+	houseAccount string
 }
 
-// NewExchange creates a new exchange instance
-func NewExchange(db *sql.DB, stockPool *pool.StockPool, logger *log.Logger) *Exchange {
+// NewExchange creates a new exchange instance on a store. Everything it writes
+// goes through a recorder, so its state can be rebuilt from its events. The
+// events are its writes as they commit, not decisions made ahead of them: a
+// trade is a TradeExecuted with the order, balance and position changes it
+// committed with, and balances are recorded as they end up, not as deltas.
+func NewExchange(store database.Store, stockPool *pool.StockPool, logger *log.Logger) *Exchange {
+	recorder := events.NewRecorder(store, logger)
 	return &Exchange{
-		db:        db,
-		stockPool: stockPool,
-		logger:    logger,
+		store:            recorder,
+		events:           recorder,
+		stockPool:        stockPool,
+		logger:           logger,
+		marketProtection: defaultMarketProtection,
+		haltCooldown:     defaultHaltCooldown,
 	}
 }
 
-// PlaceOrder places a new order in the exchange
+// Store returns the store of the exchange, writes to it are published as events
+func (e *Exchange) Store() database.Store {
+	return e.store
+}
+
+// Events returns the recorder the exchange's events are published by
+func (e *Exchange) Events() *events.Recorder {
+	return e.events
+}
+
+// SetMarketProtection sets the fraction above the best ask a market buy may pay
+func (e *Exchange) SetMarketProtection(protection decimal.Decimal) {
+	e.marketProtection = protection
+}
+
+// ProtectionPrice returns the highest price a market buy may pay when the
+// market is at reference
+func (e *Exchange) ProtectionPrice(reference decimal.Decimal) decimal.Decimal {
+	return reference.Mul(decimal.NewFromInt(1).Add(e.marketProtection)).Round(2)
+}
+
+// MarketProtectionPrice returns the price a market buy on symbol is reserved at.
+// The order sweeps the sellers up to this price and cancels whatever is left.
+func (e *Exchange) MarketProtectionPrice(symbol string) (decimal.Decimal, error) {
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	bestSell, ok := e.bestOpposite(stockNode, true)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("no liquidity for market order on %s", symbol)
+	}
+
+	return e.ProtectionPrice(bestSell), nil
+}
+
+// PlaceOrder places a new limit order in the exchange
 func (e *Exchange) PlaceOrder(orderID, accountID, symbol string, amount, price decimal.Decimal) error {
-	// Create order in database
-	now := time.Now().UnixNano()
-	order := &database.Order{
+	return e.SubmitOrder(&database.Order{
 		ID:        orderID,
 		AccountID: accountID,
 		Symbol:    symbol,
 		Amount:    amount,
 		Price:     price,
-		Status:    "open",
-		Remaining: amount.Abs(),
-		Timestamp: now,
+		OrderType: database.OrderTypeLimit,
+	})
+}
+
+// SubmitOrder records a new order of any type and time in force and runs it
+// through matching, or parks it until triggered if it is a stop order.
+// Funds or shares must already be reserved for it, a buy's fees at its FeeBps.
+func (e *Exchange) SubmitOrder(order *database.Order) error {
+	isStop := order.OrderType == database.OrderTypeStop || order.OrderType == database.OrderTypeStopLimit
+
+	// Create order in database
+	order.Status = "open"
+	if isStop {
+		order.Status = "pending"
+	}
+	order.Remaining = order.Amount.Abs()
+	order.Timestamp = time.Now().UnixNano()
+	order.PriorityTime = order.Timestamp
+	if order.IsIceberg() {
+		order.Visible = decimal.Min(order.Display, order.Remaining)
+	}
+	if order.OrderType == "" {
+		order.OrderType = database.OrderTypeLimit
+	}
+	if order.STPMode == "" {
+		// fall back to the account's default, then to cancel newest
+		mode, err := e.store.GetAccountSTPMode(order.AccountID)
+		if err != nil {
+			e.logger.Printf("Warning: Failed to load stp mode of account %s: %v", order.AccountID, err)
+		}
+		order.STPMode = mode
+		if order.STPMode == "" {
+			order.STPMode = database.STPCancelNewest
+		}
+	}
+	if order.TimeInForce == "" {
+		// market orders can never rest, so they default to immediate or cancel
+		if order.OrderType == database.OrderTypeMarket || order.OrderType == database.OrderTypeStop {
+			order.TimeInForce = database.TimeInForceIOC
+		} else {
+			order.TimeInForce = database.TimeInForceGTC
+		}
 	}
 
-	err := database.CreateOrder(e.db, order)
+	err := e.store.CreateOrder(order)
 	if err != nil {
 		return fmt.Errorf("failed to create order in database: %v", err)
 	}
 
+	if isStop {
+		e.addStopOrder(order)
+		return nil
+	}
+	if order.PostOnly != "" {
+		return e.submitPostOnly(order)
+	}
+
 	// Call matching logic
-	e.MatchOrder(orderID, accountID, symbol, amount.IsPositive(), price, amount.Abs())
+	e.matchOrder(order)
 	return nil
 }
 
-// MatchOrder handles the matching of an order with existing orders
+// MatchOrder handles the matching of a limit order with existing orders
 func (e *Exchange) MatchOrder(orderID string, accountID string, symbol string, isBuy bool, price decimal.Decimal, amount decimal.Decimal) {
-	// Try to get the stock node for this symbol
-	stockNode, err := e.stockPool.Get(symbol)
+	signedAmount := amount
+	if !isBuy {
+		signedAmount = amount.Neg()
+	}
+
+	e.matchOrder(&database.Order{
+		ID:          orderID,
+		AccountID:   accountID,
+		Symbol:      symbol,
+		Amount:      signedAmount,
+		Remaining:   amount,
+		Price:       price,
+		OrderType:   database.OrderTypeLimit,
+		TimeInForce: database.TimeInForceGTC,
+	})
+}
+
+// matchOrder matches an order against the book, then lets its trades trigger stops
+func (e *Exchange) matchOrder(order *database.Order) {
+	stockNode, err := e.getStockNode(order.Symbol)
 	if err != nil {
-		// Symbol doesn't exist in pool, create a new node
-		stockNode = pool.NewStockNode(symbol, 1000)
+		e.logger.Printf("Warning: Failed to add stock node to pool: %v", err)
+		return
+	}
+
+	// Lock the stock node for matching
+	stockNode.Lock()
+	defer stockNode.Unlock()
 
-		buyers := stockNode.GetValue().GetBuyers()
-		buyers.SetDB(e.db)
-		buyers.CheckMin()
-		sellers := stockNode.GetValue().GetSellers()
-		sellers.SetDB(e.db)
-		sellers.CheckMin()
+	e.matchLocked(stockNode, order)
+	e.triggerStops(stockNode)
+}
+
+// matchLocked matches an order against the book and deals with what is left of it
+// the caller must hold the stock node
+func (e *Exchange) matchLocked(stockNode *pool.LruNode[*pool.StockNode], order *database.Order) {
+	isBuy := order.Amount.IsPositive()
 
-		err = e.stockPool.Put(stockNode)
+	// During a call auction or a halt orders only accumulate
+	if stockNode.GetValue().InAuction() || stockNode.GetValue().Halted(time.Now().UnixNano()) {
+		if order.OrderType == database.OrderTypeMarket || !database.TimeInForceRests(order.TimeInForce) {
+			e.cancelRemainder(order, order.Remaining)
+		} else if isBuy {
+			e.addRemainingBuyOrder(stockNode, order, order.Remaining)
+		} else {
+			e.addRemainingSellOrder(stockNode, order, order.Remaining)
+		}
+		return
+	}
+
+	// Fill or kill orders only trade when matching would fill the whole amount right now.
+	// We hold the stock node, so nothing can change the book between check and match.
+	if order.TimeInForce == database.TimeInForceFOK {
+		crossing, err := e.store.GetCrossingOrders(order.Symbol, isBuy, order.Price, time.Now().UnixNano())
 		if err != nil {
-			e.logger.Printf("Warning: Failed to add stock node to pool: %v", err)
+			e.logger.Printf("Error checking liquidity: %v", err)
+		}
+		if err != nil || e.fillable(stockNode.GetValue(), order, crossing).LessThan(order.Remaining) {
+			e.cancelRemainder(order, order.Remaining)
 			return
 		}
 	}
 
-	// Lock the stock node for matching
+	// Price-time matches straight off the heaps, other policies a level at a time
+	policy, err := Policy(stockNode.GetValue().GetMatching())
+	if err != nil {
+		e.logger.Printf("Warning: %v, using price-time", err)
+		policy = PriceTime{}
+	}
+
+	_, priceTime := policy.(PriceTime)
+	var remainingAmount decimal.Decimal
+	switch {
+	case !priceTime:
+		remainingAmount = e.matchLevels(stockNode, order, policy)
+	case isBuy:
+		remainingAmount = e.matchBuyOrder(stockNode, order)
+	default:
+		remainingAmount = e.matchSellOrder(stockNode, order)
+	}
+
+	if remainingAmount.LessThanOrEqual(decimal.Zero) {
+		return
+	}
+
+	// The order tripped a circuit breaker, what is left of it never trades
+	if stockNode.GetValue().Halted(time.Now().UnixNano()) {
+		e.cancelRemainder(order, remainingAmount)
+		return
+	}
+
+	// Only GTC, GTD and DAY orders rest in the book, cancel what could not be filled
+	if order.OrderType == database.OrderTypeMarket || !database.TimeInForceRests(order.TimeInForce) {
+		e.cancelRemainder(order, remainingAmount)
+		return
+	}
+
+	if isBuy {
+		e.addRemainingBuyOrder(stockNode, order, remainingAmount)
+	} else {
+		e.addRemainingSellOrder(stockNode, order, remainingAmount)
+	}
+}
+
+// fillable returns how much of an order matching would fill against crossing, the
+// opposite side of the book in priority order. Like matching it stops where
+// self-trade prevention would end the order and where a trade would trip a
+// circuit breaker, so a fill or kill order that passes never falls short.
+func (e *Exchange) fillable(node *pool.StockNode, order *database.Order, crossing []database.Order) decimal.Decimal {
+	filled := decimal.Zero
+	reference, last := node.GetReferencePrice(), node.GetLastPrice()
+	for i := range crossing {
+		resting := &crossing[i]
+		if filled.GreaterThanOrEqual(order.Remaining) {
+			break
+		}
+		if order.SelfTrades(resting) {
+			// cancel oldest takes the resting order out, every other mode ends the order
+			if order.STPMode == database.STPCancelOldest {
+				continue
+			}
+			break
+		}
+		if _, breached := e.outsideBands(reference, last, resting.Price); breached {
+			break
+		}
+
+		filled = filled.Add(resting.Remaining)
+		last = resting.Price
+		if !reference.IsPositive() {
+			reference = resting.Price
+		}
+	}
+	return decimal.Min(filled, order.Remaining)
+}
+
+// addStopOrder parks a stop order in the trigger book of its symbol,
+// triggering it right away if the last trade price already reached it
+func (e *Exchange) addStopOrder(order *database.Order) {
+	stockNode, err := e.getStockNode(order.Symbol)
+	if err != nil {
+		e.logger.Printf("Warning: Failed to add stock node to pool: %v", err)
+		return
+	}
+
 	stockNode.Lock()
 	defer stockNode.Unlock()
 
-	if isBuy {
-		e.matchBuyOrder(stockNode, orderID, accountID, symbol, price, amount)
+	stop := pool.NewOrder(order.ID, order.Remaining, order.StopPrice, time.Unix(0, order.Timestamp))
+	stockNode.GetValue().GetStops().Add(stop, order.Amount.IsPositive())
+	e.triggerStops(stockNode)
+}
+
+// triggerStops injects the stop orders the last trade price has reached into matching.
+// Their own trades move the price again, so keep going until nothing triggers.
+// the caller must hold the stock node
+func (e *Exchange) triggerStops(stockNode *pool.LruNode[*pool.StockNode]) {
+	node := stockNode.GetValue()
+	for {
+		// stops stay dormant during a halt
+		lastPrice := node.GetLastPrice()
+		if lastPrice.IsZero() || node.Halted(time.Now().UnixNano()) {
+			return
+		}
+
+		stop, ok := node.GetStops().PopTriggered(lastPrice)
+		if !ok {
+			return
+		}
+
+		// Stops canceled while dormant are only removed from the database
+		order, err := e.store.GetOrder(stop.GetID())
+		if err != nil || order.Status != "pending" {
+			continue
+		}
+		if order.Expired(time.Now().UnixNano()) {
+			e.expireResting(order)
+			continue
+		}
+
+		// A stop becomes a market order, a stop limit becomes a limit order
+		orderType := database.OrderTypeMarket
+		if order.OrderType == database.OrderTypeStopLimit {
+			orderType = database.OrderTypeLimit
+		}
+		err = e.store.ActivateStopOrder(order.ID, orderType)
+		if err != nil {
+			e.logger.Printf("Error activating stop order: %v", err)
+			continue
+		}
+		order.OrderType = orderType
+		order.Status = "open"
+
+		e.logger.Printf("Stop order %s triggered at %s (stop %s)",
+			order.ID, lastPrice.String(), order.StopPrice.String())
+		e.matchLocked(stockNode, order)
+	}
+}
+
+// cancelRemainder cancels the unfilled part of an order that may not rest in the book
+func (e *Exchange) cancelRemainder(order *database.Order, remainingAmount decimal.Decimal) {
+	e.logger.Printf("Canceling unfilled %s of %s %s order %s",
+		remainingAmount.String(), order.TimeInForce, order.OrderType, order.ID)
+	if err := e.CancelOrder(order.ID); err != nil {
+		e.logger.Printf("Error canceling order remainder: %v", err)
+	}
+}
+
+// getStockNode gets the trading room of a symbol, creating it if needed
+func (e *Exchange) getStockNode(symbol string) (*pool.LruNode[*pool.StockNode], error) {
+	// Try to get the stock node for this symbol
+	stockNode, err := e.stockPool.Get(symbol)
+	if err == nil {
+		return stockNode, nil
+	}
+
+	// Symbol doesn't exist in pool, create a new node
+	stockNode = pool.NewStockNode(symbol, 1000)
+
+	buyers := stockNode.GetValue().GetBuyers()
+	buyers.SetStore(e.store)
+	buyers.CheckMin()
+	sellers := stockNode.GetValue().GetSellers()
+	sellers.SetStore(e.store)
+	sellers.CheckMin()
+
+	// Bring back dormant stops, the last trade price and a running halt
+	e.loadStops(symbol, stockNode.GetValue())
+	e.loadHalt(symbol, stockNode.GetValue())
+	e.loadMatching(symbol, stockNode.GetValue())
+
+	err = e.stockPool.Put(stockNode)
+	if err != nil {
+		// Another connection may have created it in the meantime
+		if existing, getErr := e.stockPool.Get(symbol); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return stockNode, nil
+}
+
+// loadStops restores the trigger book and last trade price of a new stock node
+func (e *Exchange) loadStops(symbol string, node *pool.StockNode) {
+	lastPrice, err := e.store.GetLastTradePrice(symbol)
+	if err != nil {
+		e.logger.Printf("Warning: Failed to load last trade price of %s: %v", symbol, err)
 	} else {
-		e.matchSellOrder(stockNode, orderID, accountID, symbol, price, amount)
+		node.SetLastPrice(lastPrice)
+		node.SetReferencePrice(lastPrice)
+	}
+
+	stops, err := e.store.GetPendingStopsBySymbol(symbol)
+	if err != nil {
+		e.logger.Printf("Warning: Failed to load stop orders of %s: %v", symbol, err)
+		return
+	}
+	for _, order := range stops {
+		stop := pool.NewOrder(order.ID, order.Remaining, order.StopPrice, time.Unix(0, order.Timestamp))
+		node.GetStops().Add(stop, order.Amount.IsPositive())
 	}
 }
 
 // matchBuyOrder handles matching a buy order with existing sell orders
-func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], orderID string, accountID string, symbol string, price decimal.Decimal, amount decimal.Decimal) {
+// and returns the amount left unfilled
+func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order *database.Order) decimal.Decimal {
+	orderID, accountID, symbol := order.ID, order.AccountID, order.Symbol
+	price, amount := order.Price, order.Remaining
+
 	// This is a buy order, try to match with sell orders
 	sellersHeap := stockNode.GetValue().GetSellers()
 
-	// If sellers heap is empty, just add to buyers heap and return
+	// If sellers heap is empty, nothing to match against
 	if sellersHeap.Len() == 0 {
-		e.addRemainingBuyOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	// Check if we can match with the best sell order
 	sellOrderData, err := sellersHeap.SafePop()
 	if err != nil {
 		e.logger.Printf("Error popping from sellers heap: %v", err)
-		e.addRemainingBuyOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	sellOrderInfo := sellOrderData.(pool.Order)
@@ -113,11 +457,10 @@ func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order
 		sellOrderPtr := &sellOrderInfo
 		sellersHeap.SafePush(sellOrderPtr)
 
-		// Add our buy order to the buyers heap without attempting to match
+		// Leave our buy order unmatched
 		e.logger.Printf("No match possible: best sell price %s > buy price %s",
 			sellPrice.String(), price.String()+" For Order ID: "+orderID)
-		e.addRemainingBuyOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	// Put the sell order back for the matching process
@@ -149,7 +492,7 @@ func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order
 
 		// Get the sell order from the database
 		sellOrderID := sellOrderInfo.GetID()
-		sellOrder, err := database.GetOrder(e.db, sellOrderID)
+		sellOrder, err := e.store.GetOrder(sellOrderID)
 
 		if err != nil || sellOrder.Status != "open" {
 			// Skip this order and continue
@@ -157,6 +500,22 @@ func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order
 			continue
 		}
 
+		// Orders past their expire time never trade, even before the scheduler gets to them
+		if sellOrder.Expired(time.Now().UnixNano()) {
+			e.expireResting(sellOrder)
+			continue
+		}
+
+		// Never trade against our own orders
+		if order.SelfTrades(sellOrder) {
+			var stop bool
+			remainingAmount, stop = e.preventSelfTrade(sellersHeap.OrderHeap, order, sellOrderInfo, sellOrder, remainingAmount)
+			if stop {
+				break
+			}
+			continue
+		}
+
 		// Determine the execution price (price of the earlier order)
 		var executionPrice decimal.Decimal
 
@@ -172,79 +531,89 @@ func (e *Exchange) matchBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order
 			refundPrice = decimal.Zero
 		}
 
-		// Determine execution amount
+		// Trades outside the price bands halt the symbol instead
+		if e.tripBreaker(stockNode, order, executionPrice) {
+			sellersHeap.SafePush(&sellOrderInfo)
+			break
+		}
+
+		// Determine execution amount, icebergs only trade their shown slice
 		var executionAmount decimal.Decimal
-		if remainingAmount.LessThanOrEqual(sellOrder.Remaining) {
+		shown := sellOrder.Shown()
+		if remainingAmount.LessThanOrEqual(shown) {
 			executionAmount = remainingAmount
 		} else {
-			executionAmount = sellOrder.Remaining
+			executionAmount = shown
 		}
 
-		if remainingAmount.LessThan(sellOrder.Remaining) {
-			newSellRemaining := sellOrder.Remaining.Sub(executionAmount)
-			// Update the sell order info for the heap
-			sellOrderInfo.SetAmount(uint(newSellRemaining.IntPart()))
-			// Push the updated sell order back to the heap
-			sellOrderPtr := &sellOrderInfo
-			sellersHeap.SafePush(sellOrderPtr)
+		executionTime := time.Now()
+		if executionAmount.LessThan(sellOrder.Remaining) {
+			// Push the rest of the sell order back to the heap
+			sellersHeap.SafePush(restingAfterFill(sellOrderInfo, sellOrder, executionAmount, executionTime))
 		}
 
 		// Execute the match
 		err = e.executeMatch(
 			orderID, accountID, sellOrderID, sellOrder.AccountID,
-			symbol, executionAmount, executionPrice, refundPrice, time.Now().UnixNano(),
+			symbol, executionAmount, executionPrice, refundPrice, executionTime.UnixNano(), orderID,
 		)
 
 		if err != nil {
 			e.logger.Printf("Error executing match: %v", err)
 			continue
 		}
+		setLastPrice(stockNode.GetValue(), executionPrice)
 
 		// Update remaining amount
 		remainingAmount = remainingAmount.Sub(executionAmount)
 	}
 
-	// If order still has remaining amount, add to buyers heap
-	if remainingAmount.GreaterThan(decimal.Zero) {
-		e.addRemainingBuyOrder(stockNode, orderID, price, remainingAmount)
-	}
+	return remainingAmount
 }
 
 // Helper function to add a buy order with remaining amount to the buyers heap
-func (e *Exchange) addRemainingBuyOrder(stockNode *pool.LruNode[*pool.StockNode], orderID string, price decimal.Decimal, remainingAmount decimal.Decimal) {
+func (e *Exchange) addRemainingBuyOrder(stockNode *pool.LruNode[*pool.StockNode], order *database.Order, remainingAmount decimal.Decimal) {
 	// Update remaining amount in database
-	err := database.UpdateOrderStatus(e.db, orderID, "open", remainingAmount, 0)
+	err := e.store.UpdateOrderStatus(order.ID, "open", remainingAmount, 0)
 	if err != nil {
 		e.logger.Printf("Error updating order status: %v", err)
 	}
 
+	// An iceberg starts resting with a fresh slice
+	shown := e.restingSlice(order, remainingAmount)
+
 	// Add to buyers heap
 	buyerOrder := pool.NewOrder(
-		orderID,
-		uint(remainingAmount.IntPart()),
-		price,
+		order.ID,
+		shown,
+		order.Price,
 		time.Now(),
 	)
+	// a heap created for this order loaded it from the store already, that entry
+	// would keep its old priority
+	stockNode.GetValue().GetBuyers().Remove(order.ID)
 	stockNode.GetValue().GetBuyers().SafePush(buyerOrder)
 }
 
 // matchSellOrder handles matching a sell order with existing buy orders
-func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], orderID string, accountID string, symbol string, price decimal.Decimal, amount decimal.Decimal) {
+// and returns the amount left unfilled
+func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], order *database.Order) decimal.Decimal {
+	orderID, accountID, symbol := order.ID, order.AccountID, order.Symbol
+	price, amount := order.Price, order.Remaining
+
 	// This is a sell order, try to match with buy orders
 	buyersHeap := stockNode.GetValue().GetBuyers()
 
-	// If buyers heap is empty, just add to sellers heap and return
+	// If buyers heap is empty, nothing to match against
 	if buyersHeap.Len() == 0 {
-		e.addRemainingSellOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	// Check if we can match with the best buy order
 	buyOrderData, err := buyersHeap.SafePop()
 	if err != nil {
 		e.logger.Printf("Error popping from buyers heap: %v", err)
-		e.addRemainingSellOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	buyOrderInfo := buyOrderData.(pool.Order)
@@ -256,11 +625,10 @@ func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], orde
 		buyOrderPtr := &buyOrderInfo
 		buyersHeap.SafePush(buyOrderPtr)
 
-		// Add our sell order to the sellers heap without attempting to match
+		// Leave our sell order unmatched
 		e.logger.Printf("No match possible: best buy price %s < sell price %s",
 			buyPrice.String(), price.String())
-		e.addRemainingSellOrder(stockNode, orderID, price, amount)
-		return
+		return amount
 	}
 
 	// Put the buy order back for the matching process
@@ -292,7 +660,7 @@ func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], orde
 
 		// Get the buy order from the database
 		buyOrderID := buyOrderInfo.GetID()
-		buyOrder, err := database.GetOrder(e.db, buyOrderID)
+		buyOrder, err := e.store.GetOrder(buyOrderID)
 
 		if err != nil || buyOrder.Status != "open" {
 			// Skip this order and continue
@@ -300,6 +668,22 @@ func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], orde
 			continue
 		}
 
+		// Orders past their expire time never trade, even before the scheduler gets to them
+		if buyOrder.Expired(time.Now().UnixNano()) {
+			e.expireResting(buyOrder)
+			continue
+		}
+
+		// Never trade against our own orders
+		if order.SelfTrades(buyOrder) {
+			var stop bool
+			remainingAmount, stop = e.preventSelfTrade(buyersHeap.OrderHeap, order, buyOrderInfo, buyOrder, remainingAmount)
+			if stop {
+				break
+			}
+			continue
+		}
+
 		// Determine the execution price (price of the earlier order)
 		var executionPrice decimal.Decimal
 
@@ -315,273 +699,410 @@ func (e *Exchange) matchSellOrder(stockNode *pool.LruNode[*pool.StockNode], orde
 		} else {
 			refundPrice = decimal.Zero
 		}
-		// Determine execution amount
+
+		// Trades outside the price bands halt the symbol instead
+		if e.tripBreaker(stockNode, order, executionPrice) {
+			buyersHeap.SafePush(&buyOrderInfo)
+			break
+		}
+
+		// Determine execution amount, icebergs only trade their shown slice
 		var executionAmount decimal.Decimal
-		if remainingAmount.LessThanOrEqual(buyOrder.Remaining) {
+		shown := buyOrder.Shown()
+		if remainingAmount.LessThanOrEqual(shown) {
 			executionAmount = remainingAmount
 		} else {
-			executionAmount = buyOrder.Remaining
+			executionAmount = shown
 		}
 
-		if remainingAmount.LessThan(buyOrder.Remaining) {
-			newBuyRemaining := buyOrder.Remaining.Sub(executionAmount)
-			// Update the buy order info for the heap
-			buyOrderInfo.SetAmount(uint(newBuyRemaining.IntPart()))
-			// Push the updated buy order back to the heap
-			buyOrderPtr := &buyOrderInfo
-			buyersHeap.SafePush(buyOrderPtr)
+		executionTime := time.Now()
+		if executionAmount.LessThan(buyOrder.Remaining) {
+			// Push the rest of the buy order back to the heap
+			buyersHeap.SafePush(restingAfterFill(buyOrderInfo, buyOrder, executionAmount, executionTime))
 		}
 
 		// Execute the match
 		err = e.executeMatch(
 			buyOrderID, buyOrder.AccountID, orderID, accountID,
-			symbol, executionAmount, executionPrice, refundPrice, time.Now().UnixNano(),
+			symbol, executionAmount, executionPrice, refundPrice, executionTime.UnixNano(), orderID,
 		)
 
 		if err != nil {
 			e.logger.Printf("Error executing match: %v", err)
 			continue
 		}
+		setLastPrice(stockNode.GetValue(), executionPrice)
 
 		// Update remaining amount
 		remainingAmount = remainingAmount.Sub(executionAmount)
 	}
 
-	// If order still has remaining amount, add to sellers heap
-	if remainingAmount.GreaterThan(decimal.Zero) {
-		e.addRemainingSellOrder(stockNode, orderID, price, remainingAmount)
-	}
+	return remainingAmount
 }
 
 // Helper function to add a sell order with remaining amount to the sellers heap
-func (e *Exchange) addRemainingSellOrder(stockNode *pool.LruNode[*pool.StockNode], orderID string, price decimal.Decimal, remainingAmount decimal.Decimal) {
+func (e *Exchange) addRemainingSellOrder(stockNode *pool.LruNode[*pool.StockNode], order *database.Order, remainingAmount decimal.Decimal) {
 	// Update remaining amount in database
-	err := database.UpdateOrderStatus(e.db, orderID, "open", remainingAmount, 0)
+	err := e.store.UpdateOrderStatus(order.ID, "open", remainingAmount, 0)
 	if err != nil {
 		e.logger.Printf("Error updating order status: %v", err)
 	}
 
+	// An iceberg starts resting with a fresh slice
+	shown := e.restingSlice(order, remainingAmount)
+
 	// Add to sellers heap
 	sellerOrder := pool.NewOrder(
-		orderID,
-		uint(remainingAmount.IntPart()),
-		price,
+		order.ID,
+		shown,
+		order.Price,
 		time.Now(),
 	)
+	// a heap created for this order loaded it from the store already, that entry
+	// would keep its old priority
+	stockNode.GetValue().GetSellers().Remove(order.ID)
 	stockNode.GetValue().GetSellers().SafePush(sellerOrder)
 }
 
-// executeMatch executes a trade between a buy order and a sell order
+// restingSlice returns what an order resting with remainingAmount shows in the book,
+// recording a fresh slice for icebergs
+func (e *Exchange) restingSlice(order *database.Order, remainingAmount decimal.Decimal) decimal.Decimal {
+	if !order.IsIceberg() {
+		return remainingAmount
+	}
+
+	visible := decimal.Min(order.Display, remainingAmount)
+	err := e.store.UpdateOrderSlice(order.ID, visible, time.Now().UnixNano())
+	if err != nil {
+		e.logger.Printf("Error updating iceberg slice: %v", err)
+	}
+	return visible
+}
+
+// sliceAfterFill returns what an order shows after trading amount and whether
+// its iceberg slice ran out and was replenished from the hidden reserve
+func sliceAfterFill(order *database.Order, amount decimal.Decimal) (decimal.Decimal, bool) {
+	remaining := order.Remaining.Sub(amount)
+	if !order.IsIceberg() {
+		return remaining, false
+	}
+
+	visible := order.Visible.Sub(amount)
+	if visible.IsPositive() || !remaining.IsPositive() {
+		return visible, false
+	}
+	return decimal.Min(order.Display, remaining), true
+}
+
+// restingAfterFill returns the heap entry of a resting order after it traded amount.
+// A replenished iceberg slice loses its time priority, like on real venues.
+func restingAfterFill(info pool.Order, order *database.Order, amount decimal.Decimal, executionTime time.Time) *pool.Order {
+	shown, replenished := sliceAfterFill(order, amount)
+	if replenished {
+		return pool.NewOrder(info.GetID(), shown, info.GetPrice(), executionTime)
+	}
+
+	info.SetAmount(shown)
+	return &info
+}
+
+// fillOrder updates the remaining amount, status and iceberg slice of an order
+// that traded amount within a transaction
+func fillOrder(txFuncs database.Tx, order *database.Order, amount decimal.Decimal, timestamp int64) error {
+	newRemaining := order.Remaining.Sub(amount)
+	status := "open"
+	if newRemaining.IsZero() {
+		status = "executed"
+	}
+	err := txFuncs.UpdateOrderStatus(order.ID, status, newRemaining, 0)
+	if err != nil {
+		return err
+	}
+
+	if !order.IsIceberg() {
+		return nil
+	}
+	visible, replenished := sliceAfterFill(order, amount)
+	priorityTime := order.PriorityTime
+	if replenished {
+		priorityTime = timestamp
+	}
+	return txFuncs.UpdateOrderSlice(order.ID, visible, priorityTime)
+}
+
+// executeMatch executes a trade between a buy order and a sell order.
+// takerOrderID is the order that took liquidity, empty if both were makers like in an auction.
 func (e *Exchange) executeMatch(buyOrderID, buyerAccountID, sellOrderID, sellerAccountID,
-	symbol string, amount, executionPrice decimal.Decimal, refundPrice decimal.Decimal, timestamp int64) error {
+	symbol string, amount, executionPrice decimal.Decimal, refundPrice decimal.Decimal, timestamp int64, takerOrderID string) error {
 	// Execute the match within a transaction to ensure atomicity
-	return database.ExecuteWithTransaction(e.db, func(tx *sql.Tx) error {
-		txFuncs := &database.CommonTxFunctions{Tx: tx}
+	return e.store.WithTx(func(txFuncs database.Tx) error {
 
 		// 1. Get current orders
-		buyOrder, err := database.GetOrder(e.db, buyOrderID)
+		buyOrder, err := e.store.GetOrder(buyOrderID)
 		if err != nil {
 			return fmt.Errorf("failed to get buy order: %v", err)
 		}
 
-		sellOrder, err := database.GetOrder(e.db, sellOrderID)
+		sellOrder, err := e.store.GetOrder(sellOrderID)
 		if err != nil {
 			return fmt.Errorf("failed to get sell order: %v", err)
 		}
 
-		// 2. Record execution for both orders
-		err = txFuncs.RecordExecution(buyOrderID, amount, executionPrice, timestamp)
+		// 2. Record the trade, then the execution and fee of both orders
+		aggressor := ""
+		switch takerOrderID {
+		case buyOrderID:
+			aggressor = database.AggressorBuy
+		case sellOrderID:
+			aggressor = database.AggressorSell
+		}
+		trade := &database.Trade{
+			Symbol:      symbol,
+			BuyOrderID:  buyOrderID,
+			SellOrderID: sellOrderID,
+			BuyAccount:  buyerAccountID,
+			SellAccount: sellerAccountID,
+			Price:       executionPrice,
+			Shares:      amount,
+			Aggressor:   aggressor,
+			Timestamp:   timestamp,
+		}
+		err = txFuncs.RecordTrade(trade)
+		if err != nil {
+			return fmt.Errorf("failed to record trade: %v", err)
+		}
+
+		buyFee, buyLiquidity, err := e.executionFee(buyerAccountID, symbol, takerOrderID == buyOrderID, amount, executionPrice)
+		if err != nil {
+			return fmt.Errorf("failed to get buyer fee: %v", err)
+		}
+		// the buyer never pays more fee than it reserved, e.g. after its rates went up
+		feeReserved := reservedFee(buyOrder, amount)
+		if buyFee.GreaterThan(feeReserved) {
+			buyFee = feeReserved
+		}
+
+		sellFee, sellLiquidity, err := e.executionFee(sellerAccountID, symbol, takerOrderID == sellOrderID, amount, executionPrice)
+		if err != nil {
+			return fmt.Errorf("failed to get seller fee: %v", err)
+		}
+
+		// rebates are paid out of the house account, what it cannot pay is taken off them.
+		// Tiers can pair a taker fee with a bigger maker rebate.
+		if houseFee := buyFee.Add(sellFee); houseFee.IsNegative() {
+			houseBalance := decimal.Zero
+			if e.houseAccount != "" {
+				houseBalance, err = txFuncs.GetBalanceForUpdate(e.houseAccount)
+				if err != nil {
+					return fmt.Errorf("failed to get house account: %v", err)
+				}
+			}
+			short := houseBalance.Add(houseFee)
+			for _, fee := range []*decimal.Decimal{&sellFee, &buyFee} {
+				if short.IsNegative() && fee.IsNegative() {
+					cut := decimal.Max(short, *fee)
+					*fee = fee.Sub(cut)
+					short = short.Sub(cut)
+				}
+			}
+		}
+
+		err = txFuncs.RecordExecution(&database.Execution{OrderID: buyOrderID, Shares: amount, Price: executionPrice,
+			Fee: buyFee, Liquidity: buyLiquidity, TradeID: trade.ID, Timestamp: timestamp})
 		if err != nil {
 			return fmt.Errorf("failed to record buy execution: %v", err)
 		}
 
-		err = txFuncs.RecordExecution(sellOrderID, amount, executionPrice, timestamp)
+		err = txFuncs.RecordExecution(&database.Execution{OrderID: sellOrderID, Shares: amount, Price: executionPrice,
+			Fee: sellFee, Liquidity: sellLiquidity, TradeID: trade.ID, Timestamp: timestamp})
 		if err != nil {
 			return fmt.Errorf("failed to record sell execution: %v", err)
 		}
 
 		// 3. Update remaining amounts for both orders
-		newBuyRemaining := buyOrder.Remaining.Sub(amount)
-		buyStatus := "open"
-		if newBuyRemaining.IsZero() {
-			buyStatus = "executed"
-		}
-		err = txFuncs.UpdateOrderStatus(buyOrderID, buyStatus, newBuyRemaining, 0)
+		err = fillOrder(txFuncs, buyOrder, amount, timestamp)
 		if err != nil {
 			return fmt.Errorf("failed to update buy order status: %v", err)
 		}
 
-		newSellRemaining := sellOrder.Remaining.Sub(amount)
-		sellStatus := "open"
-		if newSellRemaining.IsZero() {
-			sellStatus = "executed"
-		}
-		err = txFuncs.UpdateOrderStatus(sellOrderID, sellStatus, newSellRemaining, 0)
+		err = fillOrder(txFuncs, sellOrder, amount, timestamp)
 		if err != nil {
 			return fmt.Errorf("failed to update sell order status: %v", err)
 		}
 
-		// 4. Process refund for buyer if applicable
-		if refundPrice.GreaterThan(decimal.Zero) {
-			refundAmount := amount.Mul(refundPrice)
-
-			// Get buyer account
-			buyerAccount, err := database.GetAccount(e.db, buyerAccountID)
+		// 4. Process refund for buyer if applicable, what was reserved for the fee less the fee
+		refundAmount := amount.Mul(refundPrice).Add(feeReserved).Sub(buyFee)
+		if !refundAmount.IsZero() {
+			// Get buyer balance, through the transaction in case buyer and seller are the same
+			buyerBalance, err := txFuncs.GetBalanceForUpdate(buyerAccountID)
 			if err != nil {
 				return fmt.Errorf("failed to get buyer account: %v", err)
 			}
 
 			// Update buyer's balance with refund
-			newBuyerBalance := buyerAccount.Balance.Add(refundAmount)
+			newBuyerBalance := buyerBalance.Add(refundAmount)
 			err = txFuncs.UpdateAccountBalance(buyerAccountID, newBuyerBalance)
 			if err != nil {
 				return fmt.Errorf("failed to update buyer balance with refund: %v", err)
 			}
 
-			e.logger.Printf("Buyer %s gets refund: %s for order %s",
-				buyerAccountID, refundAmount.String(), buyOrderID)
+			e.logger.Printf("Buyer %s gets refund: %s for order %s after fee %s",
+				buyerAccountID, refundAmount.String(), buyOrderID, buyFee.String())
 		}
 
 		// 5. Update seller's balance
-		sellerAccount, err := database.GetAccount(e.db, sellerAccountID)
+		sellerBalance, err := txFuncs.GetBalanceForUpdate(sellerAccountID)
 		if err != nil {
 			return fmt.Errorf("failed to get seller account: %v", err)
 		}
 
-		// Calculate trade amount based on execution price
-		tradeAmount := amount.Mul(executionPrice)
-		newSellerBalance := sellerAccount.Balance.Add(tradeAmount)
+		// Calculate trade amount based on execution price, less the seller's fee
+		tradeAmount := amount.Mul(executionPrice).Sub(sellFee)
+		newSellerBalance := sellerBalance.Add(tradeAmount)
 		err = txFuncs.UpdateAccountBalance(sellerAccountID, newSellerBalance)
 		if err != nil {
 			return fmt.Errorf("failed to update seller balance: %v", err)
 		}
 
-		// 6. Update buyer's position
-		buyerPositions, err := database.GetPositions(e.db, buyerAccountID)
-		if err != nil {
-			return fmt.Errorf("failed to get buyer positions: %v", err)
-		}
-
-		// Find the position for this symbol
-		var currentBuyerPosition *database.Position
-		for i := range buyerPositions {
-			if buyerPositions[i].Symbol == symbol {
-				currentBuyerPosition = &buyerPositions[i]
-				break
+		// 6. Fees go to the house
+		if houseFee := buyFee.Add(sellFee); !houseFee.IsZero() && e.houseAccount != "" {
+			houseBalance, err := txFuncs.GetBalanceForUpdate(e.houseAccount)
+			if err != nil {
+				return fmt.Errorf("failed to get house account: %v", err)
+			}
+			err = txFuncs.UpdateAccountBalance(e.houseAccount, houseBalance.Add(houseFee))
+			if err != nil {
+				return fmt.Errorf("failed to update house balance: %v", err)
 			}
 		}
 
-		// Update or create buyer's position
-		if currentBuyerPosition == nil {
-			// Create new position
-			err = txFuncs.CreateOrUpdatePosition(buyerAccountID, symbol, amount)
-		} else {
-			// Update existing position
-			newAmount := currentBuyerPosition.Amount.Add(amount)
-			err = txFuncs.CreateOrUpdatePosition(buyerAccountID, symbol, newAmount)
+		// 7. Update buyer's position
+		buyerPosition, err := txFuncs.GetPositionForUpdate(buyerAccountID, symbol)
+		if err != nil {
+			return fmt.Errorf("failed to get buyer positions: %v", err)
 		}
 
+		// Update or create buyer's position
+		err = txFuncs.CreateOrUpdatePosition(buyerAccountID, symbol, buyerPosition.Add(amount))
 		if err != nil {
 			return fmt.Errorf("failed to update buyer position: %v", err)
 		}
 
 		// Log successful execution
-		e.logger.Printf("Executed match: %s bought %s %s from %s at %s",
-			buyerAccountID, amount.String(), symbol, sellerAccountID, executionPrice.String())
+		e.logger.Printf("Executed trade %d: %s bought %s %s from %s at %s",
+			trade.ID, buyerAccountID, amount.String(), symbol, sellerAccountID, executionPrice.String())
 
 		return nil
 	})
 }
 
-// CancelOrder cancels an open order
+// CancelOrder cancels an open or pending order and releases its reservation
 func (e *Exchange) CancelOrder(orderID string) error {
+	return e.closeOrder(orderID, "canceled")
+}
+
+// ExpireOrder expires an order whose expire time has passed the same way it
+// would be canceled, and takes it out of the book right away
+func (e *Exchange) ExpireOrder(orderID string) error {
+	order, err := e.store.GetOrder(orderID)
+	if err != nil {
+		return fmt.Errorf("failed to find order: %v", err)
+	}
+
+	stockNode, err := e.getStockNode(order.Symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	err = e.closeOrder(orderID, "expired")
+	if err != nil {
+		return err
+	}
+
+	// Dormant stops are dropped lazily when they trigger
+	if order.Amount.IsPositive() {
+		stockNode.GetValue().GetBuyers().Remove(orderID)
+	} else {
+		stockNode.GetValue().GetSellers().Remove(orderID)
+	}
+	return nil
+}
+
+// expireResting expires an order matching found past its expire time,
+// it has already been taken out of the book
+func (e *Exchange) expireResting(order *database.Order) {
+	e.logger.Printf("Order %s expired before it could trade", order.ID)
+	if err := e.closeOrder(order.ID, "expired"); err != nil {
+		e.logger.Printf("Error expiring order: %v", err)
+	}
+}
+
+// closeOrder ends an open or pending order with status "canceled" or "expired",
+// keeping what was left of it and releasing its reservation
+func (e *Exchange) closeOrder(orderID string, status string) error {
 	// Get order from database
-	order, err := database.GetOrder(e.db, orderID)
+	order, err := e.store.GetOrder(orderID)
 	if err != nil {
 		return fmt.Errorf("failed to find order: %v", err)
 	}
 
-	// Check if order is already completed or canceled
-	if order.Status != "open" {
+	// Check if order is already completed or canceled, dormant stops can be canceled too
+	if order.Status != "open" && order.Status != "pending" {
 		return fmt.Errorf("order is not open")
 	}
 
 	// Get the current timestamp
 	now := time.Now().UnixNano()
 
-	// Return funds or shares based on order type
-	isBuy := order.Amount.IsPositive()
-
-	return database.ExecuteWithTransaction(e.db, func(tx *sql.Tx) error {
-		txFuncs := &database.CommonTxFunctions{Tx: tx}
+	return e.store.WithTx(func(txFuncs database.Tx) error {
 
 		// Update order status
-		err := txFuncs.UpdateOrderStatus(orderID, "canceled", order.Remaining, now)
+		err := txFuncs.UpdateOrderStatus(orderID, status, order.Remaining, now)
 		if err != nil {
 			return fmt.Errorf("failed to update order status: %v", err)
 		}
 
 		// Return funds or shares
-		if isBuy {
-			// Get latest account from DB to ensure accurate balance
-			dbAccount, err := database.GetAccount(e.db, order.AccountID)
-			if err != nil {
-				return fmt.Errorf("failed to get account: %v", err)
-			}
-
-			// Calculate refund amount
-			refundAmount := order.Remaining.Mul(order.Price)
-			newBalance := dbAccount.Balance.Add(refundAmount)
-
-			// Update account balance
-			err = txFuncs.UpdateAccountBalance(order.AccountID, newBalance)
-			if err != nil {
-				return fmt.Errorf("failed to update account balance: %v", err)
-			}
-		} else {
-			// Get the position
-			positions, err := database.GetPositions(e.db, order.AccountID)
-			if err != nil {
-				return fmt.Errorf("failed to get positions: %v", err)
-			}
-
-			// Find the position for this symbol
-			var currentPosition *database.Position
-			for i := range positions {
-				if positions[i].Symbol == order.Symbol {
-					currentPosition = &positions[i]
-					break
-				}
-			}
-
-			if currentPosition == nil {
-				// Create new position
-				err = txFuncs.CreateOrUpdatePosition(order.AccountID, order.Symbol, order.Remaining)
-			} else {
-				// Update existing position
-				newAmount := currentPosition.Amount.Add(order.Remaining)
-				err = txFuncs.CreateOrUpdatePosition(order.AccountID, order.Symbol, newAmount)
-			}
-
-			if err != nil {
-				return fmt.Errorf("failed to update position: %v", err)
-			}
+		err = releaseReservation(txFuncs, order, order.Remaining)
+		if err != nil {
+			return fmt.Errorf("failed to release reservation: %v", err)
 		}
 
 		return nil
 	})
 }
 
+// releaseReservation gives back what was reserved for amount of an order,
+// funds at its limit price and their fee for a buy and shares for a sell
+func releaseReservation(txFuncs database.Tx, order *database.Order, amount decimal.Decimal) error {
+	if order.Amount.IsPositive() {
+		balance, err := txFuncs.GetBalanceForUpdate(order.AccountID)
+		if err != nil {
+			return err
+		}
+		return txFuncs.UpdateAccountBalance(order.AccountID, balance.Add(amount.Mul(order.Price)).Add(reservedFee(order, amount)))
+	}
+
+	position, err := txFuncs.GetPositionForUpdate(order.AccountID, order.Symbol)
+	if err != nil {
+		return err
+	}
+	return txFuncs.CreateOrUpdatePosition(order.AccountID, order.Symbol, position.Add(amount))
+}
+
 // GetOrderStatus returns the current status of an order
 func (e *Exchange) GetOrderStatus(orderID string) (*database.Order, []database.Execution, error) {
 	// Get order from database
-	order, err := database.GetOrder(e.db, orderID)
+	order, err := e.store.GetOrder(orderID)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Get executions for this order
-	executions, err := database.GetOrderExecutions(e.db, orderID)
+	executions, err := e.store.GetOrderExecutions(orderID)
 	if err != nil {
 		// Return the order with empty executions
 		return order, []database.Execution{}, nil
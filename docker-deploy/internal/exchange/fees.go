@@ -0,0 +1,90 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// basisPoint is a hundredth of a percent
+var basisPoint = decimal.New(1, -4)
+
+// SetFees sets the default maker and taker fees in basis points and the house
+// account fee revenue accrues to, creating it if needed
+func (e *Exchange) SetFees(makerBps, takerBps decimal.Decimal, house string) error {
+	if err := e.store.EnsureAccount(house); err != nil {
+		return fmt.Errorf("failed to create house account: %v", err)
+	}
+	e.makerFee = makerBps
+	e.takerFee = takerBps
+	e.houseAccount = house
+	return nil
+}
+
+// FeeRates returns the maker and taker fees of an account trading a symbol, in
+// basis points. A symbol override beats the account's tier, which beats the defaults.
+func (e *Exchange) FeeRates(accountID, symbol string) (decimal.Decimal, decimal.Decimal, error) {
+	maker, taker := e.makerFee, e.takerFee
+
+	tier, err := e.store.GetAccountFeeTier(accountID)
+	if err != nil {
+		return maker, taker, err
+	}
+	if tier != nil {
+		maker, taker = tier.MakerBps, tier.TakerBps
+	}
+
+	rules, err := e.store.GetSymbol(symbol)
+	if err != nil {
+		return maker, taker, err
+	}
+	if rules.MakerFee.Valid {
+		maker = rules.MakerFee.Decimal
+	}
+	if rules.TakerFee.Valid {
+		taker = rules.TakerFee.Decimal
+	}
+	return maker, taker, nil
+}
+
+// Fee returns the fee on trading amount at price at a rate in basis points,
+// rounded half away from zero to the 6 decimal places balances are kept in
+func Fee(amount, price, bps decimal.Decimal) decimal.Decimal {
+	return amount.Mul(price).Mul(bps).Mul(basisPoint).Round(6)
+}
+
+// BuyFeeRate returns the rate in basis points a buy order reserves its fees at,
+// the higher of the account's maker and taker fee and never a rebate
+func (e *Exchange) BuyFeeRate(accountID, symbol string) (decimal.Decimal, error) {
+	maker, taker, err := e.FeeRates(accountID, symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.Max(maker, taker, decimal.Zero), nil
+}
+
+// BuyReservation returns the funds reserved for buying amount at price,
+// the fees at a rate in basis points included
+func BuyReservation(amount, price, bps decimal.Decimal) decimal.Decimal {
+	return amount.Mul(price).Add(Fee(amount, price, bps))
+}
+
+// reservedFee returns the part of a buy order's reservation that is for the fees
+// of amount of its remaining. It is what the reservation shrinks by, so releasing
+// the whole order piece by piece gives back exactly what was reserved.
+func reservedFee(order *database.Order, amount decimal.Decimal) decimal.Decimal {
+	return Fee(order.Remaining, order.Price, order.FeeBps).Sub(Fee(order.Remaining.Sub(amount), order.Price, order.FeeBps))
+}
+
+// executionFee returns the fee and liquidity flag of one side of an execution
+func (e *Exchange) executionFee(accountID, symbol string, taker bool, amount, price decimal.Decimal) (decimal.Decimal, string, error) {
+	makerBps, takerBps, err := e.FeeRates(accountID, symbol)
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	if taker {
+		return Fee(amount, price, takerBps), database.LiquidityTaker, nil
+	}
+	return Fee(amount, price, makerBps), database.LiquidityMaker, nil
+}
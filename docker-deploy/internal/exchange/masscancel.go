@@ -0,0 +1,152 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MassCancelResult is what a mass cancel did to one order
+type MassCancelResult struct {
+	OrderID  string
+	Symbol   string
+	Canceled decimal.Decimal // what was left of the order, zero if it was not canceled
+	Err      error           // why the order was not canceled
+}
+
+// MassCancel cancels every open or pending order of an account, narrowed to a
+// symbol and a side ("buy" or "sell") when they are not empty. The orders of a
+// symbol are canceled in one transaction with one refund. skip returns why the
+// orders of a symbol must stay, or nil to cancel them.
+func (e *Exchange) MassCancel(accountID, symbol, side string, skip func(symbol string) error) ([]MassCancelResult, error) {
+	orders, err := e.store.GetOpenOrdersByAccount(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orders: %v", err)
+	}
+
+	bySymbol := make(map[string][]database.Order)
+	var symbols []string
+	for _, order := range orders {
+		if symbol != "" && order.Symbol != symbol {
+			continue
+		}
+		if (side == "buy" && !order.Amount.IsPositive()) || (side == "sell" && order.Amount.IsPositive()) {
+			continue
+		}
+		if _, ok := bySymbol[order.Symbol]; !ok {
+			symbols = append(symbols, order.Symbol)
+		}
+		bySymbol[order.Symbol] = append(bySymbol[order.Symbol], order)
+	}
+	sort.Strings(symbols)
+
+	var results []MassCancelResult
+	for _, sym := range symbols {
+		if skip != nil {
+			if err := skip(sym); err != nil {
+				for _, order := range bySymbol[sym] {
+					results = append(results, MassCancelResult{OrderID: order.ID, Symbol: sym, Err: err})
+				}
+				continue
+			}
+		}
+		results = append(results, e.cancelSymbolOrders(sym, bySymbol[sym])...)
+	}
+
+	e.logger.Printf("Mass cancel for account %s touched %d orders", accountID, len(results))
+	return results, nil
+}
+
+// cancelSymbolOrders cancels orders of one symbol and account under the symbol's lock,
+// then takes them out of the book
+func (e *Exchange) cancelSymbolOrders(symbol string, orders []database.Order) []MassCancelResult {
+	results := make([]MassCancelResult, len(orders))
+	for i, order := range orders {
+		results[i] = MassCancelResult{OrderID: order.ID, Symbol: symbol}
+	}
+	failAll := func(err error) []MassCancelResult {
+		for i := range results {
+			results[i].Canceled = decimal.Zero
+			results[i].Err = err
+		}
+		return results
+	}
+
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return failAll(fmt.Errorf("failed to get stock node: %v", err))
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	now := time.Now().UnixNano()
+	accountID := orders[0].AccountID
+
+	err = e.store.WithTx(func(txFuncs database.Tx) error {
+
+		// Buys get their funds back and sells their shares, summed up for one refund each
+		funds, shares := decimal.Zero, decimal.Zero
+		for i := range orders {
+			order, err := txFuncs.GetOrderForUpdate(orders[i].ID)
+			if err != nil {
+				return err
+			}
+			if order.Status != "open" && order.Status != "pending" {
+				results[i].Err = fmt.Errorf("order is not open")
+				continue
+			}
+
+			err = txFuncs.UpdateOrderStatus(order.ID, "canceled", order.Remaining, now)
+			if err != nil {
+				return fmt.Errorf("failed to update order status: %v", err)
+			}
+			if order.Amount.IsPositive() {
+				funds = funds.Add(BuyReservation(order.Remaining, order.Price, order.FeeBps))
+			} else {
+				shares = shares.Add(order.Remaining)
+			}
+			results[i].Canceled = order.Remaining
+		}
+
+		if funds.IsPositive() {
+			balance, err := txFuncs.GetBalanceForUpdate(accountID)
+			if err != nil {
+				return fmt.Errorf("failed to release reservation: %v", err)
+			}
+			if err := txFuncs.UpdateAccountBalance(accountID, balance.Add(funds)); err != nil {
+				return fmt.Errorf("failed to release reservation: %v", err)
+			}
+		}
+		if shares.IsPositive() {
+			position, err := txFuncs.GetPositionForUpdate(accountID, symbol)
+			if err != nil {
+				return fmt.Errorf("failed to release reservation: %v", err)
+			}
+			if err := txFuncs.CreateOrUpdatePosition(accountID, symbol, position.Add(shares)); err != nil {
+				return fmt.Errorf("failed to release reservation: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		e.logger.Printf("Error mass canceling %s orders of account %s: %v", symbol, accountID, err)
+		return failAll(err)
+	}
+
+	// Dormant stops are dropped lazily when they trigger
+	for i, order := range orders {
+		if results[i].Err != nil {
+			continue
+		}
+		if order.Amount.IsPositive() {
+			stockNode.GetValue().GetBuyers().Remove(order.ID)
+		} else {
+			stockNode.GetValue().GetSellers().Remove(order.ID)
+		}
+	}
+	return results
+}
@@ -0,0 +1,233 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/pool"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MatchingPolicy decides how an incoming order is shared between the orders
+// resting at one price level. sizes are what each resting order shows, in
+// time priority, and the result holds what each of them trades. Allocations
+// are whole lots unless a resting order is smaller than one.
+type MatchingPolicy interface {
+	Allocate(quantity decimal.Decimal, sizes []decimal.Decimal, lot decimal.Decimal) []decimal.Decimal
+}
+
+// PriceTime fills the oldest order first
+type PriceTime struct{}
+
+// ProRata shares the quantity in proportion to order size. Every order gets its
+// share rounded down to whole lots, the lots left over go one at a time to the
+// orders in time priority, so the same book always gives the same allocation.
+type ProRata struct{}
+
+// TopOrder fills the oldest order at the level first and shares the rest pro-rata
+type TopOrder struct{}
+
+// Policy returns the matching policy called name
+func Policy(name string) (MatchingPolicy, error) {
+	switch name {
+	case "", database.MatchingPriceTime:
+		return PriceTime{}, nil
+	case database.MatchingProRata:
+		return ProRata{}, nil
+	case database.MatchingTopOrder:
+		return TopOrder{}, nil
+	}
+	return nil, fmt.Errorf("unknown matching policy: %s", name)
+}
+
+// Allocate fills the sizes in order until the quantity runs out
+func (PriceTime) Allocate(quantity decimal.Decimal, sizes []decimal.Decimal, lot decimal.Decimal) []decimal.Decimal {
+	allocations := make([]decimal.Decimal, len(sizes))
+	for i, size := range sizes {
+		allocations[i] = decimal.Min(quantity, size)
+		quantity = quantity.Sub(allocations[i])
+	}
+	return allocations
+}
+
+// Allocate shares the quantity in proportion to the sizes
+func (ProRata) Allocate(quantity decimal.Decimal, sizes []decimal.Decimal, lot decimal.Decimal) []decimal.Decimal {
+	allocations := make([]decimal.Decimal, len(sizes))
+	total := decimal.Zero
+	for _, size := range sizes {
+		total = total.Add(size)
+	}
+	if quantity.GreaterThanOrEqual(total) {
+		copy(allocations, sizes)
+		return allocations
+	}
+
+	// whole lots of quantity * size / total, the quotient is exact
+	left := quantity
+	for i, size := range sizes {
+		lots, _ := quantity.Mul(size).QuoRem(total.Mul(lot), 0)
+		allocations[i] = decimal.Min(lots.Mul(lot), size)
+		left = left.Sub(allocations[i])
+	}
+
+	// what rounding left over goes out a lot at a time in time priority
+	for left.IsPositive() {
+		progress := false
+		for i, size := range sizes {
+			extra := decimal.Min(lot, size.Sub(allocations[i]), left)
+			if !extra.IsPositive() {
+				continue
+			}
+			allocations[i] = allocations[i].Add(extra)
+			left = left.Sub(extra)
+			progress = true
+			if !left.IsPositive() {
+				break
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return allocations
+}
+
+// Allocate fills the top order and shares the rest pro-rata
+func (TopOrder) Allocate(quantity decimal.Decimal, sizes []decimal.Decimal, lot decimal.Decimal) []decimal.Decimal {
+	if len(sizes) == 0 {
+		return nil
+	}
+	top := decimal.Min(quantity, sizes[0])
+	rest := ProRata{}.Allocate(quantity.Sub(top), sizes[1:], lot)
+	return append([]decimal.Decimal{top}, rest...)
+}
+
+// SetMatchingPolicy changes the matching policy of a symbol
+func (e *Exchange) SetMatchingPolicy(symbol string, name string) error {
+	if _, err := Policy(name); err != nil {
+		return err
+	}
+	stockNode, err := e.getStockNode(symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	stockNode.GetValue().SetMatching(name)
+	return nil
+}
+
+// loadMatching restores the matching policy of a new stock node
+func (e *Exchange) loadMatching(symbol string, node *pool.StockNode) {
+	rules, err := e.store.GetSymbol(symbol)
+	if err != nil {
+		e.logger.Printf("Warning: Failed to load matching policy of %s: %v", symbol, err)
+		return
+	}
+	node.SetMatching(rules.Matching)
+}
+
+// matchLevels matches an order one price level at a time, sharing every level
+// between its orders the way policy says. Fills land anywhere in a level, not
+// only on top of the heap, so the book side is reloaded afterwards.
+// It returns what is left of the order.
+// the caller must hold the stock node
+func (e *Exchange) matchLevels(stockNode *pool.LruNode[*pool.StockNode], order *database.Order, policy MatchingPolicy) decimal.Decimal {
+	isBuy := order.Amount.IsPositive()
+	bookSide := stockNode.GetValue().GetBuyers().OrderHeap
+	if isBuy {
+		bookSide = stockNode.GetValue().GetSellers().OrderHeap
+	}
+	defer bookSide.Reload()
+
+	lot := database.DefaultLotSize
+	if rules, err := e.store.GetSymbol(order.Symbol); err == nil {
+		lot = rules.LotSize
+	}
+
+	remaining := order.Remaining
+	for remaining.IsPositive() {
+		price, ok := e.bestOpposite(stockNode, isBuy)
+		if !ok || (isBuy && price.GreaterThan(order.Price)) || (!isBuy && price.LessThan(order.Price)) {
+			break
+		}
+
+		level, err := e.store.GetOpenOrdersAtPrice(order.Symbol, !isBuy, price)
+		if err != nil {
+			e.logger.Printf("Error loading price level: %v", err)
+			break
+		}
+
+		// Leave out what must not trade, the same way the price-time loops do
+		var eligible []*database.Order
+		stop := false
+		for i := range level {
+			resting := &level[i]
+			if resting.Expired(time.Now().UnixNano()) {
+				e.expireResting(resting)
+				continue
+			}
+			if order.SelfTrades(resting) {
+				info := pool.NewOrder(resting.ID, resting.Shown(), resting.Price, time.Unix(0, resting.PriorityTime))
+				remaining, stop = e.preventSelfTrade(bookSide, order, *info, resting, remaining)
+				if stop {
+					break
+				}
+				continue
+			}
+			eligible = append(eligible, resting)
+		}
+		if stop || !remaining.IsPositive() {
+			break
+		}
+		if len(eligible) == 0 {
+			// the whole level was taken out, bestOpposite drops it from the heap
+			continue
+		}
+
+		// Trades outside the price bands halt the symbol instead
+		if e.tripBreaker(stockNode, order, price) {
+			break
+		}
+
+		sizes := make([]decimal.Decimal, len(eligible))
+		for i, resting := range eligible {
+			sizes[i] = resting.Shown()
+		}
+		allocations := policy.Allocate(remaining, sizes, lot)
+
+		filled := decimal.Zero
+		timestamp := time.Now().UnixNano()
+		for i, resting := range eligible {
+			amount := allocations[i]
+			if !amount.IsPositive() {
+				continue
+			}
+
+			buyID, buyAccount, sellID, sellAccount := order.ID, order.AccountID, resting.ID, resting.AccountID
+			refund := order.Price.Sub(price)
+			if !isBuy {
+				buyID, buyAccount, sellID, sellAccount = resting.ID, resting.AccountID, order.ID, order.AccountID
+				refund = decimal.Zero
+			}
+			err := e.executeMatch(buyID, buyAccount, sellID, sellAccount,
+				order.Symbol, amount, price, refund, timestamp, order.ID)
+			if err != nil {
+				e.logger.Printf("Error executing match: %v", err)
+				continue
+			}
+			filled = filled.Add(amount)
+		}
+		if !filled.IsPositive() {
+			break
+		}
+
+		setLastPrice(stockNode.GetValue(), price)
+		remaining = remaining.Sub(filled)
+	}
+
+	return remaining
+}
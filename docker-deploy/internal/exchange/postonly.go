@@ -0,0 +1,126 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/pool"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrPostOnlyWouldCross is returned for a post-only order that would have taken liquidity
+var ErrPostOnlyWouldCross = errors.New("Post only order would take liquidity")
+
+// defaultTickSize is the price step of symbols without a tick size
+var defaultTickSize = decimal.New(1, -2)
+
+// submitPostOnly checks a post-only order against the best opposite price before
+// it can trade. A crossing order is canceled and refunded, or repriced one tick
+// behind the best opposite price with the extra reservation given back.
+func (e *Exchange) submitPostOnly(order *database.Order) error {
+	stockNode, err := e.getStockNode(order.Symbol)
+	if err != nil {
+		return fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	// Nothing takes liquidity during a call auction
+	isBuy := order.Amount.IsPositive()
+	best, ok := e.bestOpposite(stockNode, isBuy)
+	crosses := ok && !stockNode.GetValue().InAuction() && ((isBuy && order.Price.GreaterThanOrEqual(best)) || (!isBuy && order.Price.LessThanOrEqual(best)))
+	if crosses {
+		if order.PostOnly != database.PostOnlyReprice {
+			e.cancelRemainder(order, order.Remaining)
+			return ErrPostOnlyWouldCross
+		}
+
+		tick := e.tickSize(order.Symbol)
+		price := best.Add(tick)
+		if isBuy {
+			price = best.Sub(tick)
+		}
+		if !price.IsPositive() {
+			e.cancelRemainder(order, order.Remaining)
+			return ErrPostOnlyWouldCross
+		}
+
+		err := e.repriceOrder(order, price)
+		if err != nil {
+			e.cancelRemainder(order, order.Remaining)
+			return fmt.Errorf("failed to reprice post only order: %v", err)
+		}
+	}
+
+	// It cannot cross anymore, so this only rests it in the book
+	e.matchLocked(stockNode, order)
+	return nil
+}
+
+// tickSize returns the price step of a symbol
+func (e *Exchange) tickSize(symbol string) decimal.Decimal {
+	rules, err := e.store.GetSymbol(symbol)
+	if err != nil {
+		e.logger.Printf("Warning: Failed to load symbol %s: %v", symbol, err)
+		return defaultTickSize
+	}
+	if !rules.TickSize.IsPositive() {
+		return defaultTickSize
+	}
+	return rules.TickSize
+}
+
+// bestOpposite returns the best live price on the other side of the book,
+// dropping canceled orders from the top of the heap on the way
+// the caller must hold the stock node
+func (e *Exchange) bestOpposite(stockNode *pool.LruNode[*pool.StockNode], isBuy bool) (decimal.Decimal, bool) {
+	bookSide := stockNode.GetValue().GetBuyers().OrderHeap
+	if isBuy {
+		bookSide = stockNode.GetValue().GetSellers().OrderHeap
+	}
+
+	for {
+		top, err := bookSide.SafePeek()
+		if err != nil {
+			return decimal.Zero, false
+		}
+
+		topInfo := top.(pool.Order)
+		order, err := e.store.GetOrder(topInfo.GetID())
+		if err == nil && order.Status == "open" {
+			return topInfo.GetPrice(), true
+		}
+		bookSide.SafePop()
+	}
+}
+
+// repriceOrder moves the limit price of an order that has not traded yet,
+// giving back the funds and fees a lower buy price no longer needs
+func (e *Exchange) repriceOrder(order *database.Order, price decimal.Decimal) error {
+	err := e.store.WithTx(func(txFuncs database.Tx) error {
+
+		err := txFuncs.RepriceOrder(order.ID, price)
+		if err != nil {
+			return err
+		}
+		if !order.Amount.IsPositive() {
+			return nil
+		}
+
+		balance, err := txFuncs.GetBalanceForUpdate(order.AccountID)
+		if err != nil {
+			return err
+		}
+		refund := BuyReservation(order.Remaining, order.Price, order.FeeBps).Sub(BuyReservation(order.Remaining, price, order.FeeBps))
+		return txFuncs.UpdateAccountBalance(order.AccountID, balance.Add(refund))
+	})
+	if err != nil {
+		return err
+	}
+
+	e.logger.Printf("Repriced post only order %s from %s to %s", order.ID, order.Price.String(), price.String())
+	order.Price = price
+	return nil
+}
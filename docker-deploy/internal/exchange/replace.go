@@ -0,0 +1,127 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/pool"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReplaceOrder amends the open amount and limit price of a resting limit order
+// while keeping its ID. The reservation is adjusted in the same transaction as
+// the order itself. The order keeps its time priority only when it shrinks at
+// the same price, otherwise it goes back through matching as if it just arrived.
+// It returns the order as it was before the change and whether priority was kept.
+func (e *Exchange) ReplaceOrder(orderID, accountID string, remaining, price decimal.Decimal) (*database.Order, bool, error) {
+	order, err := e.store.GetOrder(orderID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find order: %v", err)
+	}
+	if order.AccountID != accountID {
+		return nil, false, fmt.Errorf("order does not belong to account: %s", accountID)
+	}
+
+	stockNode, err := e.getStockNode(order.Symbol)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get stock node: %v", err)
+	}
+
+	stockNode.Lock()
+	defer stockNode.Unlock()
+
+	// Read it again now that no matching can touch it
+	order, err = e.store.GetOrder(orderID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find order: %v", err)
+	}
+	if order.Status != "open" {
+		return nil, false, fmt.Errorf("order is not open")
+	}
+	if order.OrderType != database.OrderTypeLimit {
+		return nil, false, fmt.Errorf("only limit orders can be replaced")
+	}
+	if price.IsZero() {
+		price = order.Price
+	}
+
+	isBuy := order.Amount.IsPositive()
+	keepPriority := price.Equal(order.Price) && remaining.LessThanOrEqual(order.Remaining)
+
+	// The amended order keeps what already traded and gets the new open amount
+	amended := *order
+	amended.Amount = order.Amount.Abs().Sub(order.Remaining).Add(remaining)
+	if !isBuy {
+		amended.Amount = amended.Amount.Neg()
+	}
+	amended.Price = price
+	amended.Remaining = remaining
+	if keepPriority {
+		amended.Visible = decimal.Min(order.Visible, remaining)
+	} else {
+		amended.PriorityTime = time.Now().UnixNano()
+		if amended.IsIceberg() {
+			amended.Visible = decimal.Min(amended.Display, remaining)
+		}
+	}
+
+	err = e.store.WithTx(func(txFuncs database.Tx) error {
+
+		// Reserve or release only the difference
+		if isBuy {
+			balance, err := txFuncs.GetBalanceForUpdate(accountID)
+			if err != nil {
+				return err
+			}
+			extra := BuyReservation(remaining, price, order.FeeBps).Sub(BuyReservation(order.Remaining, order.Price, order.FeeBps))
+			if balance.LessThan(extra) {
+				return fmt.Errorf("Insufficient funds for account: %s", accountID)
+			}
+			err = txFuncs.UpdateAccountBalance(accountID, balance.Sub(extra))
+			if err != nil {
+				return err
+			}
+		} else {
+			position, err := txFuncs.GetPositionForUpdate(accountID, order.Symbol)
+			if err != nil {
+				return err
+			}
+			extra := remaining.Sub(order.Remaining)
+			if position.LessThan(extra) {
+				return fmt.Errorf("Insufficient shares for: %s in account: %s", position.String(), accountID)
+			}
+			err = txFuncs.CreateOrUpdatePosition(accountID, order.Symbol, position.Sub(extra))
+			if err != nil {
+				return err
+			}
+		}
+
+		return txFuncs.AmendOrder(&amended)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Take the old entry out of the book
+	bookSide := stockNode.GetValue().GetSellers().OrderHeap
+	if isBuy {
+		bookSide = stockNode.GetValue().GetBuyers().OrderHeap
+	}
+	oldEntry, inHeap := bookSide.Remove(orderID)
+
+	if keepPriority {
+		if inHeap {
+			bookSide.SafePush(pool.NewOrder(orderID, amended.Shown(), price, oldEntry.GetTime()))
+		}
+		e.logger.Printf("Replaced order %s in place: %s -> %s", orderID, order.Remaining.String(), remaining.String())
+		return order, true, nil
+	}
+
+	// A bigger or re-priced order queues again and may now cross the book
+	e.logger.Printf("Replaced order %s: %s@%s -> %s@%s, priority lost",
+		orderID, order.Remaining.String(), order.Price.String(), remaining.String(), price.String())
+	e.matchLocked(stockNode, &amended)
+	e.triggerStops(stockNode)
+	return order, false, nil
+}
@@ -0,0 +1,113 @@
+package exchange
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/pool"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// preventSelfTrade stops an incoming order from trading against a resting order
+// of the same account or STP group. The mode of the incoming order decides which
+// side gives way. The resting order has already been popped from bookSide and is
+// pushed back if it survives.
+// It returns what is left of the incoming order and whether matching has to stop.
+// the caller must hold the stock node
+func (e *Exchange) preventSelfTrade(bookSide *pool.OrderHeap, order *database.Order, restingInfo pool.Order,
+	resting *database.Order, remaining decimal.Decimal) (decimal.Decimal, bool) {
+	mode := order.STPMode
+	if mode == "" {
+		mode = database.STPCancelNewest
+	}
+	shares := decimal.Min(remaining, resting.Remaining)
+	e.recordSTPEvent(order, resting, mode, shares)
+
+	switch mode {
+	case database.STPCancelOldest:
+		e.cancelResting(resting)
+		return remaining, false
+
+	case database.STPCancelBoth:
+		e.cancelResting(resting)
+		e.cancelRemainder(order, remaining)
+		return decimal.Zero, true
+
+	case database.STPDecrement:
+		// The smaller order is canceled, the bigger one loses the same amount
+		switch {
+		case remaining.GreaterThan(resting.Remaining):
+			e.cancelResting(resting)
+			if err := e.decrementOrder(order, shares); err != nil {
+				e.logger.Printf("Error decrementing order %s: %v", order.ID, err)
+				e.cancelRemainder(order, remaining)
+				return decimal.Zero, true
+			}
+			return remaining.Sub(shares), false
+		case remaining.LessThan(resting.Remaining):
+			if err := e.decrementOrder(resting, shares); err != nil {
+				e.logger.Printf("Error decrementing order %s: %v", resting.ID, err)
+			} else {
+				// It keeps its place in the book
+				resting.Remaining = resting.Remaining.Sub(shares)
+				resting.Visible = decimal.Min(resting.Visible, resting.Remaining)
+				bookSide.SafePush(pool.NewOrder(resting.ID, resting.Shown(), restingInfo.GetPrice(), restingInfo.GetTime()))
+			}
+		default:
+			e.cancelResting(resting)
+		}
+		e.cancelRemainder(order, remaining)
+		return decimal.Zero, true
+
+	default:
+		// Cancel newest, the resting order stays where it was
+		bookSide.SafePush(&restingInfo)
+		e.cancelRemainder(order, remaining)
+		return decimal.Zero, true
+	}
+}
+
+// cancelResting cancels a resting order that self-trade prevention took out of the book
+func (e *Exchange) cancelResting(resting *database.Order) {
+	e.logger.Printf("Self-trade prevention canceling resting order %s", resting.ID)
+	if err := e.CancelOrder(resting.ID); err != nil {
+		e.logger.Printf("Error canceling resting order: %v", err)
+	}
+}
+
+// decrementOrder takes amount off an open order and releases what was reserved for it
+func (e *Exchange) decrementOrder(order *database.Order, amount decimal.Decimal) error {
+	return e.store.WithTx(func(txFuncs database.Tx) error {
+
+		err := txFuncs.DecrementOrder(order.ID, amount)
+		if err != nil {
+			return err
+		}
+		return releaseReservation(txFuncs, order, amount)
+	})
+}
+
+// recordSTPEvent keeps an audit record of a prevented match
+func (e *Exchange) recordSTPEvent(order, resting *database.Order, mode string, shares decimal.Decimal) {
+	group := ""
+	if order.STPGroup == resting.STPGroup {
+		group = order.STPGroup
+	}
+
+	e.logger.Printf("Self-trade prevented between %s and %s (%s) for %s %s",
+		order.ID, resting.ID, mode, shares.String(), order.Symbol)
+	err := e.store.RecordSTPEvent(&database.STPEvent{
+		Symbol:       order.Symbol,
+		Mode:         mode,
+		TakerOrderID: order.ID,
+		MakerOrderID: resting.ID,
+		TakerAccount: order.AccountID,
+		MakerAccount: resting.AccountID,
+		STPGroup:     group,
+		Shares:       shares,
+		Timestamp:    time.Now().UnixNano(),
+	})
+	if err != nil {
+		e.logger.Printf("Error recording self-trade prevention: %v", err)
+	}
+}
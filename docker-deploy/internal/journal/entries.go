@@ -0,0 +1,41 @@
+package journal
+
+import "github.com/shopspring/decimal"
+
+// OrderEntry is a new order and what was reserved for it. The reservation is
+// written before the order, Before tells whether it was when recovering.
+type OrderEntry struct {
+	OrderID   string          `json:"order_id"`
+	AccountID string          `json:"account_id"`
+	Symbol    string          `json:"symbol"`
+	Buy       bool            `json:"buy"`
+	Reserved  decimal.Decimal `json:"reserved"` // funds for a buy, shares for a sell
+	Before    decimal.Decimal `json:"before"`   // balance or position before the reservation
+}
+
+// CreateAccountEntry is a new account and the settings written after it
+type CreateAccountEntry struct {
+	AccountID string          `json:"account_id"`
+	Balance   decimal.Decimal `json:"balance"`
+	STPMode   string          `json:"stp_mode,omitempty"`
+	FeeTier   string          `json:"fee_tier,omitempty"`
+}
+
+// CancelEntry is the cancel of an order
+type CancelEntry struct {
+	OrderID string `json:"order_id"`
+}
+
+// ReplaceEntry is a new size and limit for an order
+type ReplaceEntry struct {
+	OrderID string          `json:"order_id"`
+	Amount  decimal.Decimal `json:"amount"`
+	Limit   decimal.Decimal `json:"limit"`
+}
+
+// MassCancelEntry is the cancel of an account's orders, optionally of one symbol and side
+type MassCancelEntry struct {
+	AccountID string `json:"account_id"`
+	Symbol    string `json:"symbol,omitempty"`
+	Side      string `json:"side,omitempty"`
+}
@@ -0,0 +1,317 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kind is what a record says about a command
+type Kind string
+
+const (
+	Begin   Kind = "begin"   // the command was accepted, written before any of its changes
+	Commit  Kind = "commit"  // all of its changes are in the store
+	Abort   Kind = "abort"   // none of its changes are in the store
+	Recover Kind = "recover" // closed at startup by recovery, the note says how
+)
+
+// Commands that are journaled
+const (
+	OpOrder         = "order"
+	OpCancel        = "cancel"
+	OpReplace       = "replace"
+	OpMassCancel    = "mass_cancel"
+	OpCreateAccount = "create_account"
+)
+
+// SyncPolicy is when the journal file is flushed to disk
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // every record, nothing accepted is lost
+	SyncInterval SyncPolicy = "interval" // every interval, a crash loses at most the last one
+	SyncNone     SyncPolicy = "none"     // left to the operating system
+)
+
+// ParseSyncPolicy returns the sync policy named by name
+func ParseSyncPolicy(name string) (SyncPolicy, bool) {
+	switch policy := SyncPolicy(name); policy {
+	case SyncAlways, SyncInterval, SyncNone:
+		return policy, true
+	}
+	return "", false
+}
+
+// Record is one line of the journal. Commit, abort and recover records point
+// at the begin record of their command with Ref.
+type Record struct {
+	Seq  uint64          `json:"seq"`
+	Kind Kind            `json:"kind"`
+	Op   string          `json:"op,omitempty"`
+	Ref  uint64          `json:"ref,omitempty"`
+	Time int64           `json:"time"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Note string          `json:"note,omitempty"`
+}
+
+// Decode unmarshals the data of a begin record into v
+func (r *Record) Decode(v any) error {
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		return fmt.Errorf("invalid %s record %d: %v", r.Op, r.Seq, err)
+	}
+	return nil
+}
+
+// Journal is an append-only file of the commands the server accepted. Every
+// line is a CRC32 of the record and the record as JSON.
+type Journal struct {
+	file     *os.File
+	policy   SyncPolicy
+	mutex    sync.Mutex
+	seq      uint64
+	dirty    bool
+	pending  []Record // begin records still open when opened
+	repaired bool     // a torn last record was cut off when opened
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Open opens the journal at path, creating it if needed, and reads what it
+// holds. A last record cut short by a crash is dropped, a damaged record
+// anywhere else is an error.
+func Open(path string, policy SyncPolicy, interval time.Duration) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal: %v", err)
+	}
+
+	j := &Journal{file: file, policy: policy}
+	if err := j.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if policy == SyncInterval {
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncEvery(interval)
+	}
+	return j, nil
+}
+
+// load reads the records, finds the open commands and positions the file for appending
+func (j *Journal) load() error {
+	reader := bufio.NewReader(j.file)
+	open := make(map[uint64]Record)
+	var order []uint64
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// torn write of the last record
+				j.repaired = true
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading journal: %v", err)
+		}
+
+		record, ok := decodeLine(line)
+		if !ok {
+			if _, err := reader.Peek(1); err == io.EOF {
+				j.repaired = true
+				break
+			}
+			return fmt.Errorf("journal is damaged at byte %d", offset)
+		}
+		offset += int64(len(line))
+
+		if record.Seq > j.seq {
+			j.seq = record.Seq
+		}
+		switch record.Kind {
+		case Begin:
+			open[record.Seq] = record
+			order = append(order, record.Seq)
+		case Commit, Abort, Recover:
+			delete(open, record.Ref)
+		}
+	}
+
+	for _, seq := range order {
+		if record, ok := open[seq]; ok {
+			j.pending = append(j.pending, record)
+		}
+	}
+
+	if err := j.file.Truncate(offset); err != nil {
+		return fmt.Errorf("error repairing journal: %v", err)
+	}
+	if _, err := j.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking journal: %v", err)
+	}
+	return nil
+}
+
+// decodeLine checks and decodes a journal line
+func decodeLine(line []byte) (Record, bool) {
+	var record Record
+	body, ok := Unframe(line)
+	if !ok {
+		return record, false
+	}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return record, false
+	}
+	return record, true
+}
+
+// Frame makes a "<crc32 hex> <body>\n" line of body, the event log uses it too
+func Frame(body []byte) string {
+	return fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(body), body)
+}
+
+// Unframe checks a line made by Frame and returns its body
+func Unframe(line []byte) ([]byte, bool) {
+	sum, body, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok {
+		return nil, false
+	}
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || crc32.ChecksumIEEE(body) != uint32(want) {
+		return nil, false
+	}
+	return body, true
+}
+
+// Pending returns the commands begun but not closed when the journal was
+// opened, in the order they were begun
+func (j *Journal) Pending() []Record {
+	return j.pending
+}
+
+// Repaired reports whether a torn last record was cut off when the journal was opened
+func (j *Journal) Repaired() bool {
+	return j.repaired
+}
+
+// Begin records that the command op was accepted, with what is needed to
+// finish or undo it, and returns the sequence number to commit or abort it with.
+// A nil journal records nothing.
+func (j *Journal) Begin(op string, data any) (uint64, error) {
+	if j == nil {
+		return 0, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding %s record: %v", op, err)
+	}
+	return j.append(Record{Kind: Begin, Op: op, Data: raw})
+}
+
+// Commit records that the command begun as seq is complete
+func (j *Journal) Commit(seq uint64, note string) error {
+	if j == nil || seq == 0 {
+		return nil
+	}
+	_, err := j.append(Record{Kind: Commit, Ref: seq, Note: note})
+	return err
+}
+
+// Abort records that the command begun as seq left nothing behind
+func (j *Journal) Abort(seq uint64, note string) error {
+	if j == nil || seq == 0 {
+		return nil
+	}
+	_, err := j.append(Record{Kind: Abort, Ref: seq, Note: note})
+	return err
+}
+
+// Resolve records what recovery made of the command begun as seq
+func (j *Journal) Resolve(seq uint64, note string) error {
+	if j == nil || seq == 0 {
+		return nil
+	}
+	_, err := j.append(Record{Kind: Recover, Ref: seq, Note: note})
+	return err
+}
+
+// append writes a record and syncs it if the policy says so
+func (j *Journal) append(record Record) (uint64, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.seq++
+	record.Seq = j.seq
+	record.Time = time.Now().UnixNano()
+	body, err := json.Marshal(record)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding journal record: %v", err)
+	}
+
+	if _, err := j.file.WriteString(Frame(body)); err != nil {
+		return 0, fmt.Errorf("error writing journal: %v", err)
+	}
+	j.dirty = true
+
+	if j.policy == SyncAlways {
+		if err := j.file.Sync(); err != nil {
+			return 0, fmt.Errorf("error syncing journal: %v", err)
+		}
+		j.dirty = false
+	}
+	return record.Seq, nil
+}
+
+// syncEvery syncs what was written since the last sync every interval
+func (j *Journal) syncEvery(interval time.Duration) {
+	defer close(j.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.sync()
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// sync flushes the file if anything was written since the last sync
+func (j *Journal) sync() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// Close syncs and closes the journal
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+	if err := j.sync(); err != nil {
+		return fmt.Errorf("error syncing journal: %v", err)
+	}
+	return j.file.Close()
+}
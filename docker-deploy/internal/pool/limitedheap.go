@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"StockOverflow/internal/database"
 	"container/heap"
 	"database/sql"
 	"errors"
@@ -12,14 +13,14 @@ type LimitedHeap[T any] struct {
 	maxSize uint
 	minSize uint
 
-	// db
-	db *sql.DB
+	// store
+	store database.Store
 
 	// symbol
 	symbol string
 
 	// refill fn
-	refillFn func(db *sql.DB, symbol string, heapType string, size int) []T
+	refillFn func(store database.Store, symbol string, heapType string, size int) []T
 
 	// heap type
 	heapType string
@@ -35,6 +36,15 @@ func (h *LimitedHeap[T]) SafePop() (interface{}, error) {
 	return result, nil
 }
 
+// safe peek, look at the top without removing it
+func (h *LimitedHeap[T]) SafePeek() (interface{}, error) {
+	h.CheckMin()
+	if h.Len() == 0 {
+		return nil, errors.New("peek from empty heap")
+	}
+	return h.data[0], nil
+}
+
 // safe push
 func (h *LimitedHeap[T]) SafePush(ele *Order) error {
 	heap.Push(h, *ele)
@@ -42,9 +52,14 @@ func (h *LimitedHeap[T]) SafePush(ele *Order) error {
 	return nil
 }
 
-// set db
+// set db, the heap refills from it
 func (h *LimitedHeap[T]) SetDB(db *sql.DB) {
-	h.db = db
+	h.store = database.NewSQLStore(db)
+}
+
+// set store, the heap refills from it
+func (h *LimitedHeap[T]) SetStore(store database.Store) {
+	h.store = store
 }
 
 // update heap to keep it small
@@ -77,13 +92,19 @@ func (h *LimitedHeap[T]) CheckMin() {
 	}
 }
 
+// reload the heap from db, after the book changed behind its back
+func (h *LimitedHeap[T]) Reload() {
+	h.pullFromDB()
+	heap.Init(h)
+}
+
 // pull enough data from db
 func (h *LimitedHeap[T]) pullFromDB() error {
-	if h.db == nil {
+	if h.store == nil {
 		return errors.New("no db connected now")
 	}
 
-	h.data = h.refillFn(h.db, h.symbol, h.heapType, int((h.maxSize+h.minSize)/2))
+	h.data = h.refillFn(h.store, h.symbol, h.heapType, int((h.maxSize+h.minSize)/2))
 
 	// update minsize
 	// if h.Len() < int(h.minSize) {
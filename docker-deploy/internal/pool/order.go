@@ -11,13 +11,13 @@ type Orderer interface {
 }
 type Order struct {
 	id     string
-	amount uint
+	amount decimal.Decimal
 	price  decimal.Decimal
 	time   time.Time
 }
 
 // new
-func NewOrder(id string, amount uint, price decimal.Decimal, time time.Time) *Order {
+func NewOrder(id string, amount decimal.Decimal, price decimal.Decimal, time time.Time) *Order {
 	return &Order{
 		id:     id,
 		amount: amount,
@@ -41,7 +41,12 @@ func (order *Order) GetID() string {
 	return order.id
 }
 
+// get amount
+func (order *Order) GetAmount() decimal.Decimal {
+	return order.amount
+}
+
 // setter for amount
-func (order *Order) SetAmount(amount uint) {
+func (order *Order) SetAmount(amount decimal.Decimal) {
 	order.amount = amount
 }
@@ -2,7 +2,7 @@ package pool
 
 import (
 	"StockOverflow/internal/database"
-	"database/sql"
+	"container/heap"
 	"time"
 )
 
@@ -24,14 +24,24 @@ func NewOrderHeap(symbol string, maxSize uint, minSize uint, cmp func(a, b Order
 	}
 }
 
-func refillFn(db *sql.DB, symbol string, heapType string, size int) []Order {
+// remove an order by id, returning the removed entry
+func (h *OrderHeap) Remove(id string) (Order, bool) {
+	for i, order := range h.data {
+		if order.id == id {
+			return heap.Remove(h, i).(Order), true
+		}
+	}
+	return Order{}, false
+}
+
+func refillFn(store database.Store, symbol string, heapType string, size int) []Order {
 
-	if db == nil {
+	if store == nil {
 		return nil
 	}
 
 	// do sql
-	orders, err := database.GetOpenOrdersBySymbolForHeap(db, symbol, heapType, size)
+	orders, err := store.GetOpenOrdersBySymbolForHeap(symbol, heapType, size)
 	if err != nil {
 		return []Order{}
 	}
@@ -39,7 +49,8 @@ func refillFn(db *sql.DB, symbol string, heapType string, size int) []Order {
 	// new heap data
 	var data []Order
 	for _, order := range orders {
-		neworder := NewOrder(order.ID, uint(order.Remaining.IntPart()), order.Price, time.Unix(order.Timestamp, 0))
+		// only the shown slice of icebergs goes into the heap
+		neworder := NewOrder(order.ID, order.Shown(), order.Price, time.Unix(0, order.PriorityTime))
 		data = append(data, *neworder)
 	}
 	return data
@@ -1,11 +1,31 @@
 package pool
 
+import "github.com/shopspring/decimal"
+
 // a stock node is a trading room for a specific stock
 type StockNode struct {
 
 	// buyers and sellers heap
 	sellers SellerHeap
 	buyers  BuyerHeap
+
+	// dormant stop orders
+	stops *TriggerBook
+
+	// price of the last trade, zero if nothing traded yet
+	lastPrice decimal.Decimal
+
+	// orders only accumulate during a call auction
+	auction bool
+
+	// center of the static price collar, the last auction or previous close
+	referencePrice decimal.Decimal
+
+	// nothing trades until then, unix nanoseconds
+	haltedUntil int64
+
+	// how a price level is shared between its orders, empty means price-time
+	matching string
 }
 
 // new
@@ -15,6 +35,7 @@ func NewStockNode(symbol string, limit uint) *LruNode[*StockNode] {
 		value: &StockNode{
 			sellers: *NewSellerHeap(symbol, limit, 1),
 			buyers:  *NewBuyerHeap(symbol, limit, 1),
+			stops:   NewTriggerBook(),
 		},
 	}
 }
@@ -28,3 +49,63 @@ func (node *StockNode) GetBuyers() *BuyerHeap {
 func (node *StockNode) GetSellers() *SellerHeap {
 	return &node.sellers
 }
+
+// get trigger book
+func (node *StockNode) GetStops() *TriggerBook {
+	return node.stops
+}
+
+// get last trade price
+func (node *StockNode) GetLastPrice() decimal.Decimal {
+	return node.lastPrice
+}
+
+// set last trade price
+func (node *StockNode) SetLastPrice(price decimal.Decimal) {
+	node.lastPrice = price
+}
+
+// in call auction
+func (node *StockNode) InAuction() bool {
+	return node.auction
+}
+
+// set call auction
+func (node *StockNode) SetAuction(auction bool) {
+	node.auction = auction
+}
+
+// get reference price
+func (node *StockNode) GetReferencePrice() decimal.Decimal {
+	return node.referencePrice
+}
+
+// set reference price
+func (node *StockNode) SetReferencePrice(price decimal.Decimal) {
+	node.referencePrice = price
+}
+
+// get halt end
+func (node *StockNode) GetHaltedUntil() int64 {
+	return node.haltedUntil
+}
+
+// set halt end
+func (node *StockNode) SetHaltedUntil(until int64) {
+	node.haltedUntil = until
+}
+
+// halted at now
+func (node *StockNode) Halted(now int64) bool {
+	return now < node.haltedUntil
+}
+
+// get matching policy
+func (node *StockNode) GetMatching() string {
+	return node.matching
+}
+
+// set matching policy
+func (node *StockNode) SetMatching(matching string) {
+	node.matching = matching
+}
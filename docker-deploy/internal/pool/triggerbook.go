@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"container/heap"
+
+	"github.com/shopspring/decimal"
+)
+
+// stop orders of one symbol waiting for the last trade price to reach them
+// the order price is the stop price
+type TriggerBook struct {
+	// lowest stop first, triggered when the price rises to it
+	buyStops *Heap[Order]
+
+	// highest stop first, triggered when the price falls to it
+	sellStops *Heap[Order]
+}
+
+// new
+func NewTriggerBook() *TriggerBook {
+	return &TriggerBook{
+		buyStops:  NewHeap(lessMin),
+		sellStops: NewHeap(lessMax),
+	}
+}
+
+// add a dormant stop order
+func (book *TriggerBook) Add(order *Order, isBuy bool) {
+	if isBuy {
+		heap.Push(book.buyStops, *order)
+	} else {
+		heap.Push(book.sellStops, *order)
+	}
+}
+
+// pop one stop order the last price has reached
+// buy stops trigger at or above their stop, sell stops at or below
+func (book *TriggerBook) PopTriggered(lastPrice decimal.Decimal) (Order, bool) {
+	if book.buyStops.Len() > 0 && lastPrice.GreaterThanOrEqual(book.buyStops.data[0].price) {
+		return heap.Pop(book.buyStops).(Order), true
+	}
+	if book.sellStops.Len() > 0 && lastPrice.LessThanOrEqual(book.sellStops.data[0].price) {
+		return heap.Pop(book.sellStops).(Order), true
+	}
+	return Order{}, false
+}
+
+// number of dormant stops
+func (book *TriggerBook) Len() int {
+	return book.buyStops.Len() + book.sellStops.Len()
+}
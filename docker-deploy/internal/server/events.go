@@ -0,0 +1,122 @@
+package server
+
+import (
+	"StockOverflow/internal/events"
+	"StockOverflow/internal/journal"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// eventSourcing keeps the exchange's events in a log and its state folded from them,
+// snapshotted every so many events so a restart replays only the tail of the log
+type eventSourcing struct {
+	log      *events.Log
+	state    *events.State
+	dir      string
+	every    uint64
+	writing  sync.Mutex // one snapshot is written at a time
+	inFlight sync.WaitGroup
+}
+
+// StartEventLog opens the event log at path and folds it onto the latest
+// snapshot in dir. Without either the state is seeded from the store. The
+// events the exchange publishes from now on are appended and folded, and
+// every snapshotEvery of them the state is snapshotted.
+func (s *Server) StartEventLog(path string, policy journal.SyncPolicy, interval time.Duration, dir string, snapshotEvery uint64) error {
+	st, found, err := events.LoadSnapshot(dir)
+	if err != nil {
+		return err
+	}
+
+	eventLog, err := events.OpenLog(path, policy, interval, st.Seq, st.Apply)
+	if err != nil {
+		return err
+	}
+
+	if !found && eventLog.LastSeq() == 0 {
+		// a store from before the event log, its state is where the events start
+		if st, err = events.SeedState(s.store, 0); err != nil {
+			eventLog.Close()
+			return fmt.Errorf("error seeding event state: %v", err)
+		}
+		if err := s.writeSnapshot(dir, st); err != nil {
+			eventLog.Close()
+			return err
+		}
+	}
+
+	// a store changed while the server was down, or a log that lost its unsynced tail
+	divergences, err := events.Diff(st, s.store)
+	if err != nil {
+		eventLog.Close()
+		return err
+	}
+	for _, divergence := range divergences {
+		s.logger.Printf("Warning: Event state diverges from the store, %s", divergence.String())
+	}
+
+	s.events = &eventSourcing{log: eventLog, state: st, dir: dir, every: snapshotEvery}
+	seq := max(st.Seq, eventLog.LastSeq())
+	s.exchange.Events().Subscribe(seq, s.handleEvent)
+	s.logger.Printf("Event log %s opened at event %d", path, seq)
+	return nil
+}
+
+// handleEvent appends an event to the log and folds it into the state. It is
+// called with the exchange's events in order, the snapshot is written aside.
+func (s *Server) handleEvent(recorded events.Recorded) error {
+	if err := s.events.log.Append(recorded); err != nil {
+		return err
+	}
+	if err := s.events.state.Apply(recorded); err != nil {
+		return err
+	}
+	if s.events.every == 0 || recorded.Seq%s.events.every != 0 {
+		return nil
+	}
+
+	data, seq, err := s.events.state.Marshal()
+	if err != nil {
+		return err
+	}
+	s.events.inFlight.Add(1)
+	go func() {
+		defer s.events.inFlight.Done()
+		s.events.writing.Lock()
+		defer s.events.writing.Unlock()
+		if err := events.WriteSnapshot(s.events.dir, seq, data); err != nil {
+			s.logger.Printf("Failed to write snapshot at event %d: %v", seq, err)
+		}
+	}()
+	return nil
+}
+
+// EventState returns the state folded from the exchange's events, nil without an event log
+func (s *Server) EventState() *events.State {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.state
+}
+
+// writeSnapshot snapshots st into dir
+func (s *Server) writeSnapshot(dir string, st *events.State) error {
+	data, seq, err := st.Marshal()
+	if err != nil {
+		return err
+	}
+	return events.WriteSnapshot(dir, seq, data)
+}
+
+// stopEventLog snapshots the state it was left in and closes the log
+func (s *Server) stopEventLog() error {
+	if s.events == nil {
+		return nil
+	}
+	s.events.inFlight.Wait()
+	if err := s.writeSnapshot(s.events.dir, s.events.state); err != nil {
+		return err
+	}
+	return s.events.log.Close()
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"time"
+)
+
+// defaultDayCutoff is when DAY orders expire, as an offset from local midnight
+const defaultDayCutoff = 16 * time.Hour
+
+// SetDayCutoff sets the time of day, as an offset from local midnight, DAY orders expire at
+func (s *Server) SetDayCutoff(cutoff time.Duration) {
+	s.dayCutoff = cutoff
+}
+
+// dayEnd returns when a DAY order placed at now expires
+func (s *Server) dayEnd(now time.Time) time.Time {
+	year, month, day := now.Date()
+	end := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Add(s.dayCutoff)
+	if !end.After(now) {
+		// placed after the cutoff, it lasts until the next one
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// StartExpiry starts the background scheduler that expires GTD and DAY orders
+// every interval, until the server is stopped
+func (s *Server) StartExpiry(interval time.Duration) {
+	s.stopExpiry = make(chan struct{})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopExpiry:
+				return
+			case <-ticker.C:
+				s.expireOrders()
+			}
+		}
+	}()
+}
+
+// expireOrders expires every order whose expire time has passed
+// and reloads the accounts that got their reservations back
+func (s *Server) expireOrders() {
+	orders, err := s.store.GetExpiredOrders(time.Now().UnixNano())
+	if err != nil {
+		s.logger.Printf("Failed to load expired orders: %v", err)
+		return
+	}
+
+	for _, order := range orders {
+		err := s.exchange.ExpireOrder(order.ID)
+		if err != nil {
+			s.logger.Printf("Failed to expire order %s: %v", order.ID, err)
+			continue
+		}
+		s.refreshAccount(order.AccountID)
+		s.logger.Printf("Expired %s order %s", order.TimeInForce, order.ID)
+	}
+}
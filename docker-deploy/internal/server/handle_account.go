@@ -0,0 +1,93 @@
+package server
+
+import (
+	"StockOverflow/internal/exchange"
+	"StockOverflow/pkg/xmlresponse"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// process account_query ele. The database is the source of truth, balances and
+// positions there already have what open orders hold taken out of them.
+func (s *Server) processAccountQuery(account *AccountNode, response *xmlresponse.Results) {
+	s.logger.Printf("Processing account query for: %s", account.ID)
+
+	queryError := func(err error) {
+		s.logger.Printf("Failed to query account %s: %v", account.ID, err)
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Message: err.Error(),
+		})
+	}
+
+	dbAccount, err := s.store.GetAccount(account.ID)
+	if err != nil {
+		queryError(err)
+		return
+	}
+	positions, err := s.store.GetPositions(account.ID)
+	if err != nil {
+		queryError(err)
+		return
+	}
+	orders, err := s.store.GetOpenOrdersByAccount(account.ID)
+	if err != nil {
+		queryError(err)
+		return
+	}
+
+	// Buys hold what is left of them at their price and its fee, as they reserved it.
+	// Sells hold their shares.
+	reservedCash := decimal.Zero
+	reservedShares := make(map[string]decimal.Decimal)
+	state := xmlresponse.AccountState{ID: account.ID}
+	for _, order := range orders {
+		if order.Amount.IsPositive() {
+			reservedCash = reservedCash.Add(exchange.BuyReservation(order.Remaining, order.Price, order.FeeBps))
+		} else {
+			reservedShares[order.Symbol] = reservedShares[order.Symbol].Add(order.Remaining)
+		}
+		state.Orders = append(state.Orders, xmlresponse.OpenOrder{
+			ID:     order.ID,
+			Symbol: order.Symbol,
+			Amount: order.Amount,
+			Open:   order.Remaining,
+			Status: order.Status,
+		})
+	}
+
+	state.Available = dbAccount.Balance
+	state.Reserved = reservedCash
+	state.Balance = dbAccount.Balance.Add(reservedCash)
+
+	available := make(map[string]decimal.Decimal)
+	for _, position := range positions {
+		available[position.Symbol] = position.Amount
+	}
+	symbols := make([]string, 0, len(available))
+	for symbol := range available {
+		symbols = append(symbols, symbol)
+	}
+	for symbol := range reservedShares {
+		if _, ok := available[symbol]; !ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		reserved := reservedShares[symbol]
+		if available[symbol].IsZero() && reserved.IsZero() {
+			continue
+		}
+		state.Positions = append(state.Positions, xmlresponse.PositionState{
+			Symbol:    symbol,
+			Shares:    available[symbol].Add(reserved),
+			Available: available[symbol],
+			Reserved:  reserved,
+		})
+	}
+
+	response.Children = append(response.Children, state)
+}
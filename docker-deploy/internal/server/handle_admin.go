@@ -0,0 +1,141 @@
+package server
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/session"
+	"StockOverflow/pkg/xmlparser"
+	"StockOverflow/pkg/xmlresponse"
+	"strings"
+)
+
+// handleAdmin processes an admin XML request and returns the response
+func (s *Server) handleAdmin(adminData xmlparser.Admin) ([]byte, error) {
+	// Initialize response
+	response := xmlresponse.Results{
+		Children: make([]any, 0),
+	}
+
+	// process children in order
+	for _, child := range adminData.Children {
+		switch ele := child.(type) {
+		case xmlparser.Auction:
+			s.processAuction(&ele, &response)
+		case xmlparser.PhaseChange:
+			s.processPhase(&ele, &response)
+		case xmlparser.FeeTier:
+			s.processFeeTier(&ele, &response)
+		}
+	}
+
+	return marshalResponse(response)
+}
+
+// process auction ele, "call" starts the call period and "uncross" ends it
+func (s *Server) processAuction(auction *xmlparser.Auction, response *xmlresponse.Results) {
+	s.logger.Printf("Processing auction %s for symbol: %s", auction.Action, auction.Symbol)
+
+	switch strings.ToLower(auction.Action) {
+	case "call":
+		if err := s.exchange.StartAuction(auction.Symbol); err != nil {
+			response.Children = append(response.Children, xmlresponse.Error{
+				Symbol:  auction.Symbol,
+				Message: err.Error(),
+			})
+			return
+		}
+		response.Children = append(response.Children, xmlresponse.AuctionState{
+			Symbol: auction.Symbol,
+			State:  "call",
+		})
+
+	case "uncross":
+		result, err := s.exchange.Uncross(auction.Symbol)
+		if err != nil {
+			response.Children = append(response.Children, xmlresponse.Error{
+				Symbol:  auction.Symbol,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		// balances and positions changed behind the cached accounts
+		s.refreshAccounts()
+
+		response.Children = append(response.Children, xmlresponse.Auction{
+			Symbol:    result.Symbol,
+			Price:     result.Price,
+			Volume:    result.Volume,
+			Imbalance: result.Imbalance,
+			Uncrossed: true,
+		})
+
+	default:
+		response.Children = append(response.Children, xmlresponse.Error{
+			Symbol:  auction.Symbol,
+			Message: "Unknown auction action: " + auction.Action,
+		})
+	}
+}
+
+// process phase ele, holds the symbol in a phase or puts it back on the schedule
+func (s *Server) processPhase(change *xmlparser.PhaseChange, response *xmlresponse.Results) {
+	s.logger.Printf("Processing phase %s for symbol: %s", change.Phase, change.Symbol)
+
+	if strings.ToLower(change.Phase) == "scheduled" {
+		s.calendar.ClearPhase(change.Symbol)
+	} else {
+		phase, ok := session.ParsePhase(change.Phase)
+		if !ok {
+			response.Children = append(response.Children, xmlresponse.Error{
+				Symbol:  change.Symbol,
+				Message: "Unknown trading phase: " + change.Phase,
+			})
+			return
+		}
+		s.calendar.SetPhase(change.Symbol, phase)
+	}
+
+	phase := s.phase(change.Symbol)
+	s.enterPhase(change.Symbol, phase)
+	response.Children = append(response.Children, xmlresponse.PhaseState{
+		Symbol: change.Symbol,
+		State:  string(phase),
+	})
+}
+
+// process fee_tier ele, accounts in the tier pay its rates
+func (s *Server) processFeeTier(tier *xmlparser.FeeTier, response *xmlresponse.Results) {
+	s.logger.Printf("Processing fee tier %s: maker %s, taker %s", tier.Name, tier.Maker.String(), tier.Taker.String())
+
+	if tier.Name == "" {
+		response.Children = append(response.Children, xmlresponse.Error{
+			Message: "Fee tier needs a name",
+		})
+		return
+	}
+	if tier.Taker.IsNegative() || tier.Maker.Add(tier.Taker).IsNegative() {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      tier.Name,
+			Message: "Taker fee cannot be negative or smaller than the maker rebate",
+		})
+		return
+	}
+
+	err := s.store.CreateOrUpdateFeeTier(&database.FeeTier{
+		Name:     tier.Name,
+		MakerBps: tier.Maker,
+		TakerBps: tier.Taker,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to save fee tier %s: %v", tier.Name, err)
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      tier.Name,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response.Children = append(response.Children, xmlresponse.Created{
+		ID: tier.Name,
+	})
+}
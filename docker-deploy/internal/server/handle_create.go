@@ -1,10 +1,11 @@
 package server
 
 import (
-	"StockOverflow/internal/database"
+	"StockOverflow/internal/journal"
 	"StockOverflow/pkg/xmlparser"
 	"StockOverflow/pkg/xmlresponse"
 	"fmt"
+	"strings"
 
 	"github.com/shopspring/decimal"
 )
@@ -35,9 +36,34 @@ func (s *Server) processAccount(account *xmlparser.Account, response *xmlrespons
 	// Process accounts first
 	s.logger.Printf("Processing create account request for ID: %s", account.ID)
 
+	stpMode := strings.ToUpper(account.STP)
+	if stpMode != "" && !validSTPMode(stpMode) {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Message: "Unknown self-trade prevention mode: " + account.STP,
+		})
+		return
+	}
+
+	// The settings are written after the account, journal them together
+	seq, err := s.beginJournal(journal.OpCreateAccount, journal.CreateAccountEntry{
+		AccountID: account.ID,
+		Balance:   account.Balance,
+		STPMode:   stpMode,
+		FeeTier:   account.FeeTier,
+	})
+	if err != nil {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Message: "Failed to journal account",
+		})
+		return
+	}
+
 	// Store in database
-	err := database.CreateAccount(s.db, account.ID, account.Balance)
+	err = s.store.CreateAccount(account.ID, account.Balance)
 	if err != nil {
+		s.abortJournal(seq, err.Error())
 		s.logger.Printf("Failed to create account %s: %v", account.ID, err)
 		response.Children = append(response.Children, xmlresponse.Error{
 			ID:      account.ID,
@@ -46,6 +72,20 @@ func (s *Server) processAccount(account *xmlparser.Account, response *xmlrespons
 		return
 	}
 
+	if stpMode != "" {
+		err = s.store.SetAccountSTPMode(account.ID, stpMode)
+		if err != nil {
+			s.logger.Printf("Failed to set stp mode of account %s: %v", account.ID, err)
+		}
+	}
+	if account.FeeTier != "" {
+		err = s.store.SetAccountFeeTier(account.ID, account.FeeTier)
+		if err != nil {
+			s.logger.Printf("Failed to set fee tier of account %s: %v", account.ID, err)
+		}
+	}
+	s.commitJournal(seq, "")
+
 	// Store in server memory
 	s.accountsMutex.Lock()
 	s.accounts[account.ID] = &AccountNode{
@@ -81,6 +121,18 @@ func (s *Server) processSymbol(symbol *xmlparser.Symbol, response *xmlresponse.R
 	// 	stockNode = node
 	// }
 
+	// Trading rules apply to every order of the symbol
+	if symbol.HasRules() {
+		errorMsg := s.saveSymbolRules(symbol)
+		if errorMsg != "" {
+			response.Children = append(response.Children, xmlresponse.Error{
+				Symbol:  symbol.Symbol,
+				Message: errorMsg,
+			})
+			return
+		}
+	}
+
 	// Process allocations for this symbol
 	for _, allocation := range symbol.Accounts {
 		// Validate account exists
@@ -90,7 +142,7 @@ func (s *Server) processSymbol(symbol *xmlparser.Symbol, response *xmlresponse.R
 
 		if !exists {
 			// Try to load from database
-			dbAccount, err := database.GetAccount(s.db, allocation.ID)
+			dbAccount, err := s.store.GetAccount(allocation.ID)
 			if err != nil {
 				s.logger.Printf("Account not found for allocation: %s", allocation.ID)
 				response.Children = append(response.Children, xmlresponse.Error{
@@ -109,20 +161,18 @@ func (s *Server) processSymbol(symbol *xmlparser.Symbol, response *xmlresponse.R
 			}
 
 			// Load all existing positions for this account
-			positions, err := database.GetPositions(s.db, allocation.ID)
+			positions, err := s.store.GetPositions(allocation.ID)
 			if err == nil {
 				for _, pos := range positions {
 					account.Positions[pos.Symbol] = pos.Amount
 				}
 			}
 
-			s.accountsMutex.Lock()
-			s.accounts[account.ID] = account
-			s.accountsMutex.Unlock()
+			account = s.cacheAccount(account)
 		}
 
 		// Check if position already exists in database
-		position, err := database.GetPosition(s.db, allocation.ID, symbol.Symbol)
+		position, err := s.store.GetPosition(allocation.ID, symbol.Symbol)
 
 		var newAmount decimal.Decimal
 		if err == nil && position != nil {
@@ -134,7 +184,7 @@ func (s *Server) processSymbol(symbol *xmlparser.Symbol, response *xmlresponse.R
 		}
 
 		// Update position in database with the new amount
-		err = database.CreateOrUpdatePosition(s.db, allocation.ID, symbol.Symbol, newAmount)
+		err = s.store.CreateOrUpdatePosition(allocation.ID, symbol.Symbol, newAmount)
 		if err != nil {
 			s.logger.Printf("Failed to update position: %v", err)
 			response.Children = append(response.Children, xmlresponse.Error{
@@ -147,13 +197,13 @@ func (s *Server) processSymbol(symbol *xmlparser.Symbol, response *xmlresponse.R
 
 		// Update position in memory
 		s.accountsMutex.Lock()
-		if s.accounts[allocation.ID].Positions == nil {
-			s.accounts[allocation.ID].Positions = make(map[string]decimal.Decimal)
+		if account.Positions == nil {
+			account.Positions = make(map[string]decimal.Decimal)
 		}
 
 		// Add to existing position in memory, if any
-		currentAmount := s.accounts[allocation.ID].Positions[symbol.Symbol] // if just make, it's zero.
-		s.accounts[allocation.ID].Positions[symbol.Symbol] = currentAmount.Add(allocation.Amount)
+		currentAmount := account.Positions[symbol.Symbol] // if just make, it's zero.
+		account.Positions[symbol.Symbol] = currentAmount.Add(allocation.Amount)
 		s.accountsMutex.Unlock()
 
 		// Add success response
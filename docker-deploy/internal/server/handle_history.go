@@ -0,0 +1,168 @@
+package server
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/pkg/xmlparser"
+	"StockOverflow/pkg/xmlresponse"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// history page sizes
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// historyFilter validates the filters of a history query, the error message is empty if they are fine
+func historyFilter(accountID, symbol, status, side string, from, to int64, limit int) (*database.HistoryFilter, string) {
+	filter := &database.HistoryFilter{
+		AccountID: accountID,
+		Symbol:    symbol,
+		Status:    strings.ToLower(status),
+		Side:      strings.ToLower(side),
+		Limit:     limit,
+	}
+
+	switch filter.Status {
+	case "", "pending", "open", "executed", "canceled", "expired":
+	default:
+		return nil, "Unknown order status: " + status
+	}
+	if filter.Side != "" && filter.Side != "buy" && filter.Side != "sell" {
+		return nil, "Side must be buy or sell"
+	}
+	if from < 0 || to < 0 || (to > 0 && to <= from) {
+		return nil, "Time range must be positive unix seconds with from before to"
+	}
+	if from > 0 {
+		filter.From = time.Unix(from, 0).UnixNano()
+	}
+	if to > 0 {
+		filter.To = time.Unix(to, 0).UnixNano()
+	}
+	switch {
+	case limit < 0 || limit > maxHistoryLimit:
+		return nil, fmt.Sprintf("Limit must be between 1 and %d", maxHistoryLimit)
+	case limit == 0:
+		filter.Limit = defaultHistoryLimit
+	}
+	return filter, ""
+}
+
+// historyCursor decodes the cursor of a history query, nil for the first page
+func historyCursor(token string) (*database.HistoryCursor, string) {
+	if token == "" {
+		return nil, ""
+	}
+	cursor, err := database.DecodeHistoryCursor(token)
+	if err != nil {
+		return nil, "Invalid cursor: " + token
+	}
+	return cursor, ""
+}
+
+// process order_history ele
+func (s *Server) processOrderHistory(query *xmlparser.OrderHistory, account *AccountNode, response *xmlresponse.Results) {
+	s.logger.Printf("Processing order history for account: %s", account.ID)
+
+	historyError := func(message string) {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Symbol:  query.Symbol,
+			Message: message,
+		})
+	}
+
+	filter, errorMsg := historyFilter(account.ID, query.Symbol, query.Status, query.Side, query.From, query.To, query.Limit)
+	if errorMsg != "" {
+		historyError(errorMsg)
+		return
+	}
+	cursor, errorMsg := historyCursor(query.Cursor)
+	if errorMsg != "" {
+		historyError(errorMsg)
+		return
+	}
+
+	orders, next, err := s.store.GetOrderHistory(filter, cursor)
+	if err != nil {
+		s.logger.Printf("Failed to load order history: %v", err)
+		historyError(err.Error())
+		return
+	}
+
+	page := xmlresponse.OrderHistory{}
+	if next != nil {
+		page.Next = next.Encode()
+	}
+	for _, order := range orders {
+		page.Orders = append(page.Orders, xmlresponse.HistoryOrder{
+			ID:     order.ID,
+			Symbol: order.Symbol,
+			Amount: order.Amount,
+			Limit:  xmlresponse.Optional(order.Price),
+			Type:   order.OrderType,
+			TIF:    order.TimeInForce,
+			Status: order.Status,
+			Open:   order.Remaining,
+			Time:   order.Timestamp,
+		})
+	}
+	response.Children = append(response.Children, page)
+}
+
+// process trade_history ele
+func (s *Server) processTradeHistory(query *xmlparser.TradeHistory, account *AccountNode, response *xmlresponse.Results) {
+	s.logger.Printf("Processing trade history for account: %s", account.ID)
+
+	historyError := func(message string) {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Symbol:  query.Symbol,
+			Message: message,
+		})
+	}
+
+	filter, errorMsg := historyFilter(account.ID, query.Symbol, "", query.Side, query.From, query.To, query.Limit)
+	if errorMsg != "" {
+		historyError(errorMsg)
+		return
+	}
+	cursor, errorMsg := historyCursor(query.Cursor)
+	if errorMsg != "" {
+		historyError(errorMsg)
+		return
+	}
+
+	executions, next, err := s.store.GetExecutionHistory(filter, cursor)
+	if err != nil {
+		s.logger.Printf("Failed to load trade history: %v", err)
+		historyError(err.Error())
+		return
+	}
+
+	page := xmlresponse.TradeHistory{}
+	if next != nil {
+		page.Next = next.Encode()
+	}
+	for _, exec := range executions {
+		side := "sell"
+		if exec.IsBuy {
+			side = "buy"
+		}
+		page.Trades = append(page.Trades, xmlresponse.HistoryTrade{
+			OrderID:   exec.OrderID,
+			TradeID:   exec.TradeID,
+			Symbol:    exec.Symbol,
+			Side:      side,
+			Shares:    exec.Shares,
+			Price:     exec.Price,
+			Fee:       xmlresponse.Optional(exec.Fee),
+			Liquidity: exec.Liquidity,
+			Time:      exec.Timestamp,
+		})
+	}
+	response.Children = append(response.Children, page)
+}
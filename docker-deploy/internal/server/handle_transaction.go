@@ -2,11 +2,16 @@ package server
 
 import (
 	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/journal"
 	"StockOverflow/pkg/xmlparser"
 	"StockOverflow/pkg/xmlresponse"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
@@ -26,7 +31,7 @@ func (s *Server) handleTransactions(transactionData xmlparser.Transaction) ([]by
 	if !exists {
 		// Try to load from database
 		// TODO account's lru logic
-		dbAccount, err := database.GetAccount(s.db, transactionData.ID)
+		dbAccount, err := s.store.GetAccount(transactionData.ID)
 		if err != nil {
 			// Account not found, return error for all transactions
 			s.logger.Printf("Account not found for transactions: %s", transactionData.ID)
@@ -46,7 +51,7 @@ func (s *Server) handleTransactions(transactionData xmlparser.Transaction) ([]by
 		}
 
 		// Load all existing positions for this account
-		positions, err := database.GetPositions(s.db, dbAccount.ID)
+		positions, err := s.store.GetPositions(dbAccount.ID)
 		if err == nil {
 			for _, pos := range positions {
 				account.Positions[pos.Symbol] = pos.Amount
@@ -57,9 +62,7 @@ func (s *Server) handleTransactions(transactionData xmlparser.Transaction) ([]by
 		}
 
 		// Store in server memory
-		s.accountsMutex.Lock()
-		s.accounts[account.ID] = account
-		s.accountsMutex.Unlock()
+		account = s.cacheAccount(account)
 	}
 
 	// process ele in order
@@ -71,6 +74,20 @@ func (s *Server) handleTransactions(transactionData xmlparser.Transaction) ([]by
 			s.processQuery(&ele, &response)
 		case xmlparser.Cancel:
 			s.processCancel(&ele, &response)
+		case xmlparser.Replace:
+			s.processReplace(&ele, account, &response)
+		case xmlparser.Indicative:
+			s.processIndicative(&ele, &response)
+		case xmlparser.Book:
+			s.processBook(&ele, &response)
+		case xmlparser.MassCancel:
+			s.processMassCancel(&ele, account, &response)
+		case xmlparser.AccountQuery:
+			s.processAccountQuery(account, &response)
+		case xmlparser.OrderHistory:
+			s.processOrderHistory(&ele, account, &response)
+		case xmlparser.TradeHistory:
+			s.processTradeHistory(&ele, account, &response)
 		default:
 			s.logger.Fatalf("unknown type in children: %T", reflect.TypeOf(ele))
 		}
@@ -81,42 +98,64 @@ func (s *Server) handleTransactions(transactionData xmlparser.Transaction) ([]by
 	return marshalResponse(response)
 }
 
-// validateAndReserve validates an order and reserves the necessary funds or shares
-func (s *Server) validateAndReserve(account *AccountNode, symbol string, amount, price decimal.Decimal, isBuy bool) string {
+// validateAndReserve validates an order and reserves the necessary funds or shares.
+// The reservation is journaled before it is written.
+func (s *Server) validateAndReserve(account *AccountNode, orderID string, symbol string, amount, price decimal.Decimal, isBuy bool) (*reservation, string) {
+	reserved := &reservation{entry: journal.OrderEntry{
+		OrderID:   orderID,
+		AccountID: account.ID,
+		Symbol:    symbol,
+		Buy:       isBuy,
+	}}
+
 	if isBuy {
-		// For buy order, check account balance
-		totalCost := amount.Mul(price)
+		// For buy order, check account balance.
+		// Fees are charged at execution, the balance has to cover the higher one too.
+		feeBps, err := s.exchange.BuyFeeRate(account.ID, symbol)
+		if err != nil {
+			s.logger.Printf("Warning: Failed to load fee rates of account %s: %v", account.ID, err)
+		}
+		cost := exchange.BuyReservation(amount, price, feeBps)
 
 		// Get the latest account balance from memory
 		s.accountsMutex.RLock()
-		accountBalance := s.accounts[account.ID].Balance
+		accountBalance := account.Balance
 		s.accountsMutex.RUnlock()
 
-		if accountBalance.LessThan(totalCost) {
-			return "Insufficient funds for account: " + account.ID
+		if accountBalance.LessThan(cost) {
+			return nil, "Insufficient funds for account: " + account.ID
 		}
 
-		// Reserve the funds by updating account balance
-		newBalance := accountBalance.Sub(totalCost)
+		// Reserve the funds and the fee by updating account balance
+		newBalance := accountBalance.Sub(cost)
+
+		reserved.entry.Reserved, reserved.entry.Before = cost, accountBalance
+		reserved.feeBps = feeBps
+		seq, err := s.beginJournal(journal.OpOrder, reserved.entry)
+		if err != nil {
+			return nil, "Failed to journal order"
+		}
+		reserved.seq = seq
 
-		err := database.UpdateAccountBalance(s.db, account.ID, newBalance)
+		err = s.store.UpdateAccountBalance(account.ID, newBalance)
 		if err != nil {
-			return fmt.Sprintf("Failed to update account balance: %v", err)
+			s.abortJournal(seq, err.Error())
+			return nil, fmt.Sprintf("Failed to update account balance: %v", err)
 		}
 
 		// Update the account in memory
 		s.accountsMutex.Lock()
-		s.accounts[account.ID].Balance = newBalance
+		account.Balance = newBalance
 		s.accountsMutex.Unlock()
 
-		return ""
+		return reserved, ""
 	} else {
 		// For sell order
 		sellAmount := amount.Abs()
 
 		// Get the position from memory instead of database
 		s.accountsMutex.RLock()
-		currentPosition, exists := s.accounts[account.ID].Positions[symbol]
+		currentPosition, exists := account.Positions[symbol]
 		s.accountsMutex.RUnlock()
 
 		if !exists || currentPosition.LessThan(sellAmount) {
@@ -124,22 +163,191 @@ func (s *Server) validateAndReserve(account *AccountNode, symbol string, amount,
 			if exists {
 				posAmount = currentPosition
 			}
-			return "Insufficient shares for: " + posAmount.String() + " in account: " + account.ID
+			return nil, "Insufficient shares for: " + posAmount.String() + " in account: " + account.ID
 		}
 
 		// Calculate new position amount
 		newAmount := currentPosition.Sub(sellAmount)
+
+		reserved.entry.Reserved, reserved.entry.Before = sellAmount, currentPosition
+		seq, err := s.beginJournal(journal.OpOrder, reserved.entry)
+		if err != nil {
+			return nil, "Failed to journal order"
+		}
+		reserved.seq = seq
+
 		// Update position in database
-		err := database.CreateOrUpdatePosition(s.db, account.ID, symbol, newAmount)
+		err = s.store.CreateOrUpdatePosition(account.ID, symbol, newAmount)
 		if err != nil {
-			return fmt.Sprintf("Failed to update position: %v", err)
+			s.abortJournal(seq, err.Error())
+			return nil, fmt.Sprintf("Failed to update position: %v", err)
 		}
 
 		// Update position in memory
 		s.accountsMutex.Lock()
-		s.accounts[account.ID].Positions[symbol] = newAmount
+		account.Positions[symbol] = newAmount
 		s.accountsMutex.Unlock()
-		return ""
+		return reserved, ""
+	}
+}
+
+// orderKind validates the type and time in force of an order request
+func orderKind(orderRequest *xmlparser.Order) (string, string, string) {
+	switch orderRequest.Type {
+	case "", database.OrderTypeLimit, database.OrderTypeMarket, database.OrderTypeStop, database.OrderTypeStopLimit:
+	default:
+		return "", "", "Unknown order type: " + orderRequest.Type
+	}
+
+	tif := orderRequest.TimeInForce()
+	switch tif {
+	case "", database.TimeInForceGTC, database.TimeInForceIOC, database.TimeInForceFOK,
+		database.TimeInForceGTD, database.TimeInForceDay:
+	default:
+		return "", "", "Unknown time in force: " + orderRequest.TIF
+	}
+
+	orderType := database.OrderTypeLimit
+	switch {
+	case orderRequest.Type == database.OrderTypeStop || orderRequest.Type == database.OrderTypeStopLimit:
+		orderType = orderRequest.Type
+		if !orderRequest.StopPrice.IsPositive() {
+			return "", "", "Stop orders need a positive stop price"
+		}
+		if orderType == database.OrderTypeStopLimit && !orderRequest.LimitPrice.IsPositive() {
+			return "", "", "Stop limit orders need a positive limit price"
+		}
+	case orderRequest.IsMarket():
+		orderType = database.OrderTypeMarket
+	}
+
+	if (orderType == database.OrderTypeMarket || orderType == database.OrderTypeStop) && database.TimeInForceRests(tif) {
+		return "", "", "Market orders can only be immediate or cancel or fill or kill"
+	}
+
+	// Only good till date orders carry their own expire time
+	if tif == database.TimeInForceGTD && orderRequest.ExpireTime <= time.Now().Unix() {
+		return "", "", "Good till date orders need an expire time in the future"
+	}
+	if orderRequest.ExpireTime != 0 && tif != database.TimeInForceGTD {
+		return "", "", "Only good till date orders can have an expire time"
+	}
+
+	// Only orders that rest in the book can hide part of their size
+	if orderRequest.Display.IsNegative() {
+		return "", "", "Display amount must be positive"
+	}
+	if orderRequest.Display.IsPositive() && (orderType != database.OrderTypeLimit || (tif != "" && !database.TimeInForceRests(tif))) {
+		return "", "", "Only limit orders that rest in the book can be icebergs"
+	}
+
+	if orderRequest.STP != "" && !validSTPMode(strings.ToUpper(orderRequest.STP)) {
+		return "", "", "Unknown self-trade prevention mode: " + orderRequest.STP
+	}
+
+	// Only orders that rest in the book can insist on providing liquidity
+	switch orderRequest.PostOnlyMode() {
+	case "":
+	case database.PostOnlyReject, database.PostOnlyReprice:
+		if orderType != database.OrderTypeLimit || (tif != "" && !database.TimeInForceRests(tif)) {
+			return "", "", "Only limit orders that rest in the book can be post only"
+		}
+	default:
+		return "", "", "Unknown post only mode: " + orderRequest.PostOnly
+	}
+	return orderType, tif, ""
+}
+
+// validSTPMode reports whether mode is one of the self-trade prevention modes
+func validSTPMode(mode string) bool {
+	switch mode {
+	case database.STPCancelNewest, database.STPCancelOldest, database.STPCancelBoth, database.STPDecrement:
+		return true
+	}
+	return false
+}
+
+// orderError builds the error response for a rejected order
+func orderError(orderRequest *xmlparser.Order, message string) xmlresponse.Error {
+	return xmlresponse.Error{
+		Symbol:  orderRequest.Symbol,
+		Amount:  orderRequest.Amount,
+		Limit:   orderRequest.LimitPrice,
+		Message: message,
+	}
+}
+
+// addImmediateResults reports the fills and the canceled remainder of an order
+// that was not allowed to rest in the book
+func (s *Server) addImmediateResults(opened *xmlresponse.Opened, orderID string) {
+	order, executions, err := s.exchange.GetOrderStatus(orderID)
+	if err != nil {
+		s.logger.Printf("Failed to get order status: %v", err)
+		return
+	}
+
+	opened.TIF = order.TimeInForce
+	for _, exec := range executions {
+		opened.Executed = append(opened.Executed, executedResponse(exec))
+	}
+	if order.Status == "canceled" {
+		opened.Canceled = &xmlresponse.Canceled{
+			Shares: order.Remaining,
+			Time:   order.CanceledTime,
+		}
+	}
+}
+
+// cacheAccount keeps an account loaded from the database in memory and
+// returns the cached one, which may have been loaded in the meantime
+func (s *Server) cacheAccount(account *AccountNode) *AccountNode {
+	s.accountsMutex.Lock()
+	defer s.accountsMutex.Unlock()
+	if cached, exists := s.accounts[account.ID]; exists {
+		return cached
+	}
+	s.accounts[account.ID] = account
+	return account
+}
+
+// refreshAccount reloads an account's balance and positions from the database
+// after the exchange changed them on its own, e.g. by refunding a canceled remainder
+func (s *Server) refreshAccount(accountID string) {
+	// read under the lock, or a reservation written in between would be undone
+	s.accountsMutex.Lock()
+	defer s.accountsMutex.Unlock()
+
+	dbAccount, err := s.store.GetAccount(accountID)
+	if err != nil {
+		s.logger.Printf("Warning: Failed to reload account %s: %v", accountID, err)
+		return
+	}
+	positions, err := s.store.GetPositions(accountID)
+	if err != nil {
+		s.logger.Printf("Warning: Failed to reload positions for account %s: %v", accountID, err)
+		return
+	}
+
+	account, exists := s.accounts[accountID]
+	if !exists {
+		return
+	}
+	account.Balance = dbAccount.Balance
+	account.Positions = make(map[string]decimal.Decimal)
+	for _, pos := range positions {
+		account.Positions[pos.Symbol] = pos.Amount
+	}
+}
+
+// executedResponse reports an execution with the fee the order paid on it
+func executedResponse(exec database.Execution) xmlresponse.Executed {
+	return xmlresponse.Executed{
+		Shares:    exec.Shares,
+		Price:     exec.Price,
+		Fee:       xmlresponse.Optional(exec.Fee),
+		Liquidity: exec.Liquidity,
+		TradeID:   exec.TradeID,
+		Time:      exec.Timestamp,
 	}
 }
 
@@ -153,21 +361,25 @@ func createStatusResponse(orderID string, order *database.Order, executions []da
 	switch order.Status {
 	case "open":
 		status.Open = []xmlresponse.Open{
-			{Shares: float64(order.Remaining.InexactFloat64())},
+			{Shares: order.Remaining},
+		}
+	case "pending":
+		status.Pending = []xmlresponse.Pending{
+			{Shares: order.Remaining, Stop: order.StopPrice},
 		}
 	case "canceled":
 		status.Canceled = []xmlresponse.Canceled{
-			{Shares: float64(order.Remaining.InexactFloat64()), Time: order.CanceledTime},
+			{Shares: order.Remaining, Time: order.CanceledTime},
+		}
+	case "expired":
+		status.Expired = []xmlresponse.Expired{
+			{Shares: order.Remaining, Time: order.CanceledTime},
 		}
 	}
 
 	// Add executions
 	for _, exec := range executions {
-		status.Executed = append(status.Executed, xmlresponse.Executed{
-			Shares: float64(exec.Shares.InexactFloat64()),
-			Price:  float64(exec.Price.InexactFloat64()),
-			Time:   exec.Timestamp,
-		})
+		status.Executed = append(status.Executed, executedResponse(exec))
 	}
 
 	return status
@@ -177,22 +389,18 @@ func createStatusResponse(orderID string, order *database.Order, executions []da
 func createCanceledResponse(orderID string, order *database.Order, executions []database.Execution) xmlresponse.CanceledOrder {
 	canceled := xmlresponse.CanceledOrder{
 		ID: orderID,
-		// Shares: float64(order.Remaining.InexactFloat64()),
+		// Shares: order.Remaining,
 		// Time:   order.CanceledTime,
 	}
 
 	canceled.Canceled = xmlresponse.Canceled{
-		Shares: float64(order.Remaining.InexactFloat64()),
+		Shares: order.Remaining,
 		Time:   order.CanceledTime,
 	}
 
 	// Add executions
 	for _, exec := range executions {
-		canceled.Executed = append(canceled.Executed, xmlresponse.Executed{
-			Shares: float64(exec.Shares.InexactFloat64()),
-			Price:  float64(exec.Price.InexactFloat64()),
-			Time:   exec.Timestamp,
-		})
+		canceled.Executed = append(canceled.Executed, executedResponse(exec))
 	}
 
 	return canceled
@@ -207,8 +415,8 @@ func generateAccountNotFoundErrors(response *xmlresponse.Results, transaction xm
 			{
 				response.Children = append(response.Children, xmlresponse.Error{
 					Symbol:  ele.Symbol,
-					Amount:  float64(ele.Amount),
-					Limit:   float64(ele.LimitPrice.InexactFloat64()),
+					Amount:  ele.Amount,
+					Limit:   ele.LimitPrice,
 					Message: "Account not found",
 				})
 			}
@@ -226,6 +434,34 @@ func generateAccountNotFoundErrors(response *xmlresponse.Results, transaction xm
 					Message: "Account not found",
 				})
 			}
+		case xmlparser.Replace:
+			{
+				response.Children = append(response.Children, xmlresponse.Error{
+					ID:      ele.ID,
+					Message: "Account not found",
+				})
+			}
+		case xmlparser.Indicative:
+			{
+				response.Children = append(response.Children, xmlresponse.Error{
+					Symbol:  ele.Symbol,
+					Message: "Account not found",
+				})
+			}
+		case xmlparser.Book:
+			{
+				response.Children = append(response.Children, xmlresponse.Error{
+					Symbol:  ele.Symbol,
+					Message: "Account not found",
+				})
+			}
+		case xmlparser.AccountQuery, xmlparser.OrderHistory, xmlparser.TradeHistory, xmlparser.MassCancel:
+			{
+				response.Children = append(response.Children, xmlresponse.Error{
+					ID:      transaction.ID,
+					Message: "Account not found",
+				})
+			}
 		}
 	}
 
@@ -245,52 +481,165 @@ func marshalResponse(response xmlresponse.Results) ([]byte, error) {
 func (s *Server) processOrder(orderRequest *xmlparser.Order, account *AccountNode, response *xmlresponse.Results) {
 	// Generate order ID
 	orderID := s.generateOrderID()
-	s.logger.Printf("Processing order: %s, symbol: %s, amount: %d, price: %s",
-		orderID, orderRequest.Symbol, orderRequest.Amount, orderRequest.LimitPrice.String())
+	s.logger.Printf("Processing order: %s, symbol: %s, amount: %s, price: %s",
+		orderID, orderRequest.Symbol, orderRequest.Amount.String(), orderRequest.LimitPrice.String())
 
-	// Convert amount to decimal for calculations
-	amount := decimal.NewFromInt(int64(orderRequest.Amount))
+	amount := orderRequest.Amount
 
 	// Negative amount means sell, positive means buy
-	isBuy := orderRequest.Amount > 0
+	isBuy := orderRequest.Amount.IsPositive()
+
+	// Work out how the order trades
+	orderType, tif, errorMsg := orderKind(orderRequest)
+	if errorMsg != "" {
+		response.Children = append(response.Children, orderError(orderRequest, errorMsg))
+		return
+	}
+
+	// The symbol's trading phase decides whether it takes orders at all
+	phase := s.phase(orderRequest.Symbol)
+	if !phase.AcceptsOrders() {
+		message := fmt.Sprintf("Symbol is %s, orders are not accepted", phase)
+		if until, halted := s.exchange.HaltedUntil(orderRequest.Symbol); halted {
+			message = fmt.Sprintf("Symbol is halted by a circuit breaker until %s", until.Format(time.RFC3339))
+		}
+		rejected := orderError(orderRequest, message)
+		rejected.Reason = xmlresponse.ReasonPhase
+		rejected.Phase = string(phase)
+		response.Children = append(response.Children, rejected)
+		return
+	}
+	s.enterPhase(orderRequest.Symbol, phase)
+
+	// A call auction only collects orders that can wait for the uncross
+	if (orderType == database.OrderTypeMarket || (tif != "" && !database.TimeInForceRests(tif))) &&
+		s.exchange.InAuction(orderRequest.Symbol) {
+		response.Children = append(response.Children, orderError(orderRequest,
+			"Symbol is in a call auction, only resting limit orders are accepted"))
+		return
+	}
+
+	// The symbol's trading rules come before any funds are touched
+	errorMsg = s.checkSymbolRules(orderRequest.Symbol, orderType, amount, orderRequest.LimitPrice,
+		orderRequest.StopPrice, orderRequest.Display)
+	if errorMsg != "" {
+		response.Children = append(response.Children, orderError(orderRequest, errorMsg))
+		return
+	}
+
+	// Market sells take any price, market buys are reserved at the protection price.
+	// Stop buys are protected relative to their stop price since they trigger there.
+	price := orderRequest.LimitPrice
+	switch orderType {
+	case database.OrderTypeMarket:
+		price = decimal.Zero
+		if isBuy {
+			protectionPrice, err := s.exchange.MarketProtectionPrice(orderRequest.Symbol)
+			if err != nil {
+				response.Children = append(response.Children, orderError(orderRequest, err.Error()))
+				return
+			}
+			price = protectionPrice
+		}
+	case database.OrderTypeStop:
+		price = decimal.Zero
+		if isBuy {
+			price = s.exchange.ProtectionPrice(orderRequest.StopPrice)
+		}
+	}
+
+	// GTD orders bring their expire time, DAY orders last until the cutoff
+	var expireTime int64
+	switch tif {
+	case database.TimeInForceGTD:
+		expireTime = time.Unix(orderRequest.ExpireTime, 0).UnixNano()
+	case database.TimeInForceDay:
+		expireTime = s.dayEnd(time.Now()).UnixNano()
+	}
 
 	// Validate and reserve funds/shares
-	errorMsg := s.validateAndReserve(account, orderRequest.Symbol, amount, orderRequest.LimitPrice, isBuy)
+	reserved, errorMsg := s.validateAndReserve(account, orderID, orderRequest.Symbol, amount, price, isBuy)
 
 	// If there was an error, add it to response and continue
 	if errorMsg != "" {
-		response.Children = append(response.Children, xmlresponse.Error{
-			Symbol:  orderRequest.Symbol,
-			Amount:  float64(orderRequest.Amount),
-			Limit:   float64(orderRequest.LimitPrice.InexactFloat64()),
-			Message: errorMsg,
-		})
+		response.Children = append(response.Children, orderError(orderRequest, errorMsg))
 		return
 	}
 
 	// Place the order in the exchange
-	err := s.exchange.PlaceOrder(orderID, account.ID, orderRequest.Symbol, amount, orderRequest.LimitPrice)
+	err := s.exchange.SubmitOrder(&database.Order{
+		ID:          orderID,
+		AccountID:   account.ID,
+		Symbol:      orderRequest.Symbol,
+		Amount:      amount,
+		Price:       price,
+		OrderType:   orderType,
+		TimeInForce: tif,
+		StopPrice:   orderRequest.StopPrice,
+		Display:     orderRequest.Display,
+		STPMode:     strings.ToUpper(orderRequest.STP),
+		STPGroup:    orderRequest.STPGroup,
+		PostOnly:    orderRequest.PostOnlyMode(),
+		ExpireTime:  expireTime,
+		FeeBps:      reserved.feeBps,
+	})
+	if errors.Is(err, exchange.ErrPostOnlyWouldCross) {
+		// The exchange already canceled it and gave the reservation back
+		s.commitJournal(reserved.seq, err.Error())
+		s.refreshAccount(account.ID)
+		rejected := orderError(orderRequest, err.Error())
+		rejected.Reason = xmlresponse.ReasonPostOnly
+		response.Children = append(response.Children, rejected)
+		return
+	}
 	if err != nil {
 		s.logger.Printf("Failed to place order: %v", err)
-		response.Children = append(response.Children, xmlresponse.Error{
-			Symbol:  orderRequest.Symbol,
-			Amount:  float64(orderRequest.Amount),
-			Limit:   float64(orderRequest.LimitPrice.InexactFloat64()),
-			Message: "Failed to place order",
-		})
+		s.releaseReservation(reserved)
+		s.refreshAccount(account.ID)
+		response.Children = append(response.Children, orderError(orderRequest, "Failed to place order"))
 		return
 	}
+	s.commitJournal(reserved.seq, "")
 
 	// Add success response
-	response.Children = append(response.Children, xmlresponse.Opened{
+	opened := xmlresponse.Opened{
 		Symbol: orderRequest.Symbol,
-		Amount: float64(orderRequest.Amount),
-		Limit:  float64(orderRequest.LimitPrice.InexactFloat64()),
+		Amount: orderRequest.Amount,
+		Limit:  xmlresponse.Optional(orderRequest.LimitPrice),
 		ID:     orderID,
-	})
+		Phase:  string(phase),
+	}
+	opened.Display = xmlresponse.Optional(orderRequest.Display)
+	if expireTime != 0 {
+		opened.Expire = time.Unix(0, expireTime).Unix()
+	}
+	if postOnly := orderRequest.PostOnlyMode(); postOnly != "" {
+		opened.PostOnly = postOnly
+		if postOnly == database.PostOnlyReprice {
+			// Report the price it actually rests at
+			if order, _, err := s.exchange.GetOrderStatus(orderID); err == nil {
+				opened.Limit = xmlresponse.Optional(order.Price)
+			}
+		}
+	}
+	if orderType != database.OrderTypeLimit {
+		opened.Type = orderType
+		opened.Stop = xmlresponse.Optional(orderRequest.StopPrice)
+		if orderType != database.OrderTypeStopLimit {
+			opened.Limit = nil
+		}
+	}
+	if orderType != database.OrderTypeLimit || (tif != "" && !database.TimeInForceRests(tif)) {
+		s.addImmediateResults(&opened, orderID)
+	}
 
-	s.logger.Printf("Successfully created order %s for %s %s at %s",
-		orderID, amount.String(), orderRequest.Symbol, orderRequest.LimitPrice.String())
+	// The exchange may have canceled and refunded part of the order on its own,
+	// because of its time in force or self-trade prevention
+	s.refreshAccount(account.ID)
+	response.Children = append(response.Children, opened)
+
+	s.logger.Printf("Successfully created %s order %s for %s %s at %s",
+		orderType, orderID, amount.String(), orderRequest.Symbol, price.String())
 }
 
 func (s *Server) processQuery(query *xmlparser.Query, response *xmlresponse.Results) {
@@ -309,6 +658,7 @@ func (s *Server) processQuery(query *xmlparser.Query, response *xmlresponse.Resu
 
 	// Convert to response format
 	status := createStatusResponse(query.ID, order, executions)
+	status.Phase = string(s.phase(order.Symbol))
 
 	// Add to response
 	response.Children = append(response.Children, status)
@@ -318,9 +668,33 @@ func (s *Server) processQuery(query *xmlparser.Query, response *xmlresponse.Resu
 func (s *Server) processCancel(cancel *xmlparser.Cancel, response *xmlresponse.Results) {
 	s.logger.Printf("Processing cancel for order: %s", cancel.ID)
 
+	// Closed symbols keep their book as it is
+	current, _, err := s.exchange.GetOrderStatus(cancel.ID)
+	if err == nil {
+		if phase := s.phase(current.Symbol); !phase.AcceptsCancels() {
+			response.Children = append(response.Children, xmlresponse.Error{
+				ID:      cancel.ID,
+				Reason:  xmlresponse.ReasonPhase,
+				Phase:   string(phase),
+				Message: fmt.Sprintf("Symbol is %s, cancels are not accepted", phase),
+			})
+			return
+		}
+	}
+
+	seq, err := s.beginJournal(journal.OpCancel, journal.CancelEntry{OrderID: cancel.ID})
+	if err != nil {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      cancel.ID,
+			Message: "Failed to journal cancel",
+		})
+		return
+	}
+
 	// Cancel the order in the exchange
-	err := s.exchange.CancelOrder(cancel.ID)
+	err = s.exchange.CancelOrder(cancel.ID)
 	if err != nil {
+		s.abortJournal(seq, err.Error())
 		s.logger.Printf("Failed to cancel order: %v", err)
 		response.Children = append(response.Children, xmlresponse.Error{
 			ID:      cancel.ID,
@@ -328,6 +702,7 @@ func (s *Server) processCancel(cancel *xmlparser.Cancel, response *xmlresponse.R
 		})
 		return
 	}
+	s.commitJournal(seq, "")
 
 	// Get updated order status
 	order, executions, err := s.exchange.GetOrderStatus(cancel.ID)
@@ -342,6 +717,7 @@ func (s *Server) processCancel(cancel *xmlparser.Cancel, response *xmlresponse.R
 
 	// Create canceled response
 	canceled := createCanceledResponse(cancel.ID, order, executions)
+	canceled.Phase = string(s.phase(order.Symbol))
 
 	// Add to response
 	response.Children = append(response.Children, canceled)
@@ -352,7 +728,7 @@ func (s *Server) processCancel(cancel *xmlparser.Cancel, response *xmlresponse.R
 		// Refund money to the account
 		s.accountsMutex.Lock()
 		if account, exists := s.accounts[order.AccountID]; exists {
-			refundAmount := order.Remaining.Mul(order.Price)
+			refundAmount := exchange.BuyReservation(order.Remaining, order.Price, order.FeeBps)
 			account.Balance = account.Balance.Add(refundAmount)
 			s.logger.Printf("Updated in-memory balance for account %s after buy order cancelation", order.AccountID)
 		}
@@ -371,3 +747,249 @@ func (s *Server) processCancel(cancel *xmlparser.Cancel, response *xmlresponse.R
 		s.accountsMutex.Unlock()
 	}
 }
+
+func (s *Server) processReplace(replace *xmlparser.Replace, account *AccountNode, response *xmlresponse.Results) {
+	s.logger.Printf("Processing replace for order: %s", replace.ID)
+
+	replaceError := func(msg string) {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      replace.ID,
+			Amount:  replace.Amount,
+			Limit:   replace.LimitPrice,
+			Message: msg,
+		})
+	}
+
+	if replace.Amount.IsZero() {
+		replaceError("Replace amount cannot be zero, use cancel instead")
+		return
+	}
+	if replace.LimitPrice.IsNegative() {
+		replaceError("Limit price cannot be negative")
+		return
+	}
+
+	// The side of an order cannot change
+	current, _, err := s.exchange.GetOrderStatus(replace.ID)
+	if err != nil {
+		replaceError(err.Error())
+		return
+	}
+	if current.Amount.IsPositive() != replace.Amount.IsPositive() {
+		replaceError("Replace cannot change the side of an order")
+		return
+	}
+	phase := s.phase(current.Symbol)
+	if !phase.AcceptsOrders() {
+		replaceError(fmt.Sprintf("Symbol is %s, replaces are not accepted", phase))
+		return
+	}
+	s.enterPhase(current.Symbol, phase)
+	limitPrice := replace.LimitPrice
+	if limitPrice.IsZero() {
+		limitPrice = current.Price
+	}
+	errorMsg := s.checkSymbolRules(current.Symbol, current.OrderType, replace.Amount, limitPrice,
+		decimal.Zero, decimal.Zero)
+	if errorMsg != "" {
+		replaceError(errorMsg)
+		return
+	}
+
+	seq, err := s.beginJournal(journal.OpReplace, journal.ReplaceEntry{
+		OrderID: replace.ID,
+		Amount:  replace.Amount,
+		Limit:   replace.LimitPrice,
+	})
+	if err != nil {
+		replaceError("Failed to journal replace")
+		return
+	}
+
+	remaining := replace.Amount.Abs()
+	old, kept, err := s.exchange.ReplaceOrder(replace.ID, account.ID, remaining, replace.LimitPrice)
+	if err != nil {
+		s.abortJournal(seq, err.Error())
+		s.logger.Printf("Failed to replace order: %v", err)
+		replaceError(err.Error())
+		return
+	}
+	s.commitJournal(seq, "")
+
+	// Reservations changed in the database
+	s.refreshAccount(account.ID)
+
+	order, executions, err := s.exchange.GetOrderStatus(replace.ID)
+	if err != nil {
+		replaceError(fmt.Sprintf("Order was replaced but error retrieving status: %v", err))
+		return
+	}
+
+	replaced := xmlresponse.Replaced{
+		ID:       replace.ID,
+		Symbol:   order.Symbol,
+		Priority: "lost",
+		Phase:    string(phase),
+		Old: xmlresponse.ReplacedState{
+			Shares: old.Remaining,
+			Limit:  old.Price,
+		},
+		New: xmlresponse.ReplacedState{
+			Shares: remaining,
+			Limit:  order.Price,
+		},
+	}
+	if kept {
+		replaced.Priority = "kept"
+	}
+
+	// Only a re-queued order can trade, and only after its new priority time
+	for _, exec := range executions {
+		if kept || exec.Timestamp < order.PriorityTime {
+			continue
+		}
+		replaced.Executed = append(replaced.Executed, executedResponse(exec))
+	}
+
+	response.Children = append(response.Children, replaced)
+	s.logger.Printf("Successfully replaced order %s, priority %s", replace.ID, replaced.Priority)
+}
+
+// process indicative ele, the price the symbol's call auction would uncross at
+func (s *Server) processIndicative(indicative *xmlparser.Indicative, response *xmlresponse.Results) {
+	s.logger.Printf("Processing indicative auction query for symbol: %s", indicative.Symbol)
+
+	result, err := s.exchange.IndicativeAuction(indicative.Symbol)
+	if err != nil {
+		response.Children = append(response.Children, xmlresponse.Error{
+			Symbol:  indicative.Symbol,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response.Children = append(response.Children, xmlresponse.Auction{
+		Symbol:    result.Symbol,
+		Price:     result.Price,
+		Volume:    result.Volume,
+		Imbalance: result.Imbalance,
+	})
+}
+
+// book depths
+const (
+	defaultBookDepth = 10
+	maxBookDepth     = 100
+)
+
+// process book ele, the aggregated price levels of a symbol
+func (s *Server) processBook(book *xmlparser.Book, response *xmlresponse.Results) {
+	s.logger.Printf("Processing book query for symbol: %s", book.Symbol)
+
+	depth := book.Depth
+	if depth == 0 {
+		depth = defaultBookDepth
+	}
+	if depth < 0 || depth > maxBookDepth {
+		response.Children = append(response.Children, xmlresponse.Error{
+			Symbol:  book.Symbol,
+			Message: fmt.Sprintf("Depth must be between 1 and %d", maxBookDepth),
+		})
+		return
+	}
+
+	snapshot, err := s.exchange.Book(book.Symbol, depth)
+	if err != nil {
+		response.Children = append(response.Children, xmlresponse.Error{
+			Symbol:  book.Symbol,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result := xmlresponse.Book{Symbol: snapshot.Symbol}
+	if bid, ok := snapshot.BestBid(); ok {
+		result.Bid = &bid
+	}
+	if ask, ok := snapshot.BestAsk(); ok {
+		result.Ask = &ask
+	}
+	if spread, ok := snapshot.Spread(); ok {
+		result.Spread = &spread
+	}
+	for _, level := range snapshot.Bids {
+		result.Bids = append(result.Bids, xmlresponse.BookLevel{Price: level.Price, Shares: level.Shares, Orders: level.Orders})
+	}
+	for _, level := range snapshot.Asks {
+		result.Asks = append(result.Asks, xmlresponse.BookLevel{Price: level.Price, Shares: level.Shares, Orders: level.Orders})
+	}
+	response.Children = append(response.Children, result)
+}
+
+// process mass_cancel ele, cancels the account's orders in bulk
+func (s *Server) processMassCancel(massCancel *xmlparser.MassCancel, account *AccountNode, response *xmlresponse.Results) {
+	s.logger.Printf("Processing mass cancel for account: %s", account.ID)
+
+	side := strings.ToLower(massCancel.Side)
+	if side != "" && side != "buy" && side != "sell" {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Symbol:  massCancel.Symbol,
+			Message: "Side must be buy or sell",
+		})
+		return
+	}
+
+	// Closed symbols keep their book as it is
+	skip := func(symbol string) error {
+		if phase := s.phase(symbol); !phase.AcceptsCancels() {
+			return fmt.Errorf("Symbol is %s, cancels are not accepted", phase)
+		}
+		return nil
+	}
+
+	seq, err := s.beginJournal(journal.OpMassCancel, journal.MassCancelEntry{
+		AccountID: account.ID,
+		Symbol:    massCancel.Symbol,
+		Side:      side,
+	})
+	if err != nil {
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Symbol:  massCancel.Symbol,
+			Message: "Failed to journal mass cancel",
+		})
+		return
+	}
+
+	results, err := s.exchange.MassCancel(account.ID, massCancel.Symbol, side, skip)
+	if err != nil {
+		s.abortJournal(seq, err.Error())
+		s.logger.Printf("Failed to mass cancel: %v", err)
+		response.Children = append(response.Children, xmlresponse.Error{
+			ID:      account.ID,
+			Symbol:  massCancel.Symbol,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	massCanceled := xmlresponse.MassCanceled{}
+	for _, result := range results {
+		order := xmlresponse.MassCanceledOrder{ID: result.OrderID, Symbol: result.Symbol}
+		if result.Err != nil {
+			order.Error = result.Err.Error()
+		} else {
+			canceled := result.Canceled
+			order.Canceled = &canceled
+			massCanceled.Count++
+		}
+		massCanceled.Orders = append(massCanceled.Orders, order)
+	}
+	response.Children = append(response.Children, massCanceled)
+	s.commitJournal(seq, fmt.Sprintf("%d canceled", massCanceled.Count))
+
+	// Refunds went to the database in bulk
+	s.refreshAccount(account.ID)
+	s.logger.Printf("Mass canceled %d orders of account %s", massCanceled.Count, account.ID)
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"StockOverflow/internal/journal"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// What became of a journaled command, settled from the store
+const (
+	OutcomeCompleted  = "completed"   // all of its changes are in the store
+	OutcomeRolledBack = "rolled back" // what it had changed was undone
+	OutcomeNotApplied = "not applied" // none of its changes are in the store
+	OutcomeUnresolved = "unresolved"  // the store doesn't tell, left to an operator
+)
+
+// Recovered is what recovery made of a command the journal had open
+type Recovered struct {
+	Seq     uint64
+	Op      string
+	Outcome string
+	Detail  string
+}
+
+// reservation is what validateAndReserve took for an order, journaled as seq
+type reservation struct {
+	seq    uint64
+	entry  journal.OrderEntry
+	feeBps decimal.Decimal // rate a buy's fees were reserved at
+}
+
+// SetJournal sets the journal accepted commands are written to
+func (s *Server) SetJournal(j *journal.Journal) {
+	s.journal = j
+}
+
+// RecoverJournal settles the commands a crash left open in the journal and
+// reports what became of each. It runs before the server takes connections,
+// the in-memory accounts and books are then loaded from the settled store.
+func (s *Server) RecoverJournal() ([]Recovered, error) {
+	if s.journal == nil {
+		return nil, nil
+	}
+	if s.journal.Repaired() {
+		s.logger.Println("Journal ended in a torn record, it was cut off")
+	}
+
+	var recovered []Recovered
+	for _, record := range s.journal.Pending() {
+		outcome, detail, err := s.settle(&record)
+		if err != nil {
+			return recovered, fmt.Errorf("error recovering %s #%d: %v", record.Op, record.Seq, err)
+		}
+
+		note := outcome
+		if detail != "" {
+			note += ": " + detail
+		}
+		if err := s.journal.Resolve(record.Seq, note); err != nil {
+			return recovered, err
+		}
+		s.logger.Printf("Recovered %s #%d, %s", record.Op, record.Seq, note)
+		recovered = append(recovered, Recovered{Seq: record.Seq, Op: record.Op, Outcome: outcome, Detail: detail})
+	}
+	return recovered, nil
+}
+
+// settle works out from the store what became of a journaled command and finishes or undoes it
+func (s *Server) settle(record *journal.Record) (string, string, error) {
+	switch record.Op {
+	case journal.OpOrder:
+		var entry journal.OrderEntry
+		if err := record.Decode(&entry); err != nil {
+			return "", "", err
+		}
+		return s.settleOrder(&entry)
+	case journal.OpCreateAccount:
+		var entry journal.CreateAccountEntry
+		if err := record.Decode(&entry); err != nil {
+			return "", "", err
+		}
+		return s.settleCreateAccount(&entry)
+	case journal.OpCancel:
+		var entry journal.CancelEntry
+		if err := record.Decode(&entry); err != nil {
+			return "", "", err
+		}
+		return s.settleCancel(&entry)
+	case journal.OpReplace:
+		var entry journal.ReplaceEntry
+		if err := record.Decode(&entry); err != nil {
+			return "", "", err
+		}
+		return s.settleReplace(&entry)
+	case journal.OpMassCancel:
+		var entry journal.MassCancelEntry
+		if err := record.Decode(&entry); err != nil {
+			return "", "", err
+		}
+		return s.settleMassCancel(&entry)
+	}
+	return OutcomeUnresolved, "unknown command", nil
+}
+
+// settleOrder finishes an order if the exchange wrote it, otherwise gives its
+// reservation back. The balance or position still at what the reservation
+// left tells it was taken.
+func (s *Server) settleOrder(entry *journal.OrderEntry) (string, string, error) {
+	if order, err := s.store.GetOrder(entry.OrderID); err == nil {
+		return OutcomeCompleted, fmt.Sprintf("order %s is %s", entry.OrderID, order.Status), nil
+	}
+
+	held, what := decimal.Zero, "position in "+entry.Symbol
+	if entry.Buy {
+		account, err := s.store.GetAccount(entry.AccountID)
+		if err != nil {
+			return "", "", err
+		}
+		held, what = account.Balance, "balance"
+	} else if position, err := s.store.GetPosition(entry.AccountID, entry.Symbol); err == nil {
+		held = position.Amount
+	}
+
+	after := entry.Before.Sub(entry.Reserved)
+	switch {
+	case held.Equal(after):
+		var err error
+		if entry.Buy {
+			err = s.store.UpdateAccountBalance(entry.AccountID, held.Add(entry.Reserved))
+		} else {
+			err = s.store.CreateOrUpdatePosition(entry.AccountID, entry.Symbol, held.Add(entry.Reserved))
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return OutcomeRolledBack, fmt.Sprintf("order %s was never written, %s of %s returned to account %s",
+			entry.OrderID, entry.Reserved.String(), what, entry.AccountID), nil
+	case held.Equal(entry.Before):
+		return OutcomeNotApplied, fmt.Sprintf("order %s was never reserved", entry.OrderID), nil
+	}
+	return OutcomeUnresolved, fmt.Sprintf("order %s was never written, %s of account %s is %s, expected %s or %s",
+		entry.OrderID, what, entry.AccountID, held.String(), entry.Before.String(), after.String()), nil
+}
+
+// settleCreateAccount writes the settings of an account that was created
+func (s *Server) settleCreateAccount(entry *journal.CreateAccountEntry) (string, string, error) {
+	if _, err := s.store.GetAccount(entry.AccountID); err != nil {
+		return OutcomeNotApplied, fmt.Sprintf("account %s was never created", entry.AccountID), nil
+	}
+	if entry.STPMode != "" {
+		if err := s.store.SetAccountSTPMode(entry.AccountID, entry.STPMode); err != nil {
+			return "", "", err
+		}
+	}
+	if entry.FeeTier != "" {
+		if err := s.store.SetAccountFeeTier(entry.AccountID, entry.FeeTier); err != nil {
+			return "", "", err
+		}
+	}
+	return OutcomeCompleted, fmt.Sprintf("account %s", entry.AccountID), nil
+}
+
+// settleCancel reports whether a cancel went through, the exchange cancels in one transaction
+func (s *Server) settleCancel(entry *journal.CancelEntry) (string, string, error) {
+	order, err := s.store.GetOrder(entry.OrderID)
+	if err != nil {
+		return OutcomeNotApplied, fmt.Sprintf("order %s not found", entry.OrderID), nil
+	}
+	if order.Status == "canceled" {
+		return OutcomeCompleted, fmt.Sprintf("order %s is canceled", entry.OrderID), nil
+	}
+	return OutcomeNotApplied, fmt.Sprintf("order %s is %s", entry.OrderID, order.Status), nil
+}
+
+// settleReplace reports whether a replace went through, the exchange replaces in one transaction
+func (s *Server) settleReplace(entry *journal.ReplaceEntry) (string, string, error) {
+	order, err := s.store.GetOrder(entry.OrderID)
+	if err != nil {
+		return OutcomeNotApplied, fmt.Sprintf("order %s not found", entry.OrderID), nil
+	}
+
+	state := fmt.Sprintf("order %s is %s with %s left at %s",
+		entry.OrderID, order.Status, order.Remaining.String(), order.Price.String())
+	if order.Remaining.Equal(entry.Amount.Abs()) && (entry.Limit.IsZero() || order.Price.Equal(entry.Limit)) {
+		return OutcomeCompleted, state, nil
+	}
+	// a replaced order may have traded since
+	return OutcomeUnresolved, state, nil
+}
+
+// settleMassCancel reports whether any of the orders a mass cancel was after are still open
+func (s *Server) settleMassCancel(entry *journal.MassCancelEntry) (string, string, error) {
+	orders, err := s.store.GetOpenOrdersByAccount(entry.AccountID)
+	if err != nil {
+		return "", "", err
+	}
+
+	open := 0
+	for _, order := range orders {
+		if entry.Symbol != "" && order.Symbol != entry.Symbol {
+			continue
+		}
+		if entry.Side != "" && (entry.Side == "buy") != order.Amount.IsPositive() {
+			continue
+		}
+		open++
+	}
+	if open == 0 {
+		return OutcomeCompleted, fmt.Sprintf("no orders of account %s left open", entry.AccountID), nil
+	}
+	// each symbol is canceled in its own transaction, some may have been
+	return OutcomeUnresolved, fmt.Sprintf("%d orders of account %s still open", open, entry.AccountID), nil
+}
+
+// beginJournal records an accepted command before any of its changes
+func (s *Server) beginJournal(op string, entry any) (uint64, error) {
+	seq, err := s.journal.Begin(op, entry)
+	if err != nil {
+		s.logger.Printf("Failed to journal %s: %v", op, err)
+	}
+	return seq, err
+}
+
+// commitJournal records that a journaled command is complete
+func (s *Server) commitJournal(seq uint64, note string) {
+	if err := s.journal.Commit(seq, note); err != nil {
+		s.logger.Printf("Warning: Failed to commit journal record %d: %v", seq, err)
+	}
+}
+
+// abortJournal records that a journaled command changed nothing
+func (s *Server) abortJournal(seq uint64, note string) {
+	if err := s.journal.Abort(seq, note); err != nil {
+		s.logger.Printf("Warning: Failed to abort journal record %d: %v", seq, err)
+	}
+}
+
+// releaseReservation settles an order the exchange failed on, giving back its
+// reservation unless the order was written after all
+func (s *Server) releaseReservation(reserved *reservation) {
+	outcome, detail, err := s.settleOrder(&reserved.entry)
+	switch {
+	case err != nil:
+		s.logger.Printf("Failed to release reservation of order %s, left to recovery: %v", reserved.entry.OrderID, err)
+	case outcome == OutcomeCompleted:
+		s.commitJournal(reserved.seq, detail)
+	case outcome == OutcomeUnresolved:
+		s.logger.Printf("Reservation of order %s left to recovery: %s", reserved.entry.OrderID, detail)
+	default:
+		s.abortJournal(reserved.seq, detail)
+	}
+}
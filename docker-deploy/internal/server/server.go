@@ -3,8 +3,11 @@ package server
 import (
 	"StockOverflow/internal/database"
 	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/journal"
 	"StockOverflow/internal/pool"
+	"StockOverflow/internal/session"
 	"StockOverflow/pkg/xmlparser"
+	"StockOverflow/pkg/xmlresponse"
 	"bufio"
 	"database/sql"
 	"fmt"
@@ -14,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
@@ -29,14 +33,21 @@ type AccountNode struct {
 // Server represents the exchange server
 type Server struct {
 	// Server configuration
-	listener    net.Listener
-	logger      *log.Logger
-	wg          sync.WaitGroup
-	connections map[net.Conn]struct{}
-	mutex       sync.Mutex
+	listener      net.Listener
+	adminListener net.Listener // nil unless admin requests are served
+	logger        *log.Logger
+	wg            sync.WaitGroup
+	connections   map[net.Conn]struct{}
+	mutex         sync.Mutex
 
-	// Database connection
-	db *sql.DB
+	// Storage, Postgres or in memory
+	store database.Store
+
+	// Journal of accepted commands, nil when there is none
+	journal *journal.Journal
+
+	// Event log and the state folded from it, nil when there is none
+	events *eventSourcing
 
 	// Exchange state
 	stockPool   *pool.StockPool         // Stock trading nodes
@@ -44,6 +55,16 @@ type Server struct {
 	nextOrderID int                     // For generating unique order IDs
 	exchange    *exchange.Exchange      // Exchange engine for matching orders
 
+	// Expiry of GTD and DAY orders
+	dayCutoff  time.Duration // time of day DAY orders expire at, from local midnight
+	stopExpiry chan struct{} // closed to stop the expiry scheduler
+
+	// Trading phases of the symbols
+	calendar    *session.Calendar
+	phases      map[string]session.Phase // phase each symbol was last moved into
+	phasesMutex sync.Mutex
+	stopSession chan struct{} // closed to stop the session scheduler
+
 	// Mutexes for concurrent access
 	accountsMutex sync.RWMutex
 	idMutex       sync.Mutex
@@ -58,6 +79,9 @@ func NewServer(logger *log.Logger) *Server {
 		connections: make(map[net.Conn]struct{}),
 		stockPool:   stockPool,
 		accounts:    make(map[string]*AccountNode),
+		dayCutoff:   defaultDayCutoff,
+		calendar:    session.NewCalendar(nil),
+		phases:      make(map[string]session.Phase),
 	}
 
 	return server
@@ -65,10 +89,16 @@ func NewServer(logger *log.Logger) *Server {
 
 // SetDB sets the database connection and initializes the exchange
 func (s *Server) SetDB(db *sql.DB) {
-	s.db = db
-	s.exchange = exchange.NewExchange(db, s.stockPool, s.logger)
+	s.SetStore(database.NewSQLStore(db))
+}
+
+// SetStore sets the storage and initializes the exchange
+func (s *Server) SetStore(store database.Store) {
+	// the server writes through the exchange's store so its changes are events too
+	s.exchange = exchange.NewExchange(store, s.stockPool, s.logger)
+	s.store = s.exchange.Store()
 	// Initialize nextOrderID from database
-	maxID, err := database.GetMaxOrderID(db)
+	maxID, err := store.GetMaxOrderID()
 	if err != nil {
 		s.logger.Printf("Warning: Failed to get max order ID from database: %v", err)
 		// Fall back to default if there's an error
@@ -88,17 +118,47 @@ func (s *Server) SetDB(db *sql.DB) {
 
 // Start begins listening for connections on the specified address
 func (s *Server) Start(addr string) error {
-	var err error
-	s.listener, err = net.Listen("tcp", addr)
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to start listener: %v", err)
 	}
 
 	s.logger.Printf("Server listening on %s", addr)
+	return s.Serve(listener)
+}
+
+// StartAdmin begins listening for admin connections on the specified address.
+// Phase changes, auctions and fee tiers are only accepted there.
+func (s *Server) StartAdmin(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin listener: %v", err)
+	}
+
+	s.logger.Printf("Admin listening on %s", addr)
+	return s.ServeAdmin(listener)
+}
+
+// Serve accepts trading connections on listener until the server is stopped
+func (s *Server) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	s.listener = listener
+	s.mutex.Unlock()
+	return s.accept(listener, false)
+}
+
+// ServeAdmin accepts admin connections on listener until the server is stopped
+func (s *Server) ServeAdmin(listener net.Listener) error {
+	s.mutex.Lock()
+	s.adminListener = listener
+	s.mutex.Unlock()
+	return s.accept(listener, true)
+}
 
-	// Accept connections in a loop
+// accept handles the connections of a listener in a loop
+func (s *Server) accept(listener net.Listener, admin bool) error {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			// Check if the listener was closed
 			if strings.Contains(err.Error(), "use of closed network connection") {
@@ -125,13 +185,14 @@ func (s *Server) Start(addr string) error {
 				c.Close()
 			}()
 
-			s.handleConnection(c)
+			s.handleConnection(c, admin)
 		}(conn)
 	}
 }
 
-// handleConnection processes a single client connection
-func (s *Server) handleConnection(conn net.Conn) {
+// handleConnection processes a single client connection,
+// an admin connection takes admin requests and nothing else
+func (s *Server) handleConnection(conn net.Conn, admin bool) {
 	reader := bufio.NewReader(conn)
 
 	// Keep handling messages until connection is closed
@@ -179,6 +240,10 @@ func (s *Server) handleConnection(conn net.Conn) {
 		var response []byte
 		switch xmlType.Name() {
 		case "Create":
+			if admin {
+				response, err = portError("Trading requests are not accepted on the admin port")
+				break
+			}
 			createData, ok := parsedXML.(xmlparser.Create)
 			if !ok {
 				s.logger.Printf("Error: Failed to cast to Create type")
@@ -186,12 +251,27 @@ func (s *Server) handleConnection(conn net.Conn) {
 			}
 			response, err = s.handleCreate(createData)
 		case "Transaction":
+			if admin {
+				response, err = portError("Trading requests are not accepted on the admin port")
+				break
+			}
 			transactionData, ok := parsedXML.(xmlparser.Transaction)
 			if !ok {
 				s.logger.Printf("Error: Failed to cast to Transaction type")
 				continue // Try to read the next message
 			}
 			response, err = s.handleTransactions(transactionData)
+		case "Admin":
+			if !admin {
+				response, err = portError("Admin requests are only accepted on the admin port")
+				break
+			}
+			adminData, ok := parsedXML.(xmlparser.Admin)
+			if !ok {
+				s.logger.Printf("Error: Failed to cast to Admin type")
+				continue // Try to read the next message
+			}
+			response, err = s.handleAdmin(adminData)
 		default:
 			s.logger.Printf("Unknown XML type: %s", xmlType.Name())
 			continue // Try to read the next message
@@ -212,6 +292,13 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
+// portError answers a request sent to the wrong listener
+func portError(message string) ([]byte, error) {
+	return marshalResponse(xmlresponse.Results{
+		Children: []any{xmlresponse.Error{Message: message}},
+	})
+}
+
 // generateOrderID creates a unique order ID
 func (s *Server) generateOrderID() string {
 	s.idMutex.Lock()
@@ -225,11 +312,29 @@ func (s *Server) generateOrderID() string {
 
 // Stop gracefully shuts down the server
 func (s *Server) Stop() error {
-	if s.listener != nil {
-		if err := s.listener.Close(); err != nil {
+	s.mutex.Lock()
+	listener, adminListener := s.listener, s.adminListener
+	s.mutex.Unlock()
+	if listener != nil {
+		if err := listener.Close(); err != nil {
 			return fmt.Errorf("failed to close listener: %v", err)
 		}
 	}
+	if adminListener != nil {
+		if err := adminListener.Close(); err != nil {
+			return fmt.Errorf("failed to close admin listener: %v", err)
+		}
+	}
+
+	// Stop the expiry scheduler
+	if s.stopExpiry != nil {
+		close(s.stopExpiry)
+	}
+
+	// Stop the session scheduler
+	if s.stopSession != nil {
+		close(s.stopSession)
+	}
 
 	// Close all existing connections
 	s.mutex.Lock()
@@ -240,5 +345,15 @@ func (s *Server) Stop() error {
 
 	// Wait for all connection handlers to finish
 	s.wg.Wait()
+
+	// Nothing writes to the journal anymore
+	if err := s.journal.Close(); err != nil {
+		return fmt.Errorf("failed to close journal: %v", err)
+	}
+
+	// Nor to the event log
+	if err := s.stopEventLog(); err != nil {
+		return fmt.Errorf("failed to close event log: %v", err)
+	}
 	return nil
 }
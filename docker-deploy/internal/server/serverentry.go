@@ -2,14 +2,19 @@ package server
 
 import (
 	"StockOverflow/internal/database"
+	"StockOverflow/internal/journal"
+	"StockOverflow/internal/session"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 type ServerEntry struct{}
@@ -21,19 +26,27 @@ func (serverEntry *ServerEntry) Enter(mockDB *sql.DB) {
 	// Create and start the server
 	server := NewServer(logger)
 
-	// link to db if no mockdb
-	if mockDB == nil {
+	// link to db if no mockdb, STORE=memory runs without a database
+	// and STORE=sqlite on a database file for a single node
+	if mockDB == nil && getEnvOrDefault("STORE", "postgres") == "memory" {
+		logger.Println("Using in-memory store, nothing is persisted")
+		server.SetStore(database.NewMemoryStore())
+
+	} else if mockDB == nil {
 		// Initialize database connection
-		dbm := database.DatabaseMaster{
-			ConnStr: GetDBConnStr(),
-			DbName:  getEnvOrDefault("DB_NAME", "stockoverflow"),
-		}
+		dbm := GetDatabaseMaster()
 
 		// Connect to database
 		logger.Println("Connecting to database...")
 		dbm.Connect()
 		dbm.CreateDB()
-		dbm.Init()
+
+		// migrate on start, or leave it to the migrate command and only check
+		if getEnvOrDefault("AUTO_MIGRATE", "true") == "true" {
+			dbm.Init()
+		} else if err := database.CheckSchemaVersion(dbm.Db); err != nil {
+			logger.Fatalf("Refusing to start: %v", err)
+		}
 		server.SetDB(dbm.Db)
 
 	} else {
@@ -41,6 +54,119 @@ func (serverEntry *ServerEntry) Enter(mockDB *sql.DB) {
 		server.SetDB(mockDB)
 	}
 
+	// event log of every change, folded into a state snapshotted every SNAPSHOT_EVERY events.
+	// It starts before recovery so what recovery changes is in it too.
+	if path := os.Getenv("EVENT_LOG"); path != "" && mockDB == nil {
+		if getEnvOrDefault("STORE", "postgres") == "memory" {
+			logger.Fatalf("EVENT_LOG needs a store that survives a restart, not STORE=memory")
+		}
+		policy, ok := journal.ParseSyncPolicy(getEnvOrDefault("EVENT_LOG_FSYNC", "interval"))
+		if !ok {
+			logger.Fatalf("Invalid EVENT_LOG_FSYNC: %v", getEnvOrDefault("EVENT_LOG_FSYNC", "interval"))
+		}
+		syncInterval, err := time.ParseDuration(getEnvOrDefault("EVENT_LOG_FSYNC_INTERVAL", "100ms"))
+		if err != nil || syncInterval <= 0 {
+			logger.Fatalf("Invalid EVENT_LOG_FSYNC_INTERVAL: %v", getEnvOrDefault("EVENT_LOG_FSYNC_INTERVAL", "100ms"))
+		}
+		every, err := strconv.ParseUint(getEnvOrDefault("SNAPSHOT_EVERY", "10000"), 10, 64)
+		if err != nil {
+			logger.Fatalf("Invalid SNAPSHOT_EVERY: %v", getEnvOrDefault("SNAPSHOT_EVERY", "10000"))
+		}
+
+		if err := server.StartEventLog(path, policy, syncInterval, getEnvOrDefault("SNAPSHOT_DIR", "snapshots"), every); err != nil {
+			logger.Fatalf("Failed to start event log: %v", err)
+		}
+	}
+
+	// journal of accepted commands, what a crash left half done is settled before serving
+	if path := os.Getenv("JOURNAL_PATH"); path != "" && mockDB == nil {
+		if getEnvOrDefault("STORE", "postgres") == "memory" {
+			logger.Fatalf("JOURNAL_PATH needs a store that survives a restart, not STORE=memory")
+		}
+		policy, ok := journal.ParseSyncPolicy(getEnvOrDefault("JOURNAL_FSYNC", "always"))
+		if !ok {
+			logger.Fatalf("Invalid JOURNAL_FSYNC: %v", getEnvOrDefault("JOURNAL_FSYNC", "always"))
+		}
+		syncInterval, err := time.ParseDuration(getEnvOrDefault("JOURNAL_FSYNC_INTERVAL", "100ms"))
+		if err != nil || syncInterval <= 0 {
+			logger.Fatalf("Invalid JOURNAL_FSYNC_INTERVAL: %v", getEnvOrDefault("JOURNAL_FSYNC_INTERVAL", "100ms"))
+		}
+
+		j, err := journal.Open(path, policy, syncInterval)
+		if err != nil {
+			logger.Fatalf("Failed to open journal: %v", err)
+		}
+		server.SetJournal(j)
+
+		recovered, err := server.RecoverJournal()
+		if err != nil {
+			logger.Fatalf("Failed to recover from journal: %v", err)
+		}
+		logger.Printf("Journal %s opened, %d commands recovered", path, len(recovered))
+	}
+
+	// how far above the best ask a market buy may sweep
+	protection, err := decimal.NewFromString(getEnvOrDefault("MARKET_PROTECTION", "0.05"))
+	if err != nil {
+		logger.Fatalf("Invalid MARKET_PROTECTION: %v", err)
+	}
+	server.exchange.SetMarketProtection(protection)
+
+	// circuit breakers, off unless a band is given a width
+	collar, err := decimal.NewFromString(getEnvOrDefault("PRICE_COLLAR", "0"))
+	if err != nil {
+		logger.Fatalf("Invalid PRICE_COLLAR: %v", err)
+	}
+	band, err := decimal.NewFromString(getEnvOrDefault("VOLATILITY_BAND", "0"))
+	if err != nil {
+		logger.Fatalf("Invalid VOLATILITY_BAND: %v", err)
+	}
+	cooldown, err := time.ParseDuration(getEnvOrDefault("HALT_COOLDOWN", "5m"))
+	if err != nil || cooldown <= 0 {
+		logger.Fatalf("Invalid HALT_COOLDOWN: %v", getEnvOrDefault("HALT_COOLDOWN", "5m"))
+	}
+	server.exchange.SetPriceBands(collar, band, cooldown)
+
+	// default fees in basis points, tiers and symbols can override them
+	makerFee, err := decimal.NewFromString(getEnvOrDefault("MAKER_FEE_BPS", "0"))
+	if err != nil {
+		logger.Fatalf("Invalid MAKER_FEE_BPS: %v", err)
+	}
+	takerFee, err := decimal.NewFromString(getEnvOrDefault("TAKER_FEE_BPS", "0"))
+	if err != nil || takerFee.IsNegative() {
+		logger.Fatalf("Invalid TAKER_FEE_BPS: %v", getEnvOrDefault("TAKER_FEE_BPS", "0"))
+	}
+	// a maker rebate bigger than the taker fee pays out more than a trade brings in
+	if makerFee.Neg().GreaterThan(takerFee) {
+		logger.Fatalf("Invalid MAKER_FEE_BPS: %v, the rebate is bigger than TAKER_FEE_BPS", getEnvOrDefault("MAKER_FEE_BPS", "0"))
+	}
+	if err := server.exchange.SetFees(makerFee, takerFee, getEnvOrDefault("HOUSE_ACCOUNT", "house")); err != nil {
+		logger.Fatalf("Failed to set up fees: %v", err)
+	}
+
+	// when DAY orders expire, and how often expired orders are swept
+	cutoff, err := time.Parse("15:04", getEnvOrDefault("DAY_ORDER_CUTOFF", "16:00"))
+	if err != nil {
+		logger.Fatalf("Invalid DAY_ORDER_CUTOFF: %v", err)
+	}
+	server.SetDayCutoff(time.Duration(cutoff.Hour())*time.Hour + time.Duration(cutoff.Minute())*time.Minute)
+
+	interval, err := time.ParseDuration(getEnvOrDefault("EXPIRY_INTERVAL", "1s"))
+	if err != nil || interval <= 0 {
+		logger.Fatalf("Invalid EXPIRY_INTERVAL: %v", getEnvOrDefault("EXPIRY_INTERVAL", "1s"))
+	}
+	server.StartExpiry(interval)
+
+	// trading session schedule, without one every symbol trades around the clock
+	if times := os.Getenv("SESSION_SCHEDULE"); times != "" {
+		schedule, err := session.ParseSchedule(times, os.Getenv("SESSION_HOLIDAYS"))
+		if err != nil {
+			logger.Fatalf("Invalid SESSION_SCHEDULE: %v", err)
+		}
+		server.SetSchedule(schedule)
+	}
+	server.StartSession(interval)
+
 	// Start server in a goroutine
 	go func() {
 		logger.Println("Starting exchange server on port 12345...")
@@ -49,6 +175,16 @@ func (serverEntry *ServerEntry) Enter(mockDB *sql.DB) {
 		}
 	}()
 
+	// admin requests get a listener of their own, without ADMIN_ADDR there is none
+	if addr := os.Getenv("ADMIN_ADDR"); addr != "" {
+		go func() {
+			logger.Printf("Starting admin listener on %s...", addr)
+			if err := server.StartAdmin(addr); err != nil {
+				logger.Fatalf("Admin listener failed to start: %v", err)
+			}
+		}()
+	}
+
 	// Wait for termination signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -65,6 +201,21 @@ func (serverEntry *ServerEntry) Enter(mockDB *sql.DB) {
 	logger.Println("Server shutdown complete")
 }
 
+// GetDatabaseMaster sets up the database of STORE, a SQLite file at
+// SQLITE_PATH with STORE=sqlite and the Postgres database DB_NAME otherwise
+func GetDatabaseMaster() *database.DatabaseMaster {
+	if getEnvOrDefault("STORE", "postgres") == "sqlite" {
+		return &database.DatabaseMaster{
+			Driver: "sqlite",
+			DbName: getEnvOrDefault("SQLITE_PATH", "stockoverflow.db"),
+		}
+	}
+	return &database.DatabaseMaster{
+		ConnStr: GetDBConnStr(),
+		DbName:  getEnvOrDefault("DB_NAME", "stockoverflow"),
+	}
+}
+
 // getDBConnStr returns the database connection string from environment
 // variables or uses default values
 func GetDBConnStr() string {
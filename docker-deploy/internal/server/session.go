@@ -0,0 +1,110 @@
+package server
+
+import (
+	"StockOverflow/internal/session"
+	"time"
+)
+
+// SetSchedule puts every symbol on a daily session schedule,
+// it must be called before the server starts
+func (s *Server) SetSchedule(schedule *session.Schedule) {
+	s.calendar = session.NewCalendar(schedule)
+}
+
+// phase returns the current phase of a symbol,
+// a circuit breaker halts it even when the calendar says it trades
+func (s *Server) phase(symbol string) session.Phase {
+	phase := s.calendar.Phase(symbol, time.Now())
+	if phase.AcceptsOrders() {
+		if _, halted := s.exchange.HaltedUntil(symbol); halted {
+			return session.Halted
+		}
+	}
+	return phase
+}
+
+// StartSession starts the background scheduler that moves the symbols
+// through the phases of the schedule every interval, until the server is stopped
+func (s *Server) StartSession(interval time.Duration) {
+	s.stopSession = make(chan struct{})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		s.advancePhases()
+		for {
+			select {
+			case <-s.stopSession:
+				return
+			case <-ticker.C:
+				s.advancePhases()
+			}
+		}
+	}()
+}
+
+// advancePhases moves every known symbol into its current phase
+func (s *Server) advancePhases() {
+	symbols, err := s.store.GetSymbolNames()
+	if err != nil {
+		s.logger.Printf("Failed to load symbols: %v", err)
+		return
+	}
+
+	for _, symbol := range symbols {
+		s.enterPhase(symbol, s.phase(symbol))
+	}
+}
+
+// enterPhase runs what a symbol needs when its phase changes.
+// Pre-open collects orders in a call auction that uncrosses when trading opens.
+func (s *Server) enterPhase(symbol string, phase session.Phase) {
+	s.phasesMutex.Lock()
+	defer s.phasesMutex.Unlock()
+
+	previous, known := s.phases[symbol]
+	if known && previous == phase {
+		return
+	}
+	s.phases[symbol] = phase
+	if !known && phase == session.Continuous {
+		return
+	}
+	s.logger.Printf("Symbol %s enters phase %s", symbol, phase)
+
+	switch phase {
+	case session.PreOpen:
+		if !s.exchange.InAuction(symbol) {
+			if err := s.exchange.StartAuction(symbol); err != nil {
+				s.logger.Printf("Failed to start opening auction of %s: %v", symbol, err)
+			}
+		}
+	case session.Continuous:
+		if previous == session.PreOpen && s.exchange.InAuction(symbol) {
+			if _, err := s.exchange.Uncross(symbol); err != nil {
+				s.logger.Printf("Failed to uncross opening auction of %s: %v", symbol, err)
+				return
+			}
+			s.refreshAccounts()
+		}
+	}
+}
+
+// refreshAccounts reloads the cached accounts after the exchange changed many
+// of them at once. They are updated in place, orders in flight hold them.
+func (s *Server) refreshAccounts() {
+	s.accountsMutex.RLock()
+	ids := make([]string, 0, len(s.accounts))
+	for id := range s.accounts {
+		ids = append(ids, id)
+	}
+	s.accountsMutex.RUnlock()
+
+	for _, id := range ids {
+		s.refreshAccount(id)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/pkg/xmlparser"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// saveSymbolRules merges the trading rules of a symbol request into the stored ones
+func (s *Server) saveSymbolRules(request *xmlparser.Symbol) string {
+	rules, err := s.store.GetSymbol(request.Symbol)
+	if err != nil {
+		return fmt.Sprintf("Failed to load symbol %s: %v", request.Symbol, err)
+	}
+
+	// Rules left out keep their value
+	for _, rule := range []struct {
+		name  string
+		value decimal.Decimal
+		field *decimal.Decimal
+	}{
+		{"Lot size", request.Lot, &rules.LotSize},
+		{"Tick size", request.Tick, &rules.TickSize},
+		{"Minimum quantity", request.MinQty, &rules.MinQty},
+		{"Maximum quantity", request.MaxQty, &rules.MaxQty},
+		{"Minimum notional", request.MinNotional, &rules.MinNotional},
+	} {
+		if rule.value.IsZero() {
+			continue
+		}
+		if !rule.value.IsPositive() || !rule.value.Equal(rule.value.Round(6)) {
+			return rule.name + " must be positive with at most 6 decimal places"
+		}
+		*rule.field = rule.value
+	}
+
+	if rules.MaxQty.IsPositive() && rules.MaxQty.LessThan(rules.MinQty) {
+		return fmt.Sprintf("Maximum quantity %s is below the minimum quantity %s",
+			rules.MaxQty.String(), rules.MinQty.String())
+	}
+
+	// Fee overrides are basis points, a negative maker fee is a rebate
+	if request.TakerFee != nil && request.TakerFee.IsNegative() {
+		return "Taker fee cannot be negative"
+	}
+	if request.MakerFee != nil {
+		rules.MakerFee = decimal.NewNullDecimal(*request.MakerFee)
+	}
+	if request.TakerFee != nil {
+		rules.TakerFee = decimal.NewNullDecimal(*request.TakerFee)
+	}
+
+	if request.Matching != "" {
+		matching := strings.ToLower(request.Matching)
+		if _, err := exchange.Policy(matching); err != nil {
+			return "Unknown matching policy: " + request.Matching
+		}
+		rules.Matching = matching
+	}
+
+	err = s.store.CreateOrUpdateSymbol(rules)
+	if err != nil {
+		s.logger.Printf("Failed to save symbol %s: %v", request.Symbol, err)
+		return fmt.Sprintf("Database error: %v", err)
+	}
+
+	// The book matches the new way from the next order on
+	if err := s.exchange.SetMatchingPolicy(rules.Symbol, rules.Matching); err != nil {
+		s.logger.Printf("Failed to set matching policy of %s: %v", rules.Symbol, err)
+	}
+
+	s.logger.Printf("Trading rules of %s: lot %s, tick %s, quantity %s to %s, notional from %s, %s matching",
+		rules.Symbol, rules.LotSize.String(), rules.TickSize.String(), rules.MinQty.String(),
+		rules.MaxQty.String(), rules.MinNotional.String(), rules.Matching)
+	return ""
+}
+
+// checkSymbolRules checks an order against the trading rules of its symbol
+// and returns why it breaks them, or an empty string
+func (s *Server) checkSymbolRules(symbol string, orderType string, amount, limitPrice, stopPrice, display decimal.Decimal) string {
+	rules, err := s.store.GetSymbol(symbol)
+	if err != nil {
+		return fmt.Sprintf("Failed to load symbol %s: %v", symbol, err)
+	}
+
+	quantity := amount.Abs()
+	if !rules.LotSize.IsPositive() {
+		rules.LotSize = database.DefaultLotSize
+	}
+	if !quantity.Mod(rules.LotSize).IsZero() {
+		return fmt.Sprintf("Quantity %s is not a multiple of the lot size %s of %s",
+			quantity.String(), rules.LotSize.String(), symbol)
+	}
+	if !display.Mod(rules.LotSize).IsZero() {
+		return fmt.Sprintf("Display quantity %s is not a multiple of the lot size %s of %s",
+			display.String(), rules.LotSize.String(), symbol)
+	}
+	if quantity.LessThan(rules.MinQty) {
+		return fmt.Sprintf("Quantity %s is below the minimum order quantity %s of %s",
+			quantity.String(), rules.MinQty.String(), symbol)
+	}
+	if rules.MaxQty.IsPositive() && quantity.GreaterThan(rules.MaxQty) {
+		return fmt.Sprintf("Quantity %s is above the maximum order quantity %s of %s",
+			quantity.String(), rules.MaxQty.String(), symbol)
+	}
+
+	// Market orders have no limit price to check
+	if orderType == database.OrderTypeMarket || orderType == database.OrderTypeStop {
+		limitPrice = decimal.Zero
+	}
+	if rules.TickSize.IsPositive() {
+		if !limitPrice.Mod(rules.TickSize).IsZero() {
+			return fmt.Sprintf("Limit price %s is not a multiple of the tick size %s of %s",
+				limitPrice.String(), rules.TickSize.String(), symbol)
+		}
+		if !stopPrice.Mod(rules.TickSize).IsZero() {
+			return fmt.Sprintf("Stop price %s is not a multiple of the tick size %s of %s",
+				stopPrice.String(), rules.TickSize.String(), symbol)
+		}
+	}
+
+	if rules.MinNotional.IsPositive() {
+		// Orders without a limit are valued where they trigger or where the market last traded
+		price := limitPrice
+		if price.IsZero() {
+			price = stopPrice
+		}
+		if price.IsZero() {
+			price, err = s.store.GetLastTradePrice(symbol)
+			if err != nil {
+				return fmt.Sprintf("Failed to load last trade price of %s: %v", symbol, err)
+			}
+		}
+
+		notional := quantity.Mul(price)
+		if !price.IsZero() && notional.LessThan(rules.MinNotional) {
+			return fmt.Sprintf("Notional %s is below the minimum notional %s of %s",
+				notional.String(), rules.MinNotional.String(), symbol)
+		}
+	}
+	return ""
+}
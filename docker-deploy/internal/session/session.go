@@ -0,0 +1,156 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is the trading phase of a symbol
+type Phase string
+
+const (
+	PreOpen    Phase = "pre-open"   // orders collect in a call auction, nothing matches
+	Continuous Phase = "continuous" // normal trading
+	Halted     Phase = "halted"     // no new orders, cancels only
+	Closed     Phase = "closed"     // no orders and no cancels
+)
+
+// ParsePhase returns the phase named by name
+func ParsePhase(name string) (Phase, bool) {
+	switch phase := Phase(strings.ToLower(name)); phase {
+	case PreOpen, Continuous, Halted, Closed:
+		return phase, true
+	}
+	return "", false
+}
+
+// AcceptsOrders reports whether new orders and replaces are allowed in the phase
+func (phase Phase) AcceptsOrders() bool {
+	return phase == PreOpen || phase == Continuous
+}
+
+// AcceptsCancels reports whether resting orders can be canceled in the phase
+func (phase Phase) AcceptsCancels() bool {
+	return phase != Closed
+}
+
+// Schedule is the daily session of every symbol, as offsets from local midnight.
+// Trading days are Monday to Friday except holidays.
+type Schedule struct {
+	PreOpen  time.Duration
+	Open     time.Duration
+	Close    time.Duration
+	Holidays map[string]bool // "2006-01-02" dates without a session
+}
+
+// ParseSchedule parses a "08:00-09:30-16:00" pre-open, open and close schedule
+// and a comma separated list of holiday dates
+func ParseSchedule(times string, holidays string) (*Schedule, error) {
+	parts := strings.Split(times, "-")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("schedule must be pre-open-open-close, got %q", times)
+	}
+
+	offsets := make([]time.Duration, 3)
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q: %v", part, err)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if offsets[0] > offsets[1] || offsets[1] >= offsets[2] {
+		return nil, fmt.Errorf("schedule times must be in order, got %q", times)
+	}
+
+	schedule := &Schedule{
+		PreOpen:  offsets[0],
+		Open:     offsets[1],
+		Close:    offsets[2],
+		Holidays: make(map[string]bool),
+	}
+	for _, date := range strings.Split(holidays, ",") {
+		date = strings.TrimSpace(date)
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: %v", date, err)
+		}
+		schedule.Holidays[date] = true
+	}
+	return schedule, nil
+}
+
+// Phase returns the scheduled phase at now
+func (schedule *Schedule) Phase(now time.Time) Phase {
+	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday ||
+		schedule.Holidays[now.Format("2006-01-02")] {
+		return Closed
+	}
+
+	year, month, day := now.Date()
+	offset := now.Sub(time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	switch {
+	case offset < schedule.PreOpen:
+		return Closed
+	case offset < schedule.Open:
+		return PreOpen
+	case offset < schedule.Close:
+		return Continuous
+	}
+	return Closed
+}
+
+// Calendar tracks the phase of every symbol. A symbol follows the schedule
+// unless an operator set its phase, without a schedule it is always continuous.
+type Calendar struct {
+	mutex     sync.RWMutex
+	schedule  *Schedule
+	overrides map[string]Phase
+}
+
+// NewCalendar creates a calendar, a nil schedule trades around the clock
+func NewCalendar(schedule *Schedule) *Calendar {
+	return &Calendar{
+		schedule:  schedule,
+		overrides: make(map[string]Phase),
+	}
+}
+
+// Scheduled reports whether the calendar follows a schedule
+func (calendar *Calendar) Scheduled() bool {
+	return calendar.schedule != nil
+}
+
+// Phase returns the phase of a symbol at now
+func (calendar *Calendar) Phase(symbol string, now time.Time) Phase {
+	calendar.mutex.RLock()
+	defer calendar.mutex.RUnlock()
+
+	if phase, ok := calendar.overrides[symbol]; ok {
+		return phase
+	}
+	if calendar.schedule == nil {
+		return Continuous
+	}
+	return calendar.schedule.Phase(now)
+}
+
+// SetPhase holds a symbol in a phase until it is cleared
+func (calendar *Calendar) SetPhase(symbol string, phase Phase) {
+	calendar.mutex.Lock()
+	defer calendar.mutex.Unlock()
+
+	calendar.overrides[symbol] = phase
+}
+
+// ClearPhase puts a symbol back on the schedule
+func (calendar *Calendar) ClearPhase(symbol string) {
+	calendar.mutex.Lock()
+	defer calendar.mutex.Unlock()
+
+	delete(calendar.overrides, symbol)
+}
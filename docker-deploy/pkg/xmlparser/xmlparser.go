@@ -45,6 +45,15 @@ func (parser *Xmlparser) Parse(xmlData []byte) (any, reflect.Type, error) {
 					}
 					return transaction, reflect.TypeOf(transaction), err
 				}
+			case "admin":
+				{
+					var admin Admin
+					err := admin.parse(decoder, startElement)
+					if err != nil {
+						fmt.Println("error:", err)
+					}
+					return admin, reflect.TypeOf(admin), err
+				}
 			default:
 				{
 					fmt.Println("default")
@@ -162,6 +171,55 @@ func (transaction *Transaction) parse(decoder *xml.Decoder, start xml.StartEleme
 					return err
 				}
 				child = cancel
+			case "replace":
+				var replace Replace
+				err := decoder.DecodeElement(&replace, &startElem)
+				if err != nil {
+					return err
+				}
+				child = replace
+			case "account_query":
+				var accountQuery AccountQuery
+				err := decoder.DecodeElement(&accountQuery, &startElem)
+				if err != nil {
+					return err
+				}
+				child = accountQuery
+			case "order_history":
+				var orderHistory OrderHistory
+				err := decoder.DecodeElement(&orderHistory, &startElem)
+				if err != nil {
+					return err
+				}
+				child = orderHistory
+			case "trade_history":
+				var tradeHistory TradeHistory
+				err := decoder.DecodeElement(&tradeHistory, &startElem)
+				if err != nil {
+					return err
+				}
+				child = tradeHistory
+			case "mass_cancel":
+				var massCancel MassCancel
+				err := decoder.DecodeElement(&massCancel, &startElem)
+				if err != nil {
+					return err
+				}
+				child = massCancel
+			case "book":
+				var book Book
+				err := decoder.DecodeElement(&book, &startElem)
+				if err != nil {
+					return err
+				}
+				child = book
+			case "indicative":
+				var indicative Indicative
+				err := decoder.DecodeElement(&indicative, &startElem)
+				if err != nil {
+					return err
+				}
+				child = indicative
 			default:
 				if err := decoder.Skip(); err != nil {
 					return err
@@ -174,3 +232,58 @@ func (transaction *Transaction) parse(decoder *xml.Decoder, start xml.StartEleme
 		}
 	}
 }
+
+// parse admin in order
+func (admin *Admin) parse(decoder *xml.Decoder, start xml.StartElement) error {
+	admin.XMLName = start.Name
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		// check if parent ele ends
+		if end, ok := token.(xml.EndElement); ok && end.Name == start.Name {
+			return nil
+		}
+
+		// process sub element
+		if startElem, ok := token.(xml.StartElement); ok {
+
+			// switch by element type label
+			var child any
+			switch startElem.Name.Local {
+			case "auction":
+				var auction Auction
+				err := decoder.DecodeElement(&auction, &startElem)
+				if err != nil {
+					return err
+				}
+				child = auction
+			case "phase":
+				var phase PhaseChange
+				err := decoder.DecodeElement(&phase, &startElem)
+				if err != nil {
+					return err
+				}
+				child = phase
+			case "fee_tier":
+				var tier FeeTier
+				err := decoder.DecodeElement(&tier, &startElem)
+				if err != nil {
+					return err
+				}
+				child = tier
+			default:
+				if err := decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// record order
+			admin.Children = append(admin.Children, child)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package xmlparser
 
 import (
 	"encoding/xml"
+	"strings"
 
 	"github.com/shopspring/decimal"
 )
@@ -18,11 +19,72 @@ type Transaction struct {
 	Children []any    `xm':"any"`
 }
 
+// Admin represents the root element for operator commands
+type Admin struct {
+	XMLName  xml.Name `xml:"admin"`
+	Children []any    `xml:"any"`
+}
+
+// Auction starts ("call") or ends ("uncross") the call auction of a symbol
+type Auction struct {
+	Symbol string `xml:"sym,attr"`
+	Action string `xml:"action,attr"`
+}
+
+// FeeTier creates or changes a named pair of fee rates in basis points
+type FeeTier struct {
+	Name  string          `xml:"name,attr"`
+	Maker decimal.Decimal `xml:"maker,attr"`
+	Taker decimal.Decimal `xml:"taker,attr"`
+}
+
+// PhaseChange holds a symbol in a trading phase, "scheduled" puts it back on the schedule
+type PhaseChange struct {
+	Symbol string `xml:"sym,attr"`
+	Phase  string `xml:"phase,attr"`
+}
+
 // Order represents an order request
 type Order struct {
 	Symbol     string          `xml:"sym,attr"`
-	Amount     int             `xml:"amount,attr"`
+	Amount     decimal.Decimal `xml:"amount,attr"`
 	LimitPrice decimal.Decimal `xml:"limit,attr"`
+	Type       string          `xml:"type,attr"`        // "limit", "market", "stop" or "stop_limit", empty means limit
+	TIF        string          `xml:"tif,attr"`         // "GTC", "IOC", "FOK", "GTD" or "DAY", empty means the type's default
+	StopPrice  decimal.Decimal `xml:"stop,attr"`        // trigger price of stop orders
+	Display    decimal.Decimal `xml:"display,attr"`     // shown slice of iceberg orders, zero shows everything
+	STP        string          `xml:"stp,attr"`         // self-trade prevention mode, empty means the account's default
+	STPGroup   string          `xml:"stp_group,attr"`   // orders in the same group never trade together
+	PostOnly   string          `xml:"post_only,attr"`   // "true" or "reject" rejects a crossing order, "reprice" moves it
+	ExpireTime int64           `xml:"expire_time,attr"` // unix seconds a GTD order expires at
+}
+
+// IsMarket reports whether the order is a market order,
+// either by type="market" or by leaving out the limit price
+func (order *Order) IsMarket() bool {
+	if order.Type == "market" {
+		return true
+	}
+	return order.Type == "" && order.LimitPrice.IsZero()
+}
+
+// TimeInForce returns the upper-cased tif attribute
+func (order *Order) TimeInForce() string {
+	return strings.ToUpper(order.TIF)
+}
+
+// PostOnlyMode returns what to do with the order if it would take liquidity,
+// "reject", "reprice", empty for normal orders or the raw value if unknown
+func (order *Order) PostOnlyMode() string {
+	switch strings.ToLower(order.PostOnly) {
+	case "", "false", "0":
+		return ""
+	case "true", "1", "reject":
+		return "reject"
+	case "reprice":
+		return "reprice"
+	}
+	return order.PostOnly
 }
 
 // Query represents an order query
@@ -34,19 +96,90 @@ type Query struct {
 type Cancel struct {
 	ID string `xml:"id,attr"`
 }
+
+// Replace represents an amendment of an open order.
+// Amount is the new open size, signed like the original order,
+// a zero limit keeps the current price
+type Replace struct {
+	ID         string          `xml:"id,attr"`
+	Amount     decimal.Decimal `xml:"amount,attr"`
+	LimitPrice decimal.Decimal `xml:"limit,attr"`
+}
+
+// AccountQuery asks for the balance, positions and open orders of the transaction's account
+type AccountQuery struct{}
+
+// OrderHistory asks for a page of the account's orders, newest first.
+// Left out filters match everything, from and to are unix seconds.
+type OrderHistory struct {
+	Symbol string `xml:"sym,attr"`
+	Status string `xml:"status,attr"`
+	Side   string `xml:"side,attr"` // "buy" or "sell"
+	From   int64  `xml:"from,attr"`
+	To     int64  `xml:"to,attr"`
+	Limit  int    `xml:"limit,attr"`
+	Cursor string `xml:"cursor,attr"` // next attribute of the previous page
+}
+
+// TradeHistory asks for a page of the executions of the account's orders, newest first
+type TradeHistory struct {
+	Symbol string `xml:"sym,attr"`
+	Side   string `xml:"side,attr"`
+	From   int64  `xml:"from,attr"`
+	To     int64  `xml:"to,attr"`
+	Limit  int    `xml:"limit,attr"`
+	Cursor string `xml:"cursor,attr"`
+}
+
+// MassCancel cancels every open order of the account, narrowed to a symbol and side when given
+type MassCancel struct {
+	Symbol string `xml:"sym,attr"`
+	Side   string `xml:"side,attr"` // "buy" or "sell"
+}
+
+// Book asks for the aggregated price levels of a symbol, depth 0 means the default
+type Book struct {
+	Symbol string `xml:"sym,attr"`
+	Depth  int    `xml:"depth,attr"`
+}
+
+// Indicative asks for the price a call auction would uncross at right now
+type Indicative struct {
+	Symbol string `xml:"sym,attr"`
+}
+
 type Account struct {
 	ID      string          `xml:"id,attr"`
 	Balance decimal.Decimal `xml:"balance,attr"`
+	STP     string          `xml:"stp,attr"`      // default self-trade prevention mode of its orders
+	FeeTier string          `xml:"fee_tier,attr"` // fee tier, empty means the default fees
 }
 
 type Position struct {
-	Symbol string  `xml:"symbol"`
-	Amount float64 `xml:"amount"`
+	Symbol string          `xml:"symbol"`
+	Amount decimal.Decimal `xml:"amount"`
 }
 
+// Symbol creates a symbol, allocates shares of it and sets its trading rules.
+// Rules left out keep their current value
 type Symbol struct {
-	Symbol   string            `xml:"sym,attr"`
-	Accounts []AccountInSymbol `xml:"account"`
+	Symbol      string            `xml:"sym,attr"`
+	Lot         decimal.Decimal   `xml:"lot,attr"`          // lot size
+	Tick        decimal.Decimal   `xml:"tick,attr"`         // tick size
+	MinQty      decimal.Decimal   `xml:"min_qty,attr"`      // minimum order quantity
+	MaxQty      decimal.Decimal   `xml:"max_qty,attr"`      // maximum order quantity
+	MinNotional decimal.Decimal   `xml:"min_notional,attr"` // minimum quantity times price
+	Matching    string            `xml:"matching,attr"`     // "price_time", "pro_rata" or "top_order"
+	MakerFee    *decimal.Decimal  `xml:"maker_fee,attr"`    // maker fee override in basis points
+	TakerFee    *decimal.Decimal  `xml:"taker_fee,attr"`    // taker fee override in basis points
+	Accounts    []AccountInSymbol `xml:"account"`
+}
+
+// HasRules reports whether the request sets any trading rule
+func (symbol *Symbol) HasRules() bool {
+	return !symbol.Lot.IsZero() || !symbol.Tick.IsZero() || !symbol.MinQty.IsZero() ||
+		!symbol.MaxQty.IsZero() || !symbol.MinNotional.IsZero() || symbol.Matching != "" ||
+		symbol.MakerFee != nil || symbol.TakerFee != nil
 }
 
 type AccountInSymbol struct {
@@ -2,7 +2,6 @@ package xmlresponse
 
 import (
 	"encoding/xml"
-	"fmt"
 )
 
 // MarshalXML
@@ -46,11 +45,17 @@ func (r Results) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 			if v.Symbol != "" {
 				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "sym"}, Value: v.Symbol})
 			}
-			if v.Amount != 0 {
-				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "amount"}, Value: fmt.Sprintf("%g", v.Amount)})
+			if !v.Amount.IsZero() {
+				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "amount"}, Value: v.Amount.String()})
 			}
-			if v.Limit != 0 {
-				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "limit"}, Value: fmt.Sprintf("%g", v.Limit)})
+			if !v.Limit.IsZero() {
+				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "limit"}, Value: v.Limit.String()})
+			}
+			if v.Reason != "" {
+				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "reason"}, Value: v.Reason})
+			}
+			if v.Phase != "" {
+				errorStart.Attr = append(errorStart.Attr, xml.Attr{Name: xml.Name{Local: "phase"}, Value: v.Phase})
 			}
 
 			if err := e.EncodeToken(errorStart); err != nil {
@@ -81,6 +86,46 @@ func (r Results) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "canceled"}}); err != nil {
 				return err
 			}
+		case Replaced:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "replaced"}}); err != nil {
+				return err
+			}
+		case Auction:
+			name := "indicative"
+			if v.Uncrossed {
+				name = "uncrossed"
+			}
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+				return err
+			}
+		case MassCanceled:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "mass_canceled"}}); err != nil {
+				return err
+			}
+		case Book:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "book"}}); err != nil {
+				return err
+			}
+		case AuctionState:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "auction"}}); err != nil {
+				return err
+			}
+		case AccountState:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "account"}}); err != nil {
+				return err
+			}
+		case OrderHistory:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "order_history"}}); err != nil {
+				return err
+			}
+		case TradeHistory:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "trade_history"}}); err != nil {
+				return err
+			}
+		case PhaseState:
+			if err := e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "phase"}}); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -1,6 +1,10 @@
 package xmlresponse
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/shopspring/decimal"
+)
 
 // Results is the root element for responses
 type Results struct {
@@ -8,6 +12,14 @@ type Results struct {
 	Children []any    `xml:"-"` // ordered response children
 }
 
+// Optional returns nil for zero, so optional attributes are left out
+func Optional(value decimal.Decimal) *decimal.Decimal {
+	if value.IsZero() {
+		return nil
+	}
+	return &value
+}
+
 // Created represents a successful creation response
 type Created struct {
 	ID     string `xml:"id,attr,omitempty"`
@@ -16,39 +28,73 @@ type Created struct {
 
 // Error represents an error response
 type Error struct {
-	ID      string  `xml:"id,attr,omitempty"`
-	Symbol  string  `xml:"sym,attr,omitempty"`
-	Amount  float64 `xml:"amount,attr,omitempty"`
-	Limit   float64 `xml:"limit,attr,omitempty"`
-	Message string  `xml:",chardata"`
+	ID      string          `xml:"id,attr,omitempty"`
+	Symbol  string          `xml:"sym,attr,omitempty"`
+	Amount  decimal.Decimal `xml:"amount,attr,omitempty"`
+	Limit   decimal.Decimal `xml:"limit,attr,omitempty"`
+	Reason  string          `xml:"reason,attr,omitempty"` // machine readable cause, only set where clients need to tell errors apart
+	Phase   string          `xml:"phase,attr,omitempty"`  // trading phase of the symbol, only set for phase rejections
+	Message string          `xml:",chardata"`
 }
 
+// error reasons
+const (
+	ReasonPostOnly = "post_only" // a post-only order would have taken liquidity
+	ReasonPhase    = "phase"     // the trading phase of the symbol does not allow it
+)
+
 // Opened represents a successfully opened order
 type Opened struct {
-	Symbol string  `xml:"sym,attr"`
-	Amount float64 `xml:"amount,attr"`
-	Limit  float64 `xml:"limit,attr"`
-	ID     string  `xml:"id,attr"`
+	Symbol   string           `xml:"sym,attr"`
+	Amount   decimal.Decimal  `xml:"amount,attr"`
+	Limit    *decimal.Decimal `xml:"limit,attr,omitempty"`
+	Type     string           `xml:"type,attr,omitempty"`        // only set for non-limit orders
+	TIF      string           `xml:"tif,attr,omitempty"`         // only set for orders that do not rest
+	Stop     *decimal.Decimal `xml:"stop,attr,omitempty"`        // only set for stop orders
+	Display  *decimal.Decimal `xml:"display,attr,omitempty"`     // only set for iceberg orders
+	PostOnly string           `xml:"post_only,attr,omitempty"`   // only set for post-only orders
+	Expire   int64            `xml:"expire_time,attr,omitempty"` // only set for GTD and DAY orders, unix seconds
+	ID       string           `xml:"id,attr"`
+	Phase    string           `xml:"phase,attr,omitempty"` // trading phase of the symbol
+
+	// immediate results of orders that do not rest in the book
+	Executed []Executed `xml:"executed,omitempty"`
+	Canceled *Canceled  `xml:"canceled,omitempty"`
 }
 
 // Status represents an order status response
 type Status struct {
 	ID       string     `xml:"id,attr"`
+	Phase    string     `xml:"phase,attr,omitempty"` // trading phase of the symbol
 	Open     []Open     `xml:"open,omitempty"`
+	Pending  []Pending  `xml:"pending,omitempty"`
 	Canceled []Canceled `xml:"canceled,omitempty"`
+	Expired  []Expired  `xml:"expired,omitempty"`
 	Executed []Executed `xml:"executed,omitempty"`
 }
 
+// Expired represents the part of a GTD or DAY order left when it expired
+type Expired struct {
+	Shares decimal.Decimal `xml:"shares,attr"`
+	Time   int64           `xml:"time,attr"`
+}
+
 // Open represents an open portion of an order
 type Open struct {
-	Shares float64 `xml:"shares,attr"`
+	Shares decimal.Decimal `xml:"shares,attr"`
+}
+
+// Pending represents a stop order waiting for its trigger
+type Pending struct {
+	Shares decimal.Decimal `xml:"shares,attr"`
+	Stop   decimal.Decimal `xml:"stop,attr"`
 }
 
 // Canceled represents a canceled order or portion
 type Canceled struct {
-	ID     string  `xml:"id,attr,omitempty"` // Only used at top level
-	Shares float64 `xml:"shares,attr,omitempty"`
-	Time   int64   `xml:"time,attr,omitempty"`
+	ID     string          `xml:"id,attr,omitempty"` // Only used at top level
+	Shares decimal.Decimal `xml:"shares,attr"`
+	Time   int64           `xml:"time,attr,omitempty"`
 
 	Executed []Executed `xml:"executed,omitempty"`
 }
@@ -56,19 +102,164 @@ type Canceled struct {
 // CanceledOrder represents a canceled order
 type CanceledOrder struct {
 	ID       string     `xml:"id,attr"`
+	Phase    string     `xml:"phase,attr,omitempty"` // trading phase of the symbol
 	Canceled Canceled   `xml:"canceled,omitempty"`
 	Executed []Executed `xml:"executed,omitempty"`
 }
 
+// Replaced represents a successfully amended order
+type Replaced struct {
+	ID       string `xml:"id,attr"`
+	Symbol   string `xml:"sym,attr"`
+	Priority string `xml:"priority,attr"`        // "kept" or "lost"
+	Phase    string `xml:"phase,attr,omitempty"` // trading phase of the symbol
+
+	Old ReplacedState `xml:"old"`
+	New ReplacedState `xml:"new"`
+
+	// executions caused by the replacement crossing the book
+	Executed []Executed `xml:"executed,omitempty"`
+}
+
+// ReplacedState represents the open part of an order before or after a replace
+type ReplacedState struct {
+	Shares decimal.Decimal `xml:"shares,attr"`
+	Limit  decimal.Decimal `xml:"limit,attr"`
+}
+
+// Auction represents the result of a call auction, Uncrossed tells a
+// finished uncross from an indicative one
+type Auction struct {
+	Symbol    string          `xml:"sym,attr"`
+	Price     decimal.Decimal `xml:"price,attr"`
+	Volume    decimal.Decimal `xml:"volume,attr"`
+	Imbalance decimal.Decimal `xml:"imbalance,attr"`
+	Uncrossed bool            `xml:"-"`
+}
+
+// MassCanceled represents the outcome of a mass cancel, one order element per order it touched
+type MassCanceled struct {
+	Count  int                 `xml:"count,attr"` // orders that were canceled
+	Orders []MassCanceledOrder `xml:"order,omitempty"`
+}
+
+// MassCanceledOrder represents one order of a mass cancel, Error is set if it could not be canceled
+type MassCanceledOrder struct {
+	ID       string           `xml:"id,attr"`
+	Symbol   string           `xml:"sym,attr"`
+	Canceled *decimal.Decimal `xml:"canceled,attr,omitempty"` // what was left of the order
+	Error    string           `xml:"error,attr,omitempty"`
+}
+
+// Book represents the aggregated price levels of a symbol, best first.
+// Bid, ask and spread are left out when a side is empty.
+type Book struct {
+	Symbol string           `xml:"sym,attr"`
+	Bid    *decimal.Decimal `xml:"bid,attr,omitempty"`
+	Ask    *decimal.Decimal `xml:"ask,attr,omitempty"`
+	Spread *decimal.Decimal `xml:"spread,attr,omitempty"`
+	Bids   []BookLevel      `xml:"bid"`
+	Asks   []BookLevel      `xml:"ask"`
+}
+
+// BookLevel represents a price level of a book
+type BookLevel struct {
+	Price  decimal.Decimal `xml:"price,attr"`
+	Shares decimal.Decimal `xml:"shares,attr"`
+	Orders int             `xml:"orders,attr"`
+}
+
+// AuctionState represents a symbol entering a call auction
+type AuctionState struct {
+	Symbol string `xml:"sym,attr"`
+	State  string `xml:"state,attr"`
+}
+
+// PhaseState represents the trading phase a symbol is in
+type PhaseState struct {
+	Symbol string `xml:"sym,attr"`
+	State  string `xml:"state,attr"`
+}
+
 // Executed represents an executed portion of an order
 type Executed struct {
-	Shares float64 `xml:"shares,attr"`
-	Price  float64 `xml:"price,attr"`
-	Time   int64   `xml:"time,attr"`
+	Shares    decimal.Decimal  `xml:"shares,attr"`
+	Price     decimal.Decimal  `xml:"price,attr"`
+	Fee       *decimal.Decimal `xml:"fee,attr,omitempty"`       // fee paid, negative for a rebate
+	Liquidity string           `xml:"liquidity,attr,omitempty"` // "M" for maker, "T" for taker
+	TradeID   int64            `xml:"trade_id,attr,omitempty"`  // trade shared with the counterparty
+	Time      int64            `xml:"time,attr"`
+}
+
+// AccountState represents the balance, holdings and open orders of an account.
+// Reserved cash and shares are held by open orders, available is what is free.
+type AccountState struct {
+	ID        string          `xml:"id,attr"`
+	Balance   decimal.Decimal `xml:"balance,attr"`
+	Available decimal.Decimal `xml:"available,attr"`
+	Reserved  decimal.Decimal `xml:"reserved,attr"`
+
+	Positions []PositionState `xml:"position,omitempty"`
+	Orders    []OpenOrder     `xml:"order,omitempty"`
+}
+
+// PositionState represents the shares of a symbol an account holds
+type PositionState struct {
+	Symbol    string          `xml:"sym,attr"`
+	Shares    decimal.Decimal `xml:"shares,attr"`
+	Available decimal.Decimal `xml:"available,attr"`
+	Reserved  decimal.Decimal `xml:"reserved,attr"`
+}
+
+// OpenOrder represents an open or pending order of an account
+type OpenOrder struct {
+	ID     string          `xml:"id,attr"`
+	Symbol string          `xml:"sym,attr"`
+	Amount decimal.Decimal `xml:"amount,attr"`
+	Open   decimal.Decimal `xml:"open,attr"`
+	Status string          `xml:"status,attr"`
+}
+
+// OrderHistory represents a page of past orders, Next is the cursor of the next page
+type OrderHistory struct {
+	Next   string         `xml:"next,attr,omitempty"`
+	Orders []HistoryOrder `xml:"order,omitempty"`
+}
+
+// HistoryOrder represents an order in a history page
+type HistoryOrder struct {
+	ID     string           `xml:"id,attr"`
+	Symbol string           `xml:"sym,attr"`
+	Amount decimal.Decimal  `xml:"amount,attr"`
+	Limit  *decimal.Decimal `xml:"limit,attr,omitempty"`
+	Type   string           `xml:"type,attr"`
+	TIF    string           `xml:"tif,attr,omitempty"`
+	Status string           `xml:"status,attr"`
+	Open   decimal.Decimal  `xml:"open,attr"`
+	Time   int64            `xml:"time,attr"`
+}
+
+// TradeHistory represents a page of past executions, Next is the cursor of the next page
+type TradeHistory struct {
+	Next   string         `xml:"next,attr,omitempty"`
+	Trades []HistoryTrade `xml:"trade,omitempty"`
+}
+
+// HistoryTrade represents an execution in a history page
+type HistoryTrade struct {
+	OrderID   string           `xml:"order_id,attr"`
+	TradeID   int64            `xml:"trade_id,attr,omitempty"`
+	Symbol    string           `xml:"sym,attr"`
+	Side      string           `xml:"side,attr"`
+	Shares    decimal.Decimal  `xml:"shares,attr"`
+	Price     decimal.Decimal  `xml:"price,attr"`
+	Fee       *decimal.Decimal `xml:"fee,attr,omitempty"`
+	Liquidity string           `xml:"liquidity,attr,omitempty"`
+	Time      int64            `xml:"time,attr"`
 }
 
 // Position represents a holding of a symbol in an account
 type Position struct {
-	Symbol string  `xml:"symbol"`
-	Amount float64 `xml:"amount"`
+	Symbol string          `xml:"symbol"`
+	Amount decimal.Decimal `xml:"amount"`
 }
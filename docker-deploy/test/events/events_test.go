@@ -0,0 +1,162 @@
+package events_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/events"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/journal"
+	"StockOverflow/internal/pool"
+	"StockOverflow/internal/server"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// trade runs a partial match on an exchange, writing through its recording store
+func trade(t *testing.T, exch *exchange.Exchange) {
+	store := exch.Store()
+	// reservations are taken by the server before orders reach the exchange
+	assert.NoError(t, store.CreateAccount("buyer", decimal.NewFromInt(9000)))
+	assert.NoError(t, store.CreateAccount("seller", decimal.Zero))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.NewFromInt(90)))
+
+	assert.NoError(t, exch.PlaceOrder("1", "seller", "SPY", decimal.NewFromInt(-10), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("2", "buyer", "SPY", decimal.NewFromInt(4), decimal.NewFromInt(101)))
+	assert.NoError(t, exch.PlaceOrder("3", "buyer", "SPY", decimal.NewFromInt(2), decimal.NewFromInt(99)))
+}
+
+// TestFoldMatchesStore tests that the state folded from the events is the store's
+func TestFoldMatchesStore(t *testing.T) {
+	exch := exchange.NewExchange(database.NewMemoryStore(), pool.NewPool(100), log.New(io.Discard, "", 0))
+	st := events.NewState()
+	exch.Events().Subscribe(0, st.Apply)
+
+	trade(t, exch)
+
+	divergences, err := events.Diff(st, exch.Store())
+	assert.NoError(t, err)
+	assert.Empty(t, divergences)
+	assert.Equal(t, "100", st.LastPrices["SPY"].String())
+
+	asks := st.Book("SPY", false)
+	assert.Len(t, asks, 1)
+	assert.Equal(t, "6", asks[0].Shares.String())
+	bids := st.Book("SPY", true)
+	assert.Len(t, bids, 1)
+	assert.Equal(t, "99", bids[0].Price.String())
+
+	levels, err := exch.Store().GetBookLevels("SPY", false, 0, time.Now().UnixNano())
+	assert.NoError(t, err)
+	assert.Equal(t, levels[0].Shares.String(), asks[0].Shares.String())
+}
+
+// TestRebuildFromSnapshotAndLog tests that a snapshot and the log after it give the state back,
+// also when the log ends in a torn record
+func TestRebuildFromSnapshotAndLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	exch := exchange.NewExchange(database.NewMemoryStore(), pool.NewPool(100), log.New(io.Discard, "", 0))
+
+	eventLog, err := events.OpenLog(path, journal.SyncAlways, 0, 0, nil)
+	assert.NoError(t, err)
+	st := events.NewState()
+	snapshotAt := uint64(0)
+	exch.Events().Subscribe(0, func(recorded events.Recorded) error {
+		if err := eventLog.Append(recorded); err != nil {
+			return err
+		}
+		if err := st.Apply(recorded); err != nil {
+			return err
+		}
+		if recorded.Seq == 5 {
+			data, seq, err := st.Marshal()
+			if err != nil {
+				return err
+			}
+			snapshotAt = seq
+			return events.WriteSnapshot(dir, seq, data)
+		}
+		return nil
+	})
+
+	trade(t, exch)
+	assert.Equal(t, uint64(5), snapshotAt)
+	assert.NoError(t, eventLog.Close())
+
+	// a crash in the middle of the next record
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`1234abcd {"seq":`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	rebuilt, found, err := events.LoadSnapshot(dir)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(5), rebuilt.Seq)
+
+	replayed := 0
+	seq, _, err := events.ReadLog(path, rebuilt.Seq, func(recorded events.Recorded) error {
+		replayed++
+		return rebuilt.Apply(recorded)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, exch.Events().Seq(), seq)
+	assert.Equal(t, int(seq-5), replayed)
+
+	divergences, err := events.Diff(rebuilt, exch.Store())
+	assert.NoError(t, err)
+	assert.Empty(t, divergences)
+	assert.Len(t, rebuilt.Book("SPY", false), 1)
+	assert.Equal(t, "6", rebuilt.Book("SPY", false)[0].Shares.String())
+}
+
+// TestDiffFindsDivergence tests that a change made around the events is reported
+func TestDiffFindsDivergence(t *testing.T) {
+	store := database.NewMemoryStore()
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+	st := events.NewState()
+	exch.Events().Subscribe(0, st.Apply)
+
+	trade(t, exch)
+	assert.NoError(t, store.UpdateAccountBalance("buyer", decimal.NewFromInt(1)))
+	assert.NoError(t, store.CreateOrUpdatePosition("buyer", "QQQ", decimal.NewFromInt(3)))
+
+	divergences, err := events.Diff(st, exch.Store())
+	assert.NoError(t, err)
+	assert.Len(t, divergences, 2)
+	assert.Equal(t, "buyer", divergences[0].AccountID)
+	assert.Equal(t, "", divergences[0].Symbol)
+	assert.Equal(t, "1", divergences[0].Store.String())
+	assert.Equal(t, "QQQ", divergences[1].Symbol)
+	assert.True(t, divergences[1].Events.IsZero())
+}
+
+// TestStartEventLog tests that the server seeds its event state from a store it finds
+// accounts in, and picks up from its snapshot on a restart
+func TestStartEventLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	store := database.NewMemoryStore()
+	assert.NoError(t, store.CreateAccount("1", decimal.NewFromInt(100)))
+	assert.NoError(t, store.CreateOrUpdatePosition("1", "SPY", decimal.NewFromInt(5)))
+
+	s := server.NewServer(log.New(io.Discard, "", 0))
+	s.SetStore(store)
+	assert.NoError(t, s.StartEventLog(path, journal.SyncAlways, 0, dir, 2))
+	assert.Equal(t, "100", s.EventState().Accounts["1"].String())
+	assert.Equal(t, "5", s.EventState().Positions["1"]["SPY"].String())
+	assert.NoError(t, s.Stop())
+
+	s = server.NewServer(log.New(io.Discard, "", 0))
+	s.SetStore(store)
+	assert.NoError(t, s.StartEventLog(path, journal.SyncAlways, 0, dir, 2))
+	assert.Equal(t, "100", s.EventState().Accounts["1"].String())
+	assert.NoError(t, s.Stop())
+}
@@ -0,0 +1,144 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// auctionOrder builds a resting order for the equilibrium tests
+func auctionOrder(price, remaining int64) database.Order {
+	return database.Order{
+		Price:     decimal.NewFromInt(price),
+		Remaining: decimal.NewFromInt(remaining),
+	}
+}
+
+// TestEquilibriumMaxVolume tests that the price executing the most shares wins
+func TestEquilibriumMaxVolume(t *testing.T) {
+	buys := []database.Order{auctionOrder(102, 100), auctionOrder(101, 200), auctionOrder(99, 300)}
+	sells := []database.Order{auctionOrder(98, 150), auctionOrder(101, 150), auctionOrder(103, 100)}
+
+	result := exchange.Equilibrium(buys, sells, decimal.Zero)
+	assert.Equal(t, "101", result.Price.String())
+	assert.Equal(t, "300", result.Volume.String())
+	assert.Equal(t, "0", result.Imbalance.String())
+}
+
+// TestEquilibriumMarketPressure tests that surplus buyers push the price up
+func TestEquilibriumMarketPressure(t *testing.T) {
+	buys := []database.Order{auctionOrder(101, 200)}
+	sells := []database.Order{auctionOrder(100, 100)}
+
+	result := exchange.Equilibrium(buys, sells, decimal.Zero)
+	assert.Equal(t, "101", result.Price.String())
+	assert.Equal(t, "100", result.Volume.String())
+	assert.Equal(t, "100", result.Imbalance.String())
+
+	// and surplus sellers push it down
+	buys = []database.Order{auctionOrder(101, 100)}
+	sells = []database.Order{auctionOrder(100, 200)}
+
+	result = exchange.Equilibrium(buys, sells, decimal.Zero)
+	assert.Equal(t, "100", result.Price.String())
+	assert.Equal(t, "-100", result.Imbalance.String())
+}
+
+// TestEquilibriumReferencePrice tests that a balanced book uncrosses closest to the last trade
+func TestEquilibriumReferencePrice(t *testing.T) {
+	buys := []database.Order{auctionOrder(102, 100)}
+	sells := []database.Order{auctionOrder(100, 100)}
+
+	result := exchange.Equilibrium(buys, sells, decimal.NewFromInt(105))
+	assert.Equal(t, "102", result.Price.String())
+
+	result = exchange.Equilibrium(buys, sells, decimal.Zero)
+	assert.Equal(t, "100", result.Price.String())
+}
+
+// TestEquilibriumNoCross tests that a book that does not cross has no volume
+func TestEquilibriumNoCross(t *testing.T) {
+	buys := []database.Order{auctionOrder(99, 100)}
+	sells := []database.Order{auctionOrder(100, 100)}
+
+	result := exchange.Equilibrium(buys, sells, decimal.Zero)
+	assert.True(t, result.Volume.IsZero())
+	assert.True(t, result.Price.IsZero())
+}
+
+// setupAuctionExchange creates an exchange with SPY in a call auction, its
+// accounts 1 and 2 have funds and shares to trade
+func setupAuctionExchange(t *testing.T) *exchange.Exchange {
+	store := database.NewMemoryStore()
+	for _, account := range []string{"1", "2"} {
+		assert.NoError(t, store.CreateAccount(account, decimal.NewFromInt(10000)))
+		assert.NoError(t, store.CreateOrUpdatePosition(account, "SPY", decimal.NewFromInt(100)))
+	}
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+	assert.NoError(t, exch.StartAuction("SPY"))
+	return exch
+}
+
+// submitAuctionOrder places an order of SPY with a self-trade prevention mode
+func submitAuctionOrder(t *testing.T, exch *exchange.Exchange, id, account string, amount, price int64, stp string) {
+	assert.NoError(t, exch.SubmitOrder(&database.Order{
+		ID:        id,
+		AccountID: account,
+		Symbol:    "SPY",
+		Amount:    decimal.NewFromInt(amount),
+		Price:     decimal.NewFromInt(price),
+		STPMode:   stp,
+	}))
+}
+
+// assertOrder checks the status and remaining amount of an order
+func assertOrder(t *testing.T, exch *exchange.Exchange, id, status, remaining string) {
+	order, _, err := exch.GetOrderStatus(id)
+	assert.NoError(t, err)
+	assert.Equal(t, status, order.Status, "status of order "+id)
+	assert.Equal(t, remaining, order.Remaining.String(), "remaining of order "+id)
+}
+
+// TestUncrossSelfTradeCancelNewest tests that an account crossing its own order
+// in the auction loses the newer one and the volume is what executed
+func TestUncrossSelfTradeCancelNewest(t *testing.T) {
+	exch := setupAuctionExchange(t)
+	submitAuctionOrder(t, exch, "1", "1", -10, 100, "")
+	submitAuctionOrder(t, exch, "2", "1", 10, 101, "")
+	submitAuctionOrder(t, exch, "3", "2", 4, 101, "")
+
+	result, err := exch.Uncross("SPY")
+	assert.NoError(t, err)
+	assert.Equal(t, "4", result.Volume.String())
+	assert.Equal(t, "100", result.Price.String())
+
+	assertOrder(t, exch, "1", "open", "6")
+	assertOrder(t, exch, "2", "canceled", "10")
+	assertOrder(t, exch, "3", "executed", "0")
+	_, executions, err := exch.GetOrderStatus("2")
+	assert.NoError(t, err)
+	assert.Empty(t, executions)
+}
+
+// TestUncrossSelfTradeDecrement tests that the resting order's decrement mode
+// shrinks the bigger order and cancels the smaller one before the uncross
+func TestUncrossSelfTradeDecrement(t *testing.T) {
+	exch := setupAuctionExchange(t)
+	submitAuctionOrder(t, exch, "1", "1", -10, 100, database.STPDecrement)
+	submitAuctionOrder(t, exch, "2", "1", 4, 101, "")
+	submitAuctionOrder(t, exch, "3", "2", 6, 101, "")
+
+	result, err := exch.Uncross("SPY")
+	assert.NoError(t, err)
+	assert.Equal(t, "6", result.Volume.String())
+
+	assertOrder(t, exch, "1", "executed", "0")
+	assertOrder(t, exch, "2", "canceled", "4")
+	assertOrder(t, exch, "3", "executed", "0")
+}
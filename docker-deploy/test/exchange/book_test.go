@@ -0,0 +1,51 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// bookLevel builds a price level for the snapshot tests
+func bookLevel(price, shares int64, orders int) database.BookLevel {
+	return database.BookLevel{
+		Price:  decimal.NewFromInt(price),
+		Shares: decimal.NewFromInt(shares),
+		Orders: orders,
+	}
+}
+
+// TestBookSnapshotSpread tests best bid, best ask and spread of a two sided book
+func TestBookSnapshotSpread(t *testing.T) {
+	book := exchange.BookSnapshot{
+		Symbol: "SPY",
+		Bids:   []database.BookLevel{bookLevel(100, 300, 2), bookLevel(99, 100, 1)},
+		Asks:   []database.BookLevel{bookLevel(102, 50, 1), bookLevel(105, 500, 4)},
+	}
+
+	bid, ok := book.BestBid()
+	assert.True(t, ok)
+	assert.Equal(t, "100", bid.String())
+	ask, ok := book.BestAsk()
+	assert.True(t, ok)
+	assert.Equal(t, "102", ask.String())
+	spread, ok := book.Spread()
+	assert.True(t, ok)
+	assert.Equal(t, "2", spread.String())
+}
+
+// TestBookSnapshotOneSided tests that there is no spread without both sides
+func TestBookSnapshotOneSided(t *testing.T) {
+	book := exchange.BookSnapshot{
+		Symbol: "SPY",
+		Bids:   []database.BookLevel{bookLevel(100, 300, 2)},
+	}
+
+	_, ok := book.BestAsk()
+	assert.False(t, ok)
+	_, ok = book.Spread()
+	assert.False(t, ok)
+}
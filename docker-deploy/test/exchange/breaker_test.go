@@ -0,0 +1,73 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPriceBand tests the limits of a band around its reference
+func TestPriceBand(t *testing.T) {
+	lower, upper := exchange.PriceBand(decimal.NewFromInt(100), decimal.NewFromFloat(0.05))
+	assert.Equal(t, "95", lower.String())
+	assert.Equal(t, "105", upper.String())
+}
+
+// TestStockNodeHalt tests that a halt ends at its deadline
+func TestStockNodeHalt(t *testing.T) {
+	node := pool.NewStockNode("SPY", 10).GetValue()
+	now := time.Now()
+	assert.False(t, node.Halted(now.UnixNano()))
+
+	node.SetHaltedUntil(now.Add(time.Minute).UnixNano())
+	assert.True(t, node.Halted(now.UnixNano()))
+	assert.False(t, node.Halted(now.Add(time.Minute).UnixNano()))
+}
+
+// tradeAt trades one share of SPY at price between a fresh pair of orders
+func tradeAt(t *testing.T, exch *exchange.Exchange, id string, price int64) {
+	assert.NoError(t, exch.PlaceOrder(id+"s", "seller", "SPY", decimal.NewFromInt(-1), decimal.NewFromInt(price)))
+	assert.NoError(t, exch.PlaceOrder(id+"b", "buyer", "SPY", decimal.NewFromInt(1), decimal.NewFromInt(price)))
+}
+
+// setupBreakerExchange creates an exchange with a buyer and a seller of SPY
+func setupBreakerExchange(t *testing.T) *exchange.Exchange {
+	store := database.NewMemoryStore()
+	assert.NoError(t, store.CreateAccount("buyer", decimal.NewFromInt(1000)))
+	assert.NoError(t, store.CreateAccount("seller", decimal.Zero))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.NewFromInt(10)))
+	return exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+}
+
+// TestBreakersOffByDefault tests that no band halts a symbol unless configured
+func TestBreakersOffByDefault(t *testing.T) {
+	exch := setupBreakerExchange(t)
+	tradeAt(t, exch, "1", 100)
+	tradeAt(t, exch, "2", 50)
+
+	_, halted := exch.HaltedUntil("SPY")
+	assert.False(t, halted)
+}
+
+// TestCollarFromFirstTrade tests that the first trade of a symbol sets the
+// reference price the collar is around
+func TestCollarFromFirstTrade(t *testing.T) {
+	exch := setupBreakerExchange(t)
+	exch.SetPriceBands(decimal.NewFromFloat(0.10), decimal.Zero, time.Minute)
+
+	tradeAt(t, exch, "1", 100)
+	tradeAt(t, exch, "2", 105)
+	_, halted := exch.HaltedUntil("SPY")
+	assert.False(t, halted)
+
+	tradeAt(t, exch, "3", 120)
+	_, halted = exch.HaltedUntil("SPY")
+	assert.True(t, halted)
+}
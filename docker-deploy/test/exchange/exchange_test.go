@@ -1,6 +1,7 @@
 package exchange_test
 
 import (
+	"StockOverflow/internal/database"
 	"StockOverflow/internal/exchange"
 	"StockOverflow/internal/pool"
 	"database/sql"
@@ -32,7 +33,7 @@ func TestPlaceOrder(t *testing.T) {
 
 	logger := log.New(os.Stdout, "TEST: ", log.LstdFlags)
 	stockPool := pool.NewPool(100)
-	exchange := exchange.NewExchange(db, stockPool, logger)
+	exchange := exchange.NewExchange(database.NewSQLStore(db), stockPool, logger)
 
 	// Test data
 	orderID := "12345"
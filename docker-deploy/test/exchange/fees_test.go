@@ -0,0 +1,78 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFee tests fees in basis points and their rounding
+func TestFee(t *testing.T) {
+	// 10 bps of 100 * 12.5
+	fee := exchange.Fee(decimal.NewFromInt(100), decimal.NewFromFloat(12.5), decimal.NewFromInt(10))
+	assert.Equal(t, "1.25", fee.String())
+
+	// maker rebates are negative
+	fee = exchange.Fee(decimal.NewFromInt(100), decimal.NewFromFloat(12.5), decimal.NewFromInt(-2))
+	assert.Equal(t, "-0.25", fee.String())
+
+	// rounded half away from zero to 6 decimal places
+	fee = exchange.Fee(decimal.NewFromInt(1), decimal.NewFromFloat(0.01), decimal.NewFromFloat(0.5))
+	assert.Equal(t, "0.000001", fee.String())
+}
+
+// setupFeeExchange creates an exchange whose house account holds houseBalance,
+// the seller is in a tier with a maker rebate and the buyer in one with a low taker fee
+func setupFeeExchange(t *testing.T, houseBalance int64) (*exchange.Exchange, database.Store) {
+	store := database.NewMemoryStore()
+	assert.NoError(t, store.CreateAccount("house", decimal.NewFromInt(houseBalance)))
+	assert.NoError(t, store.CreateAccount("buyer", decimal.NewFromInt(10000)))
+	assert.NoError(t, store.CreateAccount("seller", decimal.Zero))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.NewFromInt(10)))
+
+	assert.NoError(t, store.CreateOrUpdateFeeTier(&database.FeeTier{Name: "rebate", MakerBps: decimal.NewFromInt(-10), TakerBps: decimal.NewFromInt(10)}))
+	assert.NoError(t, store.CreateOrUpdateFeeTier(&database.FeeTier{Name: "cheap", MakerBps: decimal.Zero, TakerBps: decimal.NewFromInt(2)}))
+	assert.NoError(t, store.SetAccountFeeTier("seller", "rebate"))
+	assert.NoError(t, store.SetAccountFeeTier("buyer", "cheap"))
+
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+	assert.NoError(t, exch.SetFees(decimal.Zero, decimal.Zero, "house"))
+
+	// 10 at 100, the seller makes with a rebate of 1, the buyer takes paying 0.2
+	assert.NoError(t, exch.PlaceOrder("1", "seller", "SPY", decimal.NewFromInt(-10), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.SubmitOrder(&database.Order{ID: "2", AccountID: "buyer", Symbol: "SPY",
+		Amount: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), FeeBps: decimal.NewFromInt(2)}))
+	return exch, store
+}
+
+// TestRebateAcrossTiers tests that a maker rebate bigger than the taker fee of
+// another tier is only paid as far as the house account can
+func TestRebateAcrossTiers(t *testing.T) {
+	_, store := setupFeeExchange(t, 0)
+	house, err := store.GetAccount("house")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", house.Balance.String())
+	seller, err := store.GetAccount("seller")
+	assert.NoError(t, err)
+	assert.Equal(t, "1000.2", seller.Balance.String())
+
+	// the executions record what was actually paid
+	executions, err := store.GetOrderExecutions("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "-0.2", executions[0].Fee.String())
+
+	// a house that can pay it pays the whole rebate
+	_, store = setupFeeExchange(t, 10)
+	house, err = store.GetAccount("house")
+	assert.NoError(t, err)
+	assert.Equal(t, "9.2", house.Balance.String())
+	seller, err = store.GetAccount("seller")
+	assert.NoError(t, err)
+	assert.Equal(t, "1001", seller.Balance.String())
+}
@@ -0,0 +1,94 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupIcebergExchange creates an exchange where account 1 buys SPY from
+// accounts 2 and 3, and account 2 rests an iceberg of 10 showing 3 at 100
+func setupIcebergExchange(t *testing.T) (*exchange.Exchange, *pool.StockPool, database.Store) {
+	store := database.NewMemoryStore()
+	for _, account := range []string{"1", "2", "3"} {
+		assert.NoError(t, store.CreateAccount(account, decimal.NewFromInt(10000)))
+		assert.NoError(t, store.CreateOrUpdatePosition(account, "SPY", decimal.NewFromInt(100)))
+	}
+	stockPool := pool.NewPool(100)
+	exch := exchange.NewExchange(store, stockPool, log.New(io.Discard, "", 0))
+
+	assert.NoError(t, exch.SubmitOrder(&database.Order{
+		ID:        "1",
+		AccountID: "2",
+		Symbol:    "SPY",
+		Amount:    decimal.NewFromInt(-10),
+		Price:     decimal.NewFromInt(100),
+		Display:   decimal.NewFromInt(3),
+	}))
+	return exch, stockPool, store
+}
+
+// TestIcebergSliceRefresh tests that a slice traded through is replenished from
+// the hidden reserve with a new time priority, and a partly traded one keeps it
+func TestIcebergSliceRefresh(t *testing.T) {
+	exch, _, store := setupIcebergExchange(t)
+	placed, err := store.GetOrder("1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, exch.PlaceOrder("2", "1", "SPY", decimal.NewFromInt(1), decimal.NewFromInt(100)))
+	order, err := store.GetOrder("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", order.Visible.String())
+	assert.Equal(t, "9", order.Remaining.String())
+	assert.Equal(t, placed.PriorityTime, order.PriorityTime)
+
+	assert.NoError(t, exch.PlaceOrder("3", "1", "SPY", decimal.NewFromInt(2), decimal.NewFromInt(100)))
+	order, err = store.GetOrder("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", order.Visible.String())
+	assert.Equal(t, "7", order.Remaining.String())
+	assert.Greater(t, order.PriorityTime, placed.PriorityTime)
+}
+
+// TestIcebergLosesPriority tests that an order at the same price placed after
+// the iceberg fills before it once the iceberg's slice was replenished
+func TestIcebergLosesPriority(t *testing.T) {
+	exch, _, _ := setupIcebergExchange(t)
+	assert.NoError(t, exch.PlaceOrder("2", "3", "SPY", decimal.NewFromInt(-5), decimal.NewFromInt(100)))
+
+	// the iceberg is first in time, its slice goes first
+	assert.NoError(t, exch.PlaceOrder("3", "1", "SPY", decimal.NewFromInt(3), decimal.NewFromInt(100)))
+	assertOrder(t, exch, "1", "open", "7")
+	assertOrder(t, exch, "2", "open", "5")
+
+	// the replenished slice is behind the later order now
+	assert.NoError(t, exch.PlaceOrder("4", "1", "SPY", decimal.NewFromInt(5), decimal.NewFromInt(100)))
+	assertOrder(t, exch, "2", "executed", "0")
+	assertOrder(t, exch, "1", "open", "7")
+}
+
+// TestIcebergShowsSlice tests that the book and the heap loaded from the store
+// only show the slice, never the hidden reserve
+func TestIcebergShowsSlice(t *testing.T) {
+	exch, stockPool, _ := setupIcebergExchange(t)
+
+	book, err := exch.Book("SPY", 0)
+	assert.NoError(t, err)
+	assert.Len(t, book.Asks, 1)
+	assert.Equal(t, "3", book.Asks[0].Shares.String())
+
+	stockNode, err := stockPool.Get("SPY")
+	assert.NoError(t, err)
+	sellers := stockNode.GetValue().GetSellers()
+	sellers.Reload()
+	top, err := sellers.SafePeek()
+	assert.NoError(t, err)
+	shown := top.(pool.Order)
+	assert.Equal(t, "3", shown.GetAmount().String())
+}
@@ -1,6 +1,7 @@
 package exchange_test
 
 import (
+	"StockOverflow/internal/database"
 	"StockOverflow/internal/exchange"
 	"StockOverflow/internal/pool"
 	"database/sql"
@@ -34,15 +35,15 @@ func setupAppleStock(stockPool *pool.StockPool) {
 
 	// Add buy orders (higher prices first for priority)
 	buyers := appleNode.GetValue().GetBuyers()
-	buyers.SafePush(pool.NewOrder("101", 5, decimal.NewFromFloat(150.25), time.Now().Add(-10*time.Minute)))
-	buyers.SafePush(pool.NewOrder("102", 10, decimal.NewFromFloat(149.50), time.Now().Add(-15*time.Minute)))
-	buyers.SafePush(pool.NewOrder("103", 3, decimal.NewFromFloat(148.75), time.Now().Add(-20*time.Minute)))
+	buyers.SafePush(pool.NewOrder("101", decimal.NewFromInt(5), decimal.NewFromFloat(150.25), time.Now().Add(-10*time.Minute)))
+	buyers.SafePush(pool.NewOrder("102", decimal.NewFromInt(10), decimal.NewFromFloat(149.50), time.Now().Add(-15*time.Minute)))
+	buyers.SafePush(pool.NewOrder("103", decimal.NewFromInt(3), decimal.NewFromFloat(148.75), time.Now().Add(-20*time.Minute)))
 
 	// Add sell orders (lower prices first for priority)
 	sellers := appleNode.GetValue().GetSellers()
-	sellers.SafePush(pool.NewOrder("201", 4, decimal.NewFromFloat(151.50), time.Now().Add(-5*time.Minute)))
-	sellers.SafePush(pool.NewOrder("202", 7, decimal.NewFromFloat(152.25), time.Now().Add(-7*time.Minute)))
-	sellers.SafePush(pool.NewOrder("203", 2, decimal.NewFromFloat(153.00), time.Now().Add(-9*time.Minute)))
+	sellers.SafePush(pool.NewOrder("201", decimal.NewFromInt(4), decimal.NewFromFloat(151.50), time.Now().Add(-5*time.Minute)))
+	sellers.SafePush(pool.NewOrder("202", decimal.NewFromInt(7), decimal.NewFromFloat(152.25), time.Now().Add(-7*time.Minute)))
+	sellers.SafePush(pool.NewOrder("203", decimal.NewFromInt(2), decimal.NewFromFloat(153.00), time.Now().Add(-9*time.Minute)))
 }
 
 // setupTeslaStock sets up TSLA stock with some existing orders
@@ -53,13 +54,13 @@ func setupTeslaStock(stockPool *pool.StockPool) {
 
 	// Add buy orders
 	buyers := teslaNode.GetValue().GetBuyers()
-	buyers.SafePush(pool.NewOrder("301", 2, decimal.NewFromFloat(220.50), time.Now().Add(-30*time.Minute)))
-	buyers.SafePush(pool.NewOrder("302", 5, decimal.NewFromFloat(219.75), time.Now().Add(-35*time.Minute)))
+	buyers.SafePush(pool.NewOrder("301", decimal.NewFromInt(2), decimal.NewFromFloat(220.50), time.Now().Add(-30*time.Minute)))
+	buyers.SafePush(pool.NewOrder("302", decimal.NewFromInt(5), decimal.NewFromFloat(219.75), time.Now().Add(-35*time.Minute)))
 
 	// Add sell orders
 	sellers := teslaNode.GetValue().GetSellers()
-	sellers.SafePush(pool.NewOrder("401", 3, decimal.NewFromFloat(222.25), time.Now().Add(-25*time.Minute)))
-	sellers.SafePush(pool.NewOrder("402", 4, decimal.NewFromFloat(223.50), time.Now().Add(-28*time.Minute)))
+	sellers.SafePush(pool.NewOrder("401", decimal.NewFromInt(3), decimal.NewFromFloat(222.25), time.Now().Add(-25*time.Minute)))
+	sellers.SafePush(pool.NewOrder("402", decimal.NewFromInt(4), decimal.NewFromFloat(223.50), time.Now().Add(-28*time.Minute)))
 }
 
 // setupGoogleStock sets up GOOGL stock with some existing orders
@@ -70,11 +71,11 @@ func setupGoogleStock(stockPool *pool.StockPool) {
 
 	// Add buy orders
 	buyers := googleNode.GetValue().GetBuyers()
-	buyers.SafePush(pool.NewOrder("501", 1, decimal.NewFromFloat(142.75), time.Now().Add(-40*time.Minute)))
+	buyers.SafePush(pool.NewOrder("501", decimal.NewFromInt(1), decimal.NewFromFloat(142.75), time.Now().Add(-40*time.Minute)))
 
 	// Add sell orders
 	sellers := googleNode.GetValue().GetSellers()
-	sellers.SafePush(pool.NewOrder("601", 1, decimal.NewFromFloat(143.25), time.Now().Add(-45*time.Minute)))
+	sellers.SafePush(pool.NewOrder("601", decimal.NewFromInt(1), decimal.NewFromFloat(143.25), time.Now().Add(-45*time.Minute)))
 }
 
 // TestMatchOrderBuy tests matching a buy order with existing sell orders
@@ -85,7 +86,7 @@ func TestMatchOrderBuy(t *testing.T) {
 
 	logger := log.New(os.Stdout, "TEST: ", log.LstdFlags)
 	stockPool := setupStockPool()
-	exch := exchange.NewExchange(db, stockPool, logger)
+	exch := exchange.NewExchange(database.NewSQLStore(db), stockPool, logger)
 
 	// Test data for a buy order that should match with existing sell orders
 	orderID := "12345"
@@ -196,7 +197,7 @@ func TestMatchOrderSell(t *testing.T) {
 
 	logger := log.New(os.Stdout, "TEST: ", log.LstdFlags)
 	stockPool := setupStockPool()
-	exch := exchange.NewExchange(db, stockPool, logger)
+	exch := exchange.NewExchange(database.NewSQLStore(db), stockPool, logger)
 
 	// Test data for a sell order that should match with existing buy orders
 	orderID := "54321"
@@ -307,7 +308,7 @@ func TestNoMatchingSellOrders(t *testing.T) {
 
 	logger := log.New(os.Stdout, "TEST: ", log.LstdFlags)
 	stockPool := setupStockPool()
-	exch := exchange.NewExchange(db, stockPool, logger)
+	exch := exchange.NewExchange(database.NewSQLStore(db), stockPool, logger)
 
 	// Test data for a buy order with price too low to match any sells
 	orderID := "33333"
@@ -346,7 +347,7 @@ func TestPartialMatchBuyOrder(t *testing.T) {
 
 	logger := log.New(os.Stdout, "TEST: ", log.LstdFlags)
 	stockPool := setupStockPool()
-	exch := exchange.NewExchange(db, stockPool, logger)
+	exch := exchange.NewExchange(database.NewSQLStore(db), stockPool, logger)
 
 	// Test data for a buy order that should partially match
 	orderID := "44444"
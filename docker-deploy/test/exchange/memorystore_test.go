@@ -0,0 +1,102 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMemoryStoreRollback tests that a failed transaction leaves nothing behind
+func TestMemoryStoreRollback(t *testing.T) {
+	store := database.NewMemoryStore()
+	assert.NoError(t, store.CreateAccount("1", decimal.NewFromInt(100)))
+
+	err := store.WithTx(func(tx database.Tx) error {
+		if err := tx.UpdateAccountBalance("1", decimal.NewFromInt(50)); err != nil {
+			return err
+		}
+		if err := tx.CreateOrUpdatePosition("1", "SPY", decimal.NewFromInt(5)); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	assert.Error(t, err)
+
+	account, err := store.GetAccount("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", account.Balance.String())
+	_, err = store.GetPosition("1", "SPY")
+	assert.Error(t, err)
+}
+
+// TestMemoryStoreIsolation tests that changes are only seen once their transaction commits
+func TestMemoryStoreIsolation(t *testing.T) {
+	store := database.NewMemoryStore()
+	assert.NoError(t, store.CreateAccount("1", decimal.NewFromInt(100)))
+
+	err := store.WithTx(func(tx database.Tx) error {
+		if err := tx.UpdateAccountBalance("1", decimal.NewFromInt(60)); err != nil {
+			return err
+		}
+		balance, err := tx.GetBalanceForUpdate("1")
+		assert.NoError(t, err)
+		assert.Equal(t, "60", balance.String())
+
+		account, err := store.GetAccount("1")
+		assert.NoError(t, err)
+		assert.Equal(t, "100", account.Balance.String())
+		return nil
+	})
+	assert.NoError(t, err)
+
+	account, err := store.GetAccount("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "60", account.Balance.String())
+}
+
+// TestMatchOnMemoryStore tests a full match of the engine without a database
+func TestMatchOnMemoryStore(t *testing.T) {
+	store := database.NewMemoryStore()
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+
+	// reservations are taken by the server before orders reach the exchange
+	assert.NoError(t, store.CreateAccount("buyer", decimal.NewFromInt(10000-10*101)))
+	assert.NoError(t, store.CreateAccount("seller", decimal.NewFromInt(0)))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.NewFromInt(90)))
+
+	assert.NoError(t, exch.PlaceOrder("1", "seller", "SPY", decimal.NewFromInt(-10), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("2", "buyer", "SPY", decimal.NewFromInt(10), decimal.NewFromInt(101)))
+
+	sell, executions, err := exch.GetOrderStatus("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "executed", sell.Status)
+	assert.Len(t, executions, 1)
+	assert.Equal(t, "100", executions[0].Price.String())
+
+	buy, _, err := exch.GetOrderStatus("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "executed", buy.Status)
+
+	// the buyer gets back what it reserved above the trade price
+	buyer, err := store.GetAccount("buyer")
+	assert.NoError(t, err)
+	assert.Equal(t, "9000", buyer.Balance.String())
+	seller, err := store.GetAccount("seller")
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", seller.Balance.String())
+	position, err := store.GetPosition("buyer", "SPY")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", position.Amount.String())
+
+	trade, err := store.GetTrade(executions[0].TradeID)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", trade.BuyOrderID)
+	assert.Equal(t, database.AggressorBuy, trade.Aggressor)
+}
@@ -0,0 +1,79 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openSQLite opens a SQLite database file without creating the schema
+func openSQLite(t *testing.T, path string) *database.DatabaseMaster {
+	dbm := &database.DatabaseMaster{Driver: "sqlite", DbName: path}
+	dbm.Connect()
+	t.Cleanup(func() { dbm.Db.Close() })
+	return dbm
+}
+
+// TestMigrateUp tests that migrations are applied once and recorded
+func TestMigrateUp(t *testing.T) {
+	dbm := openSQLite(t, filepath.Join(t.TempDir(), "stockoverflow.db"))
+
+	states, err := database.GetMigrationStatus(dbm.Db)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, states)
+	assert.Zero(t, states[0].AppliedAt)
+	assert.Error(t, database.CheckSchemaVersion(dbm.Db))
+
+	applied, err := database.MigrateUp(dbm.Db)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(states))
+	assert.NoError(t, database.CheckSchemaVersion(dbm.Db))
+
+	applied, err = database.MigrateUp(dbm.Db)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	states, err = database.GetMigrationStatus(dbm.Db)
+	assert.NoError(t, err)
+	assert.NotZero(t, states[0].AppliedAt)
+}
+
+// TestMigrateConcurrent tests that servers starting together apply each migration once
+func TestMigrateConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stockoverflow.db")
+	servers := []*database.DatabaseMaster{openSQLite(t, path), openSQLite(t, path), openSQLite(t, path)}
+
+	var wg sync.WaitGroup
+	counts := make([]int, len(servers))
+	for i, dbm := range servers {
+		wg.Add(1)
+		go func(i int, dbm *database.DatabaseMaster) {
+			defer wg.Done()
+			applied, err := database.MigrateUp(dbm.Db)
+			assert.NoError(t, err)
+			counts[i] = len(applied)
+		}(i, dbm)
+	}
+	wg.Wait()
+
+	migrations, err := database.GetMigrations(servers[0].Db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), counts[0]+counts[1]+counts[2])
+}
+
+// TestMigrateNewerSchema tests that a schema from a newer server is refused
+func TestMigrateNewerSchema(t *testing.T) {
+	dbm := openSQLite(t, filepath.Join(t.TempDir(), "stockoverflow.db"))
+	_, err := database.MigrateUp(dbm.Db)
+	assert.NoError(t, err)
+
+	_, err = dbm.Db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', 1)")
+	assert.NoError(t, err)
+
+	_, err = database.MigrateUp(dbm.Db)
+	assert.ErrorContains(t, err, "newer")
+	assert.ErrorContains(t, database.CheckSchemaVersion(dbm.Db), "newer")
+}
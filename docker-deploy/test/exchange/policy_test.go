@@ -0,0 +1,74 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/exchange"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// decimals builds a decimal slice from integers
+func decimals(values ...int64) []decimal.Decimal {
+	result := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		result[i] = decimal.NewFromInt(value)
+	}
+	return result
+}
+
+// allocationStrings makes allocations easy to compare
+func allocationStrings(allocations []decimal.Decimal) []string {
+	result := make([]string, len(allocations))
+	for i, allocation := range allocations {
+		result[i] = allocation.String()
+	}
+	return result
+}
+
+// TestPriceTimeAllocation tests that the oldest order fills first
+func TestPriceTimeAllocation(t *testing.T) {
+	allocations := exchange.PriceTime{}.Allocate(decimal.NewFromInt(150), decimals(100, 100, 100), decimal.NewFromInt(1))
+	assert.Equal(t, []string{"100", "50", "0"}, allocationStrings(allocations))
+}
+
+// TestProRataAllocation tests proportional shares and where the rounding goes
+func TestProRataAllocation(t *testing.T) {
+	lot := decimal.NewFromInt(1)
+
+	// 100 / 300 of 10 rounds down to 3 for everyone, the last lot goes to the oldest order
+	allocations := exchange.ProRata{}.Allocate(decimal.NewFromInt(10), decimals(100, 100, 100), lot)
+	assert.Equal(t, []string{"4", "3", "3"}, allocationStrings(allocations))
+
+	// bigger orders get more
+	allocations = exchange.ProRata{}.Allocate(decimal.NewFromInt(40), decimals(100, 300), lot)
+	assert.Equal(t, []string{"10", "30"}, allocationStrings(allocations))
+
+	// more than the level fills all of it
+	allocations = exchange.ProRata{}.Allocate(decimal.NewFromInt(500), decimals(100, 300), lot)
+	assert.Equal(t, []string{"100", "300"}, allocationStrings(allocations))
+
+	// fractional lots
+	allocations = exchange.ProRata{}.Allocate(decimal.NewFromFloat(0.5), decimals(1, 2), decimal.NewFromFloat(0.1))
+	assert.Equal(t, []string{"0.2", "0.3"}, allocationStrings(allocations))
+}
+
+// TestTopOrderAllocation tests that the top order fills before the pro-rata share
+func TestTopOrderAllocation(t *testing.T) {
+	allocations := exchange.TopOrder{}.Allocate(decimal.NewFromInt(60), decimals(20, 100, 300), decimal.NewFromInt(1))
+	assert.Equal(t, []string{"20", "10", "30"}, allocationStrings(allocations))
+}
+
+// TestPolicyByName tests the names policies are selected by
+func TestPolicyByName(t *testing.T) {
+	policy, err := exchange.Policy("pro_rata")
+	assert.NoError(t, err)
+	assert.Equal(t, exchange.ProRata{}, policy)
+
+	policy, err = exchange.Policy("")
+	assert.NoError(t, err)
+	assert.Equal(t, exchange.PriceTime{}, policy)
+
+	_, err = exchange.Policy("random")
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSQLiteStore creates a store on a new SQLite database file
+func setupSQLiteStore(t *testing.T) database.Store {
+	dbm := database.DatabaseMaster{
+		Driver: "sqlite",
+		DbName: filepath.Join(t.TempDir(), "stockoverflow.db"),
+	}
+	dbm.Connect()
+	dbm.Init()
+	t.Cleanup(func() { dbm.Db.Close() })
+	return database.NewSQLStore(dbm.Db)
+}
+
+// TestSQLiteStoreRollback tests that a failed transaction leaves nothing behind
+func TestSQLiteStoreRollback(t *testing.T) {
+	store := setupSQLiteStore(t)
+	assert.NoError(t, store.CreateAccount("1", decimal.NewFromInt(100)))
+
+	err := store.WithTx(func(tx database.Tx) error {
+		balance, err := tx.GetBalanceForUpdate("1")
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateAccountBalance("1", balance.Sub(decimal.NewFromInt(50))); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	assert.Error(t, err)
+
+	account, err := store.GetAccount("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", account.Balance.String())
+}
+
+// TestMatchOnSQLiteStore tests a partial fractional match of the engine on SQLite
+func TestMatchOnSQLiteStore(t *testing.T) {
+	store := setupSQLiteStore(t)
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+
+	// reservations are taken by the server before orders reach the exchange
+	assert.NoError(t, store.CreateAccount("buyer", decimal.RequireFromString("9989.9")))
+	assert.NoError(t, store.CreateAccount("seller", decimal.NewFromInt(0)))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.RequireFromString("89.7")))
+
+	assert.NoError(t, exch.PlaceOrder("1", "seller", "SPY", decimal.RequireFromString("-10.3"), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("2", "buyer", "SPY", decimal.RequireFromString("0.1"), decimal.NewFromInt(101)))
+
+	sell, executions, err := exch.GetOrderStatus("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "open", sell.Status)
+	assert.Equal(t, "10.2", sell.Remaining.String())
+	assert.Len(t, executions, 1)
+
+	buyer, err := store.GetAccount("buyer")
+	assert.NoError(t, err)
+	assert.Equal(t, "9990", buyer.Balance.String())
+	seller, err := store.GetAccount("seller")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", seller.Balance.String())
+
+	levels, err := store.GetBookLevels("SPY", false, 0, time.Now().UnixNano())
+	assert.NoError(t, err)
+	assert.Len(t, levels, 1)
+	assert.Equal(t, "10.2", levels[0].Shares.String())
+}
+
+// TestCrossingOrdersOnSQLiteStore tests that the orders a fill or kill order
+// counts on come in priority order and leave out expired ones
+func TestCrossingOrdersOnSQLiteStore(t *testing.T) {
+	store := setupSQLiteStore(t)
+	now := time.Now().UnixNano()
+	assert.NoError(t, store.CreateAccount("seller", decimal.Zero))
+	for _, order := range []database.Order{
+		{ID: "1", Price: decimal.NewFromInt(101), PriorityTime: 1},
+		{ID: "2", Price: decimal.NewFromInt(100), PriorityTime: 2},
+		{ID: "3", Price: decimal.NewFromInt(100), PriorityTime: 3, ExpireTime: now - 1},
+		{ID: "4", Price: decimal.NewFromInt(100), PriorityTime: 4},
+		{ID: "5", Price: decimal.NewFromInt(102), PriorityTime: 5},
+	} {
+		order.AccountID, order.Symbol, order.Status = "seller", "SPY", "open"
+		order.Amount, order.Remaining = decimal.NewFromInt(-1), decimal.NewFromInt(1)
+		assert.NoError(t, store.CreateOrder(&order))
+	}
+
+	crossing, err := store.GetCrossingOrders("SPY", true, decimal.NewFromInt(101), now)
+	assert.NoError(t, err)
+	var ids []string
+	for _, order := range crossing {
+		ids = append(ids, order.ID)
+	}
+	assert.Equal(t, []string{"2", "4", "1"}, ids)
+}
+
+// TestSQLiteStoreIsExact tests that SQLite keeps, adds up and orders decimals
+// exactly like Postgres instead of in doubles
+func TestSQLiteStoreIsExact(t *testing.T) {
+	store := setupSQLiteStore(t)
+	assert.NoError(t, store.CreateAccount("1", decimal.RequireFromString("12345678901234.123456")))
+	assert.NoError(t, store.CreateAccount("seller", decimal.RequireFromString("0.1")))
+	assert.NoError(t, store.WithTx(func(tx database.Tx) error {
+		balance, err := tx.GetBalanceForUpdate("seller")
+		if err != nil {
+			return err
+		}
+		return tx.UpdateAccountBalance("seller", balance.Add(decimal.RequireFromString("0.2")))
+	}))
+
+	account, err := store.GetAccount("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678901234.123456", account.Balance.String())
+	account, err = store.GetAccount("seller")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.3", account.Balance.String())
+
+	// by text 100 would come before 9
+	for i, price := range []string{"100", "9", "10", "9"} {
+		order := database.Order{ID: fmt.Sprint(i + 1), AccountID: "seller", Symbol: "SPY", Status: "open",
+			Price: decimal.RequireFromString(price), PriorityTime: int64(i + 1)}
+		order.Amount, order.Remaining = decimal.RequireFromString("-0.3"), decimal.RequireFromString("0.3")
+		order.Visible = order.Remaining
+		assert.NoError(t, store.CreateOrder(&order))
+	}
+	assert.NoError(t, store.WithTx(func(tx database.Tx) error {
+		return tx.DecrementOrder("4", decimal.RequireFromString("0.1"))
+	}))
+
+	crossing, err := store.GetCrossingOrders("SPY", true, decimal.NewFromInt(100), time.Now().UnixNano())
+	assert.NoError(t, err)
+	var ids []string
+	for _, order := range crossing {
+		ids = append(ids, order.ID)
+	}
+	assert.Equal(t, []string{"2", "4", "3", "1"}, ids)
+
+	levels, err := store.GetBookLevels("SPY", false, 2, time.Now().UnixNano())
+	assert.NoError(t, err)
+	assert.Len(t, levels, 2)
+	assert.Equal(t, "9", levels[0].Price.String())
+	assert.Equal(t, "0.5", levels[0].Shares.String())
+	assert.Equal(t, 2, levels[0].Orders)
+	assert.Equal(t, "10", levels[1].Price.String())
+}
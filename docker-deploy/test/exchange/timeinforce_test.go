@@ -0,0 +1,98 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTIFExchange creates an exchange where account 1 buys and accounts 2 and 3 sell SPY
+func setupTIFExchange(t *testing.T) *exchange.Exchange {
+	store := database.NewMemoryStore()
+	for _, account := range []string{"1", "2", "3"} {
+		assert.NoError(t, store.CreateAccount(account, decimal.NewFromInt(10000)))
+		assert.NoError(t, store.CreateOrUpdatePosition(account, "SPY", decimal.NewFromInt(100)))
+	}
+	return exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+}
+
+// submitTIFOrder places a limit order of SPY with a time in force
+func submitTIFOrder(t *testing.T, exch *exchange.Exchange, id, account string, amount, price int64, tif string) {
+	assert.NoError(t, exch.SubmitOrder(&database.Order{
+		ID:          id,
+		AccountID:   account,
+		Symbol:      "SPY",
+		Amount:      decimal.NewFromInt(amount),
+		Price:       decimal.NewFromInt(price),
+		TimeInForce: tif,
+	}))
+}
+
+// TestIOCPartialFill tests that an immediate or cancel order takes what there
+// is and cancels the rest instead of resting
+func TestIOCPartialFill(t *testing.T) {
+	exch := setupTIFExchange(t)
+	submitTIFOrder(t, exch, "1", "2", -5, 100, "")
+	submitTIFOrder(t, exch, "2", "1", 10, 100, database.TimeInForceIOC)
+
+	assertOrder(t, exch, "1", "executed", "0")
+	assertOrder(t, exch, "2", "canceled", "5")
+	_, executions, err := exch.GetOrderStatus("2")
+	assert.NoError(t, err)
+	assert.Len(t, executions, 1)
+
+	book, err := exch.Book("SPY", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, book.Bids)
+}
+
+// TestFOKKill tests that a fill or kill order without enough liquidity is
+// canceled without trading, expired orders do not count
+func TestFOKKill(t *testing.T) {
+	exch := setupTIFExchange(t)
+	submitTIFOrder(t, exch, "1", "2", -5, 100, "")
+	assert.NoError(t, exch.SubmitOrder(&database.Order{
+		ID:          "2",
+		AccountID:   "3",
+		Symbol:      "SPY",
+		Amount:      decimal.NewFromInt(-5),
+		Price:       decimal.NewFromInt(100),
+		TimeInForce: database.TimeInForceGTD,
+		ExpireTime:  time.Now().Add(-time.Second).UnixNano(),
+	}))
+	submitTIFOrder(t, exch, "3", "1", 10, 100, database.TimeInForceFOK)
+
+	assertOrder(t, exch, "3", "canceled", "10")
+	_, executions, err := exch.GetOrderStatus("3")
+	assert.NoError(t, err)
+	assert.Empty(t, executions)
+	assertOrder(t, exch, "1", "open", "5")
+}
+
+// TestFOKOwnOrder tests that a fill or kill order does not count on its own
+// account's resting orders, self-trade prevention would stop it short
+func TestFOKOwnOrder(t *testing.T) {
+	exch := setupTIFExchange(t)
+	submitTIFOrder(t, exch, "1", "2", -5, 99, "")
+	submitTIFOrder(t, exch, "2", "1", -5, 100, "")
+	submitTIFOrder(t, exch, "3", "1", 10, 100, database.TimeInForceFOK)
+
+	assertOrder(t, exch, "3", "canceled", "10")
+	_, executions, err := exch.GetOrderStatus("3")
+	assert.NoError(t, err)
+	assert.Empty(t, executions)
+	assertOrder(t, exch, "1", "open", "5")
+	assertOrder(t, exch, "2", "open", "5")
+
+	// with another seller behind it the whole amount fills
+	submitTIFOrder(t, exch, "4", "3", -5, 99, "")
+	submitTIFOrder(t, exch, "5", "1", 10, 100, database.TimeInForceFOK)
+	assertOrder(t, exch, "5", "executed", "0")
+}
@@ -0,0 +1,79 @@
+package exchange_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/exchange"
+	"StockOverflow/internal/pool"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// tradeID returns the trade of the only execution of an order
+func tradeID(t *testing.T, exch *exchange.Exchange, orderID string) int64 {
+	_, executions, err := exch.GetOrderStatus(orderID)
+	assert.NoError(t, err)
+	if !assert.Len(t, executions, 1) {
+		return 0
+	}
+	return executions[0].TradeID
+}
+
+// testSameTimestampTrades fills one buy from two sells in the same nanosecond,
+// a pro-rata level executes all of its fills at one timestamp
+func testSameTimestampTrades(t *testing.T, store database.Store) {
+	for _, account := range []string{"1", "2", "3"} {
+		assert.NoError(t, store.CreateAccount(account, decimal.NewFromInt(10000)))
+		assert.NoError(t, store.CreateOrUpdatePosition(account, "SPY", decimal.NewFromInt(100)))
+	}
+	exch := exchange.NewExchange(store, pool.NewPool(100), log.New(io.Discard, "", 0))
+	assert.NoError(t, exch.SetMatchingPolicy("SPY", database.MatchingProRata))
+
+	assert.NoError(t, exch.PlaceOrder("1", "2", "SPY", decimal.NewFromInt(-4), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("2", "3", "SPY", decimal.NewFromInt(-6), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("3", "1", "SPY", decimal.NewFromInt(10), decimal.NewFromInt(100)))
+
+	_, buys, err := exch.GetOrderStatus("3")
+	assert.NoError(t, err)
+	if !assert.Len(t, buys, 2) {
+		return
+	}
+	assert.Equal(t, buys[0].Timestamp, buys[1].Timestamp)
+
+	// one trade per fill, each linked from the executions of both of its orders
+	first, second := tradeID(t, exch, "1"), tradeID(t, exch, "2")
+	assert.Less(t, first, second)
+	assert.ElementsMatch(t, []int64{first, second}, []int64{buys[0].TradeID, buys[1].TradeID})
+	for sellID, id := range map[string]int64{"1": first, "2": second} {
+		trade, err := store.GetTrade(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "3", trade.BuyOrderID)
+		assert.Equal(t, sellID, trade.SellOrderID)
+		assert.Equal(t, database.AggressorBuy, trade.Aggressor)
+		assert.Equal(t, buys[0].Timestamp, trade.Timestamp)
+	}
+
+	// the next trade comes after them, the seller aggressing this time
+	assert.NoError(t, exch.PlaceOrder("4", "1", "SPY", decimal.NewFromInt(1), decimal.NewFromInt(100)))
+	assert.NoError(t, exch.PlaceOrder("5", "2", "SPY", decimal.NewFromInt(-1), decimal.NewFromInt(100)))
+	third := tradeID(t, exch, "5")
+	assert.Greater(t, third, second)
+	trade, err := store.GetTrade(third)
+	assert.NoError(t, err)
+	assert.Equal(t, database.AggressorSell, trade.Aggressor)
+}
+
+// TestSameTimestampTrades tests that fills in the same nanosecond are separate
+// trades with increasing IDs on the in-memory store
+func TestSameTimestampTrades(t *testing.T) {
+	testSameTimestampTrades(t, database.NewMemoryStore())
+}
+
+// TestSameTimestampTradesOnSQLite tests the same on SQLite, where executions
+// used to be keyed on their order and timestamp
+func TestSameTimestampTradesOnSQLite(t *testing.T) {
+	testSameTimestampTrades(t, setupSQLiteStore(t))
+}
@@ -13,9 +13,9 @@ import (
 
 func TestBuyerPush(t *testing.T) {
 	buyers := NewBuyerHeap("SPY", 10, 3)
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(0.5), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(0.5), time.Now()))
 
 	x, _ := buyers.SafePop()
 	d := x.(Order)
@@ -42,9 +42,9 @@ func TestBuyerTime(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := buyers.SafePop()
 	d := x.(Order)
@@ -62,9 +62,9 @@ func TestBuyerTime2(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := buyers.SafePop()
 	d := x.(Order)
@@ -80,22 +80,22 @@ func TestBuyerTime2(t *testing.T) {
 func TestUpdate(t *testing.T) {
 	buyers := NewBuyerHeap("SPY", 10, 3)
 
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	if buyers.Len() != 9 {
 		t.Errorf("should get 9 but %d", buyers.Len())
 	}
 
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	if buyers.Len() != 5 {
 		t.Errorf("should get 5 but %d", buyers.Len())
@@ -120,9 +120,9 @@ func TestRefill(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := buyers.SafePop()
 	d := x.(Order)
@@ -152,9 +152,9 @@ func TestRefillLess(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := buyers.SafePop()
 	d := x.(Order)
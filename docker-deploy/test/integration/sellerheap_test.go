@@ -13,9 +13,9 @@ import (
 
 func TestPush(t *testing.T) {
 	sellers := NewSellerHeap("SPY", 10, 3)
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), time.Now()))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(0.5), time.Now()))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(0.5), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x := heap.Pop(sellers)
 	d := x.(Order)
@@ -42,9 +42,9 @@ func TestSellerTime(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), t1))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), t2))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), t1))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), t2))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x := heap.Pop(sellers)
 	d := x.(Order)
@@ -62,9 +62,9 @@ func TestSellerTime2(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), t2))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(1.0), t1))
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), t2))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(1.0), t1))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x := heap.Pop(sellers)
 	d := x.(Order)
@@ -94,9 +94,9 @@ func TestRefillLessSeller(t *testing.T) {
 
 	t1 := time.Now()
 	t2 := t1.Add(2 * time.Second)
-	sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := sellers.SafePop()
 	d := x.(Order)
@@ -126,9 +126,9 @@ func TestRefillLessSeller2(t *testing.T) {
 
 	// t1 := time.Now()
 	// t2 := t1.Add(2 * time.Second)
-	// sellers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t2))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(3.0), t1))
-	// buyers.SafePush(NewOrder("1", 1, decimal.NewFromFloat(2.0), time.Now()))
+	// sellers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t2))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(3.0), t1))
+	// buyers.SafePush(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(2.0), time.Now()))
 
 	x, _ := sellers.SafePop()
 	d := x.(Order)
@@ -0,0 +1,61 @@
+package test
+
+import (
+	. "StockOverflow/internal/session"
+	"testing"
+	"time"
+)
+
+func TestSessionSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("08:00-09:30-16:00", "2026-12-25")
+	if err != nil {
+		t.Fatalf("failed to parse schedule: %v", err)
+	}
+
+	// 2026-10-16 is a Friday
+	cases := []struct {
+		at    string
+		phase Phase
+	}{
+		{"2026-10-16 07:59", Closed},
+		{"2026-10-16 08:00", PreOpen},
+		{"2026-10-16 09:30", Continuous},
+		{"2026-10-16 15:59", Continuous},
+		{"2026-10-16 16:00", Closed},
+		{"2026-10-17 10:00", Closed},
+		{"2026-12-25 10:00", Closed},
+	}
+	for _, c := range cases {
+		at, _ := time.ParseInLocation("2006-01-02 15:04", c.at, time.Local)
+		if phase := schedule.Phase(at); phase != c.phase {
+			t.Errorf("at %s expected %s, but get %s\n", c.at, c.phase, phase)
+		}
+	}
+
+	if _, err := ParseSchedule("09:30-08:00-16:00", ""); err == nil {
+		t.Errorf("out of order schedule should fail\n")
+	}
+}
+
+func TestSessionOverride(t *testing.T) {
+	calendar := NewCalendar(nil)
+	if phase := calendar.Phase("SPY", time.Now()); phase != Continuous {
+		t.Errorf("without a schedule expected continuous, but get %s\n", phase)
+	}
+
+	calendar.SetPhase("SPY", Halted)
+	if phase := calendar.Phase("SPY", time.Now()); phase != Halted {
+		t.Errorf("expected halted, but get %s\n", phase)
+	}
+	if phase := calendar.Phase("BTC", time.Now()); phase != Continuous {
+		t.Errorf("other symbols should not be halted, but get %s\n", phase)
+	}
+	if Halted.AcceptsOrders() || !Halted.AcceptsCancels() || Closed.AcceptsCancels() {
+		t.Errorf("unexpected phase permissions\n")
+	}
+
+	calendar.ClearPhase("SPY")
+	if phase := calendar.Phase("SPY", time.Now()); phase != Continuous {
+		t.Errorf("expected continuous after clearing, but get %s\n", phase)
+	}
+}
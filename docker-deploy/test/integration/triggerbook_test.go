@@ -0,0 +1,52 @@
+package test
+
+import (
+	. "StockOverflow/internal/pool"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTriggerBuyStop(t *testing.T) {
+	stops := NewTriggerBook()
+	stops.Add(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(12.0), time.Now()), true)
+	stops.Add(NewOrder("2", decimal.NewFromInt(1), decimal.NewFromFloat(11.0), time.Now()), true)
+
+	_, ok := stops.PopTriggered(decimal.NewFromFloat(10.5))
+	if ok {
+		t.Errorf("no buy stop should trigger below its stop price")
+	}
+
+	x, ok := stops.PopTriggered(decimal.NewFromFloat(11.5))
+	if !ok || x.GetID() != "2" {
+		t.Errorf("should trigger stop 2 but %v", x)
+	}
+
+	_, ok = stops.PopTriggered(decimal.NewFromFloat(11.5))
+	if ok {
+		t.Errorf("stop 1 should still be dormant")
+	}
+	if stops.Len() != 1 {
+		t.Errorf("size should be 1 but %d", stops.Len())
+	}
+}
+
+func TestTriggerSellStop(t *testing.T) {
+	stops := NewTriggerBook()
+	stops.Add(NewOrder("1", decimal.NewFromInt(1), decimal.NewFromFloat(8.0), time.Now()), false)
+	stops.Add(NewOrder("2", decimal.NewFromInt(1), decimal.NewFromFloat(9.0), time.Now()), false)
+
+	x, ok := stops.PopTriggered(decimal.NewFromFloat(8.0))
+	if !ok || x.GetID() != "2" {
+		t.Errorf("should trigger the highest sell stop first but %v", x)
+	}
+
+	x, ok = stops.PopTriggered(decimal.NewFromFloat(8.0))
+	if !ok || x.GetID() != "1" {
+		t.Errorf("should trigger stop 1 at its stop price but %v", x)
+	}
+	if stops.Len() != 0 {
+		t.Errorf("size should be 0 but %d", stops.Len())
+	}
+}
@@ -157,3 +157,434 @@ children
 		t.Errorf("symbols should be SYM, but get %s\n", order.Symbol)
 	}
 }
+
+func TestParseMarketOrder(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="SYM" amount="100"/>
+	<order sym="SYM" amount="-100" type="market"/>
+	<order sym="SYM" amount="100" limit="10.5"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 3 {
+		t.Fatalf("children should be 3, but get %d\n", len(transaction.Children))
+	}
+
+	noLimit := transaction.Children[0].(Order)
+	if !noLimit.IsMarket() {
+		t.Errorf("order without limit should be a market order")
+	}
+	typed := transaction.Children[1].(Order)
+	if !typed.IsMarket() {
+		t.Errorf("order with type=market should be a market order")
+	}
+	limit := transaction.Children[2].(Order)
+	if limit.IsMarket() {
+		t.Errorf("order with a limit should not be a market order")
+	}
+}
+
+func TestParseTimeInForce(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="SYM" amount="100" limit="10" tif="ioc"/>
+	<order sym="SYM" amount="100" limit="10" tif="FOK"/>
+	<order sym="SYM" amount="100" limit="10"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	expected := []string{"IOC", "FOK", ""}
+	for i, tif := range expected {
+		order := transaction.Children[i].(Order)
+		if order.TimeInForce() != tif {
+			t.Errorf("tif should be %q, but get %q\n", tif, order.TimeInForce())
+		}
+	}
+}
+
+func TestParseReplace(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<replace id="ORDER_ID" amount="-50" limit="12.5"/>
+	<replace id="ORDER_ID" amount="20"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 2 {
+		t.Fatalf("should have 2 children, but get %d\n", len(transaction.Children))
+	}
+
+	first := transaction.Children[0].(Replace)
+	if first.ID != "ORDER_ID" || first.Amount.String() != "-50" || first.LimitPrice.String() != "12.5" {
+		t.Errorf("unexpected replace: %+v\n", first)
+	}
+
+	second := transaction.Children[1].(Replace)
+	if second.Amount.String() != "20" || !second.LimitPrice.IsZero() {
+		t.Errorf("replace without limit should keep zero limit, but get %+v\n", second)
+	}
+}
+
+func TestParseSelfTradePrevention(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="SYM" amount="100" limit="10" stp="co" stp_group="desk1"/>
+	<order sym="SYM" amount="-100" limit="10"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	first := transaction.Children[0].(Order)
+	if first.STP != "co" || first.STPGroup != "desk1" {
+		t.Errorf("unexpected stp attributes: %+v\n", first)
+	}
+
+	second := transaction.Children[1].(Order)
+	if second.STP != "" || second.STPGroup != "" {
+		t.Errorf("stp attributes should be empty, but get %+v\n", second)
+	}
+}
+
+func TestParsePostOnly(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="SYM" amount="100" limit="10" post_only="true"/>
+	<order sym="SYM" amount="100" limit="10" post_only="Reprice"/>
+	<order sym="SYM" amount="100" limit="10" post_only="false"/>
+	<order sym="SYM" amount="100" limit="10"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	expected := []string{"reject", "reprice", "", ""}
+	for i, mode := range expected {
+		order := transaction.Children[i].(Order)
+		if order.PostOnlyMode() != mode {
+			t.Errorf("post only mode should be %q, but get %q\n", mode, order.PostOnlyMode())
+		}
+	}
+}
+
+func TestParseGoodTillDate(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="SYM" amount="100" limit="10" tif="gtd" expire_time="1700000000"/>
+	<order sym="SYM" amount="100" limit="10" tif="day"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	gtd := transaction.Children[0].(Order)
+	if gtd.TimeInForce() != "GTD" || gtd.ExpireTime != 1700000000 {
+		t.Errorf("unexpected good till date order: %+v\n", gtd)
+	}
+
+	day := transaction.Children[1].(Order)
+	if day.TimeInForce() != "DAY" || day.ExpireTime != 0 {
+		t.Errorf("unexpected day order: %+v\n", day)
+	}
+}
+
+func TestParseFractionalOrder(t *testing.T) {
+
+	str :=
+		`<transactions id="ACCOUNT_ID">
+	<order sym="BTC" amount="-0.125" limit="65000.5" display="0.025"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	order := xmlData.(Transaction).Children[0].(Order)
+	if order.Amount.String() != "-0.125" || order.Display.String() != "0.025" {
+		t.Errorf("fractional quantities should be kept, but get %+v\n", order)
+	}
+}
+
+func TestParseSymbolRules(t *testing.T) {
+
+	str :=
+		`<create>
+	<symbol sym="BTC" lot="0.001" tick="0.5" min_qty="0.01" max_qty="100" min_notional="10">
+		<account id="123456">2.5</account>
+	</symbol>
+	<symbol sym="SPY">
+		<account id="123456">100</account>
+	</symbol>
+</create>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	create := xmlData.(Create)
+	btc := create.Children[0].(Symbol)
+	if !btc.HasRules() {
+		t.Errorf("BTC should have rules\n")
+	}
+	if btc.Lot.String() != "0.001" || btc.Tick.String() != "0.5" || btc.MinQty.String() != "0.01" ||
+		btc.MaxQty.String() != "100" || btc.MinNotional.String() != "10" {
+		t.Errorf("unexpected rules: %+v\n", btc)
+	}
+	if len(btc.Accounts) != 1 || btc.Accounts[0].Amount.String() != "2.5" {
+		t.Errorf("allocations should still be parsed, but get %+v\n", btc.Accounts)
+	}
+
+	spy := create.Children[1].(Symbol)
+	if spy.HasRules() {
+		t.Errorf("SPY should have no rules\n")
+	}
+}
+
+func TestParseAuction(t *testing.T) {
+
+	str :=
+		`<admin>
+	<auction sym="SPY" action="call"/>
+	<auction sym="SPY" action="uncross"/>
+</admin>`
+
+	parser := Xmlparser{}
+	xmlData, xmlType, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+	if xmlType.Name() != "Admin" {
+		t.Errorf("expected Admin, but get %s\n", xmlType.Name())
+	}
+
+	admin := xmlData.(Admin)
+	if len(admin.Children) != 2 {
+		t.Fatalf("expected 2 children, but get %d\n", len(admin.Children))
+	}
+	call := admin.Children[0].(Auction)
+	if call.Symbol != "SPY" || call.Action != "call" {
+		t.Errorf("unexpected auction: %+v\n", call)
+	}
+	if admin.Children[1].(Auction).Action != "uncross" {
+		t.Errorf("unexpected auction: %+v\n", admin.Children[1])
+	}
+
+	str = `<transactions id="123456"><indicative sym="SPY"/></transactions>`
+	xmlData, _, err = parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+	indicative := xmlData.(Transaction).Children[0].(Indicative)
+	if indicative.Symbol != "SPY" {
+		t.Errorf("unexpected indicative: %+v\n", indicative)
+	}
+}
+
+func TestParseFees(t *testing.T) {
+
+	str :=
+		`<create>
+	<account id="123456" balance="1000" fee_tier="vip"/>
+	<symbol sym="SPY" maker_fee="-1" taker_fee="0">
+		<account id="123456">100</account>
+	</symbol>
+	<symbol sym="BTC">
+		<account id="123456">1</account>
+	</symbol>
+</create>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	create := xmlData.(Create)
+	if account := create.Children[0].(Account); account.FeeTier != "vip" {
+		t.Errorf("expected fee tier vip, but get %+v\n", account)
+	}
+	spy := create.Children[1].(Symbol)
+	if spy.MakerFee == nil || spy.MakerFee.String() != "-1" || spy.TakerFee == nil || !spy.TakerFee.IsZero() {
+		t.Errorf("unexpected fee overrides: %+v\n", spy)
+	}
+	if !spy.HasRules() {
+		t.Errorf("fee overrides are rules\n")
+	}
+	btc := create.Children[2].(Symbol)
+	if btc.MakerFee != nil || btc.TakerFee != nil {
+		t.Errorf("left out fees should stay unset, but get %+v\n", btc)
+	}
+
+	str = `<admin><fee_tier name="vip" maker="-0.5" taker="2"/></admin>`
+	xmlData, _, err = parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+	tier := xmlData.(Admin).Children[0].(FeeTier)
+	if tier.Name != "vip" || tier.Maker.String() != "-0.5" || tier.Taker.String() != "2" {
+		t.Errorf("unexpected fee tier: %+v\n", tier)
+	}
+}
+
+func TestParseAccountQuery(t *testing.T) {
+
+	str :=
+		`<transactions id="123456">
+	<account_query/>
+	<query id="1"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 2 {
+		t.Fatalf("expected 2 children, but get %d\n", len(transaction.Children))
+	}
+	if _, ok := transaction.Children[0].(AccountQuery); !ok {
+		t.Errorf("expected AccountQuery, but get %T\n", transaction.Children[0])
+	}
+	if _, ok := transaction.Children[1].(Query); !ok {
+		t.Errorf("expected Query, but get %T\n", transaction.Children[1])
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+
+	str :=
+		`<transactions id="123456">
+	<order_history sym="SPY" status="executed" side="buy" from="1700000000" to="1700086400" limit="20" cursor="abc"/>
+	<trade_history sym="SPY" limit="5"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 2 {
+		t.Fatalf("expected 2 children, but get %d\n", len(transaction.Children))
+	}
+	orderHistory, ok := transaction.Children[0].(OrderHistory)
+	if !ok {
+		t.Fatalf("expected OrderHistory, but get %T\n", transaction.Children[0])
+	}
+	if orderHistory.Symbol != "SPY" || orderHistory.Status != "executed" || orderHistory.Side != "buy" {
+		t.Errorf("unexpected filters %+v\n", orderHistory)
+	}
+	if orderHistory.From != 1700000000 || orderHistory.To != 1700086400 || orderHistory.Limit != 20 || orderHistory.Cursor != "abc" {
+		t.Errorf("unexpected range %+v\n", orderHistory)
+	}
+	tradeHistory, ok := transaction.Children[1].(TradeHistory)
+	if !ok {
+		t.Fatalf("expected TradeHistory, but get %T\n", transaction.Children[1])
+	}
+	if tradeHistory.Symbol != "SPY" || tradeHistory.Limit != 5 || tradeHistory.Cursor != "" {
+		t.Errorf("unexpected filters %+v\n", tradeHistory)
+	}
+}
+
+func TestParseBook(t *testing.T) {
+
+	str :=
+		`<transactions id="123456">
+	<book sym="SPY" depth="5"/>
+	<book sym="BTC"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 2 {
+		t.Fatalf("expected 2 children, but get %d\n", len(transaction.Children))
+	}
+	book, ok := transaction.Children[0].(Book)
+	if !ok {
+		t.Fatalf("expected Book, but get %T\n", transaction.Children[0])
+	}
+	if book.Symbol != "SPY" || book.Depth != 5 {
+		t.Errorf("unexpected book %+v\n", book)
+	}
+	book, ok = transaction.Children[1].(Book)
+	if !ok || book.Symbol != "BTC" || book.Depth != 0 {
+		t.Errorf("unexpected book %+v\n", transaction.Children[1])
+	}
+}
+
+func TestParseMassCancel(t *testing.T) {
+
+	str :=
+		`<transactions id="123456">
+	<mass_cancel/>
+	<mass_cancel sym="SPY" side="sell"/>
+</transactions>`
+
+	parser := Xmlparser{}
+	xmlData, _, err := parser.Parse([]byte(str))
+	if err != nil {
+		t.Errorf("failed")
+	}
+
+	transaction := xmlData.(Transaction)
+	if len(transaction.Children) != 2 {
+		t.Fatalf("expected 2 children, but get %d\n", len(transaction.Children))
+	}
+	massCancel, ok := transaction.Children[0].(MassCancel)
+	if !ok || massCancel.Symbol != "" || massCancel.Side != "" {
+		t.Errorf("expected unscoped MassCancel, but get %+v\n", transaction.Children[0])
+	}
+	massCancel, ok = transaction.Children[1].(MassCancel)
+	if !ok || massCancel.Symbol != "SPY" || massCancel.Side != "sell" {
+		t.Errorf("expected MassCancel of SPY sells, but get %+v\n", transaction.Children[1])
+	}
+}
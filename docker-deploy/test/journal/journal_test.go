@@ -0,0 +1,140 @@
+package journal_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/journal"
+	"StockOverflow/internal/server"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJournalPending tests that only commands neither committed nor aborted are open after a reopen
+func TestJournalPending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := journal.Open(path, journal.SyncAlways, 0)
+	assert.NoError(t, err)
+
+	committed, _ := j.Begin(journal.OpCancel, journal.CancelEntry{OrderID: "1"})
+	aborted, _ := j.Begin(journal.OpCancel, journal.CancelEntry{OrderID: "2"})
+	open, _ := j.Begin(journal.OpCancel, journal.CancelEntry{OrderID: "3"})
+	assert.NoError(t, j.Commit(committed, ""))
+	assert.NoError(t, j.Abort(aborted, "not found"))
+	assert.NoError(t, j.Close())
+
+	j, err = journal.Open(path, journal.SyncInterval, time.Millisecond)
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.False(t, j.Repaired())
+
+	pending := j.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, open, pending[0].Seq)
+	var entry journal.CancelEntry
+	assert.NoError(t, pending[0].Decode(&entry))
+	assert.Equal(t, "3", entry.OrderID)
+
+	// sequence numbers go on from the ones in the file
+	seq, err := j.Begin(journal.OpCancel, journal.CancelEntry{OrderID: "4"})
+	assert.NoError(t, err)
+	assert.Greater(t, seq, open+2)
+}
+
+// TestJournalTornRecord tests that a record cut short by a crash is dropped and damage elsewhere is refused
+func TestJournalTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := journal.Open(path, journal.SyncNone, 0)
+	assert.NoError(t, err)
+	_, err = j.Begin(journal.OpCancel, journal.CancelEntry{OrderID: "1"})
+	assert.NoError(t, err)
+	assert.NoError(t, j.Close())
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`1234abcd {"seq":2,"kind":"commit","re`)
+	assert.NoError(t, err)
+	file.Close()
+
+	j, err = journal.Open(path, journal.SyncNone, 0)
+	assert.NoError(t, err)
+	assert.True(t, j.Repaired())
+	assert.Len(t, j.Pending(), 1)
+	assert.NoError(t, j.Commit(j.Pending()[0].Seq, ""))
+	assert.NoError(t, j.Close())
+
+	// the repaired file reads cleanly
+	j, err = journal.Open(path, journal.SyncNone, 0)
+	assert.NoError(t, err)
+	assert.False(t, j.Repaired())
+	assert.Empty(t, j.Pending())
+	assert.NoError(t, j.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	content[10] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, content, 0644))
+	_, err = journal.Open(path, journal.SyncNone, 0)
+	assert.Error(t, err)
+}
+
+// TestRecoverJournal tests that recovery finishes or undoes what a crash left half done
+func TestRecoverJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	store := database.NewMemoryStore()
+
+	// a buy whose reservation was written but not its order
+	assert.NoError(t, store.CreateAccount("buyer", decimal.NewFromInt(500)))
+	// a sell the exchange wrote before the crash
+	assert.NoError(t, store.CreateAccount("seller", decimal.Zero))
+	assert.NoError(t, store.CreateOrUpdatePosition("seller", "SPY", decimal.NewFromInt(90)))
+	assert.NoError(t, store.CreateOrder(&database.Order{
+		ID: "2", AccountID: "seller", Symbol: "SPY", Amount: decimal.NewFromInt(-10),
+		Price: decimal.NewFromInt(100), Status: "open", Remaining: decimal.NewFromInt(10),
+	}))
+
+	j, err := journal.Open(path, journal.SyncAlways, 0)
+	assert.NoError(t, err)
+	_, err = j.Begin(journal.OpOrder, journal.OrderEntry{
+		OrderID: "1", AccountID: "buyer", Symbol: "SPY", Buy: true,
+		Reserved: decimal.NewFromInt(500), Before: decimal.NewFromInt(1000),
+	})
+	assert.NoError(t, err)
+	_, err = j.Begin(journal.OpOrder, journal.OrderEntry{
+		OrderID: "2", AccountID: "seller", Symbol: "SPY",
+		Reserved: decimal.NewFromInt(10), Before: decimal.NewFromInt(100),
+	})
+	assert.NoError(t, err)
+	_, err = j.Begin(journal.OpCreateAccount, journal.CreateAccountEntry{AccountID: "new", Balance: decimal.NewFromInt(1)})
+	assert.NoError(t, err)
+	assert.NoError(t, j.Close())
+
+	j, err = journal.Open(path, journal.SyncAlways, 0)
+	assert.NoError(t, err)
+	s := server.NewServer(log.New(io.Discard, "", 0))
+	s.SetStore(store)
+	s.SetJournal(j)
+
+	recovered, err := s.RecoverJournal()
+	assert.NoError(t, err)
+	assert.Len(t, recovered, 3)
+	assert.Equal(t, server.OutcomeRolledBack, recovered[0].Outcome)
+	assert.Equal(t, server.OutcomeCompleted, recovered[1].Outcome)
+	assert.Equal(t, server.OutcomeNotApplied, recovered[2].Outcome)
+
+	buyer, err := store.GetAccount("buyer")
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", buyer.Balance.String())
+	assert.NoError(t, j.Close())
+
+	// everything was settled once
+	j, err = journal.Open(path, journal.SyncAlways, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, j.Pending())
+	assert.NoError(t, j.Close())
+}
@@ -0,0 +1,53 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpiryRefunds tests that the expiry scheduler expires GTD orders once their
+// time is up, gives back what they reserved and takes them out of the book,
+// while a DAY order placed with them lasts until the cutoff
+func TestExpiryRefunds(t *testing.T) {
+	store := database.NewMemoryStore()
+	s, addr, _ := startServer(t, store)
+	send(t, addr, `<create><account id="1" balance="10000"/><account id="2" balance="0"/><account id="3" balance="10000"/>`+
+		`<symbol sym="SPY"><account id="2">20</account></symbol></create>`)
+
+	expire := time.Now().Unix() + 2
+	send(t, addr, fmt.Sprintf(`<transactions id="1"><order sym="SPY" amount="5" limit="99" tif="GTD" expire_time="%d"/></transactions>`, expire))
+	send(t, addr, fmt.Sprintf(`<transactions id="2"><order sym="SPY" amount="-10" limit="101" tif="GTD" expire_time="%d"/></transactions>`, expire))
+	send(t, addr, `<transactions id="1"><order sym="SPY" amount="2" limit="98" tif="DAY"/></transactions>`)
+	assertBalance(t, store, "1", "9309")
+	assertPosition(t, store, "2", "SPY", "10")
+
+	s.StartExpiry(20 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		buy, buyErr := store.GetOrder("1")
+		sell, sellErr := store.GetOrder("2")
+		if buyErr == nil && sellErr == nil && buy.Status == "expired" && sell.Status == "expired" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assertStatus(t, store, "1", "expired", "5")
+	assertStatus(t, store, "2", "expired", "10")
+	assertStatus(t, store, "3", "open", "2")
+	assertBalance(t, store, "1", "9804")
+	assertPosition(t, store, "2", "SPY", "20")
+
+	response := send(t, addr, `<transactions id="1"><query id="1"/></transactions>`)
+	if !strings.Contains(response, "<expired") {
+		t.Errorf("expected the order to be reported expired, but get %s\n", response)
+	}
+
+	// the expired sell is gone, so a buy at its price rests
+	send(t, addr, `<transactions id="3"><order sym="SPY" amount="10" limit="101"/></transactions>`)
+	assertStatus(t, store, "4", "open", "10")
+	assertBalance(t, store, "3", "8990")
+	assertBalance(t, store, "2", "0")
+}
@@ -0,0 +1,37 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"strings"
+	"testing"
+)
+
+// TestPostOnlyRejectOrReprice tests that a crossing post-only buy is either
+// rejected with its own reason and fully refunded, or moved a tick below the
+// best ask with the difference given back, and never trades
+func TestPostOnlyRejectOrReprice(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, addr, _ := startServer(t, store)
+	send(t, addr, `<create><account id="1" balance="10000"/><account id="2" balance="0"/>`+
+		`<symbol sym="SPY"><account id="2">20</account></symbol></create>`)
+	send(t, addr, `<transactions id="2"><order sym="SPY" amount="-10" limit="100"/></transactions>`)
+
+	response := send(t, addr, `<transactions id="1"><order sym="SPY" amount="5" limit="101" post_only="reject"/></transactions>`)
+	if !strings.Contains(response, `reason="post_only"`) {
+		t.Errorf("expected the order to be rejected as post only, but get %s\n", response)
+	}
+	assertStatus(t, store, "2", "canceled", "5")
+	assertBalance(t, store, "1", "10000")
+
+	// 5 reserved at 101 rest at 99.99, giving back 1.01 for each
+	response = send(t, addr, `<transactions id="1"><order sym="SPY" amount="5" limit="101" post_only="reprice"/></transactions>`)
+	if !strings.Contains(response, `limit="99.99"`) {
+		t.Errorf("expected the order to rest at 99.99, but get %s\n", response)
+	}
+	assertStatus(t, store, "3", "open", "5")
+	assertBalance(t, store, "1", "9500.05")
+
+	assertStatus(t, store, "1", "open", "10")
+	assertBalance(t, store, "2", "0")
+	assertPosition(t, store, "2", "SPY", "10")
+}
@@ -0,0 +1,47 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"strings"
+	"testing"
+)
+
+// TestReplaceKeepsPriority tests that a buy shrunk at the same price stays
+// first in line and gets the difference back, while one that grows loses its
+// place to a later order and reserves the difference
+func TestReplaceKeepsPriority(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, addr, _ := startServer(t, store)
+	send(t, addr, `<create><account id="1" balance="10000"/><account id="2" balance="10000"/><account id="3" balance="0"/>`+
+		`<symbol sym="SPY"><account id="3">20</account></symbol></create>`)
+
+	send(t, addr, `<transactions id="1"><order sym="SPY" amount="10" limit="100"/></transactions>`)
+	send(t, addr, `<transactions id="2"><order sym="SPY" amount="10" limit="100"/></transactions>`)
+
+	// shrinking to 6 gives back 400 and keeps the first place
+	response := send(t, addr, `<transactions id="1"><replace id="1" amount="6"/></transactions>`)
+	if strings.Contains(response, "<error") {
+		t.Errorf("expected the order to be replaced, but get %s\n", response)
+	}
+	assertBalance(t, store, "1", "9400")
+	send(t, addr, `<transactions id="3"><order sym="SPY" amount="-6" limit="100"/></transactions>`)
+	assertStatus(t, store, "1", "executed", "0")
+	assertStatus(t, store, "2", "open", "10")
+	assertPosition(t, store, "1", "SPY", "6")
+
+	// growing to 12 reserves another 200 and goes behind the buy placed before it
+	send(t, addr, `<transactions id="1"><order sym="SPY" amount="5" limit="100"/></transactions>`)
+	response = send(t, addr, `<transactions id="2"><replace id="2" amount="12"/></transactions>`)
+	if strings.Contains(response, "<error") {
+		t.Errorf("expected the order to be replaced, but get %s\n", response)
+	}
+	assertBalance(t, store, "2", "8800")
+	send(t, addr, `<transactions id="3"><order sym="SPY" amount="-5" limit="100"/></transactions>`)
+	assertStatus(t, store, "4", "executed", "0")
+	assertStatus(t, store, "2", "open", "12")
+
+	assertBalance(t, store, "1", "8900")
+	assertBalance(t, store, "3", "1100")
+	assertPosition(t, store, "1", "SPY", "11")
+	assertPosition(t, store, "3", "SPY", "9")
+}
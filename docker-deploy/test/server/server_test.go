@@ -0,0 +1,250 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"StockOverflow/internal/server"
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startServer serves a server on the store on trading and admin listeners of
+// their own and returns their addresses
+func startServer(t *testing.T, store database.Store) (*server.Server, string, string) {
+	s := server.NewServer(log.New(io.Discard, "", 0))
+	s.SetStore(store)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	adminListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go s.Serve(listener)
+	go s.ServeAdmin(adminListener)
+	t.Cleanup(func() { s.Stop() })
+
+	return s, listener.Addr().String(), adminListener.Addr().String()
+}
+
+// send sends one request to addr and returns the response, empty if it failed.
+// It is called from goroutines other than the test's, so it doesn't stop the test.
+func send(t *testing.T, addr string, request string) string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Errorf("failed to connect to server: %v", err)
+		return ""
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintf(conn, "%d\n%s", len(request), request); err != nil {
+		t.Errorf("failed to send request: %v", err)
+		return ""
+	}
+
+	reader := bufio.NewReader(conn)
+	lenLine, err := reader.ReadString('\n')
+	if err != nil {
+		t.Errorf("failed to read response length: %v", err)
+		return ""
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(lenLine))
+	if err != nil {
+		t.Errorf("invalid response length: %v", err)
+		return ""
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(reader, response); err != nil {
+		t.Errorf("failed to read response: %v", err)
+		return ""
+	}
+	return string(response)
+}
+
+// TestAdminPort tests that admin requests are only taken on the admin listener
+func TestAdminPort(t *testing.T) {
+	_, addr, adminAddr := startServer(t, database.NewMemoryStore())
+	request := `<admin><phase sym="SPY" phase="halted"/></admin>`
+
+	response := send(t, addr, request)
+	if !strings.Contains(response, "only accepted on the admin port") {
+		t.Errorf("expected the trading port to refuse admin requests, but get %s\n", response)
+	}
+
+	response = send(t, adminAddr, request)
+	if !strings.Contains(response, `state="halted"`) {
+		t.Errorf("expected the symbol to be halted, but get %s\n", response)
+	}
+
+	response = send(t, adminAddr, `<transactions id="1"><query id="1"/></transactions>`)
+	if !strings.Contains(response, "not accepted on the admin port") {
+		t.Errorf("expected the admin port to refuse trading requests, but get %s\n", response)
+	}
+}
+
+// TestOpenWhileOrdersInFlight tests that orders keep their account while the
+// opening auction uncrosses and the cached accounts are reloaded
+func TestOpenWhileOrdersInFlight(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, addr, adminAddr := startServer(t, store)
+	send(t, addr, `<create><account id="1" balance="100000"/><account id="2" balance="0"/>`+
+		`<symbol sym="SPY"><account id="2">1000</account></symbol></create>`)
+
+	// 1000 orders in one request, each reserving 10
+	var orders strings.Builder
+	orders.WriteString(`<transactions id="1">`)
+	for i := 0; i < 1000; i++ {
+		orders.WriteString(`<order sym="QQQ" amount="1" limit="10"/>`)
+	}
+	orders.WriteString(`</transactions>`)
+
+	// open and close SPY's auction until the orders are through
+	opens := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		defer close(opens)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				send(t, adminAddr, `<admin><phase sym="SPY" phase="pre-open"/></admin>`)
+				send(t, adminAddr, `<admin><phase sym="SPY" phase="continuous"/></admin>`)
+			}
+		}
+	}()
+	response := send(t, addr, orders.String())
+	close(stop)
+	<-opens
+
+	if strings.Contains(response, "<error") {
+		t.Errorf("expected every order to open, but get %s\n", response)
+	}
+	account, err := store.GetAccount("1")
+	if err != nil {
+		t.Fatalf("failed to get account: %v", err)
+	}
+	if account.Balance.String() != "90000" {
+		t.Errorf("expected balance 90000, but get %s\n", account.Balance.String())
+	}
+}
+
+// TestAuctionTakesPlainLimitOrders tests that limit orders without a time in force,
+// good till canceled, are collected during pre-open and trade in the uncross
+func TestAuctionTakesPlainLimitOrders(t *testing.T) {
+	_, addr, adminAddr := startServer(t, database.NewMemoryStore())
+	send(t, addr, `<create><account id="1" balance="10000"/><account id="2" balance="0"/>`+
+		`<symbol sym="SPY"><account id="2">100</account></symbol></create>`)
+	send(t, adminAddr, `<admin><phase sym="SPY" phase="pre-open"/></admin>`)
+
+	for _, request := range []string{
+		`<transactions id="1"><order sym="SPY" amount="10" limit="100"/></transactions>`,
+		`<transactions id="2"><order sym="SPY" amount="-10" limit="99"/></transactions>`,
+	} {
+		if response := send(t, addr, request); !strings.Contains(response, "<opened") {
+			t.Errorf("expected the order to be collected, but get %s\n", response)
+		}
+	}
+
+	response := send(t, adminAddr, `<admin><auction sym="SPY" action="uncross"/></admin>`)
+	if !strings.Contains(response, `volume="10"`) {
+		t.Errorf("expected both orders in the uncross, but get %s\n", response)
+	}
+}
+
+// TestBuyerFeeReserved tests that a buy reserves its fee with its funds and gets
+// back what a better price and a cancel leave unused, never ending below zero
+func TestBuyerFeeReserved(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, addr, adminAddr := startServer(t, store)
+	send(t, adminAddr, `<admin><fee_tier name="retail" maker="50" taker="50"/></admin>`)
+	send(t, addr, `<create><account id="1" balance="100.5" fee_tier="retail"/><account id="2" balance="0"/>`+
+		`<symbol sym="SPY"><account id="2">10</account></symbol></create>`)
+
+	// the fee has to be covered too
+	response := send(t, addr, `<transactions id="1"><order sym="SPY" amount="11" limit="10"/></transactions>`)
+	if !strings.Contains(response, "Insufficient funds") {
+		t.Errorf("expected the order to be rejected, but get %s\n", response)
+	}
+
+	// 10 at 10 reserves 100 and a fee of 0.5, all of the balance. 4 fill at 9
+	// for 36 and a fee of 0.18, giving back 4 and the unused 0.02 of their fee.
+	send(t, addr, `<transactions id="2"><order sym="SPY" amount="-4" limit="9"/></transactions>`)
+	response = send(t, addr, `<transactions id="1"><order sym="SPY" amount="10" limit="10"/></transactions>`)
+	if !strings.Contains(response, "<opened") {
+		t.Errorf("expected the order to be opened, but get %s\n", response)
+	}
+	account, err := store.GetAccount("1")
+	if err != nil || account.Balance.String() != "4.02" {
+		t.Errorf("expected a balance of 4.02, but get %v %v\n", account, err)
+	}
+
+	// the other 6 are given back with their fee of 0.3 on cancel, the buy is the third order
+	send(t, addr, `<transactions id="1"><cancel id="3"/></transactions>`)
+	account, err = store.GetAccount("1")
+	if err != nil || account.Balance.String() != "64.32" {
+		t.Errorf("expected a balance of 64.32, but get %v %v\n", account, err)
+	}
+}
+
+// TestAccountQueryReservesFee tests that the cash an open buy holds includes the
+// fee it reserved, so the account's balance adds up to what it was funded with
+func TestAccountQueryReservesFee(t *testing.T) {
+	_, addr, adminAddr := startServer(t, database.NewMemoryStore())
+	send(t, adminAddr, `<admin><fee_tier name="retail" maker="20" taker="50"/></admin>`)
+	send(t, addr, `<create><account id="1" balance="1000" fee_tier="retail"/></create>`)
+
+	// 10 at 10 holds 100 and the higher fee of 0.5
+	send(t, addr, `<transactions id="1"><order sym="SPY" amount="10" limit="10"/></transactions>`)
+	response := send(t, addr, `<transactions id="1"><account_query/></transactions>`)
+	if !strings.Contains(response, `balance="1000" available="899.5" reserved="100.5"`) {
+		t.Errorf("expected 100.5 reserved of a balance of 1000, but get %s\n", response)
+	}
+}
+
+// assertBalance checks the cash balance of an account
+func assertBalance(t *testing.T, store database.Store, accountID string, want string) {
+	t.Helper()
+	account, err := store.GetAccount(accountID)
+	if err != nil {
+		t.Errorf("failed to get account %s: %v\n", accountID, err)
+		return
+	}
+	if account.Balance.String() != want {
+		t.Errorf("expected account %s to have a balance of %s, but get %s\n", accountID, want, account.Balance.String())
+	}
+}
+
+// assertPosition checks the shares an account holds of a symbol
+func assertPosition(t *testing.T, store database.Store, accountID string, symbol string, want string) {
+	t.Helper()
+	position, err := store.GetPosition(accountID, symbol)
+	if err != nil {
+		t.Errorf("failed to get position of account %s: %v\n", accountID, err)
+		return
+	}
+	if position.Amount.String() != want {
+		t.Errorf("expected account %s to hold %s %s, but get %s\n", accountID, want, symbol, position.Amount.String())
+	}
+}
+
+// assertStatus checks the status and open shares of an order
+func assertStatus(t *testing.T, store database.Store, orderID string, status string, remaining string) {
+	t.Helper()
+	order, err := store.GetOrder(orderID)
+	if err != nil {
+		t.Errorf("failed to get order %s: %v\n", orderID, err)
+		return
+	}
+	if order.Status != status || order.Remaining.String() != remaining {
+		t.Errorf("expected order %s to be %s with %s left, but get %s with %s left\n",
+			orderID, status, remaining, order.Status, order.Remaining.String())
+	}
+}
@@ -0,0 +1,38 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"strings"
+	"testing"
+)
+
+// TestStopTriggersOnLastTrade tests that a stop buy waits pending until a trade
+// reaches its stop price, then buys at market and gets back what its
+// protection price reserved above the fill
+func TestStopTriggersOnLastTrade(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, addr, _ := startServer(t, store)
+	send(t, addr, `<create><account id="1" balance="10000"/><account id="2" balance="0"/><account id="3" balance="10000"/>`+
+		`<symbol sym="SPY"><account id="2">20</account></symbol></create>`)
+
+	// 5 with a stop at 100 are reserved at the protection price of 105
+	response := send(t, addr, `<transactions id="1"><order sym="SPY" amount="5" type="stop" stop="100"/></transactions>`)
+	if !strings.Contains(response, "<opened") {
+		t.Errorf("expected the stop order to be opened, but get %s\n", response)
+	}
+	send(t, addr, `<transactions id="2"><order sym="SPY" amount="-10" limit="101"/></transactions>`)
+	assertStatus(t, store, "1", "pending", "5")
+	assertBalance(t, store, "1", "9475")
+
+	// a trade at 101 reaches the stop, which buys the other 5 at 101
+	send(t, addr, `<transactions id="3"><order sym="SPY" amount="5" limit="101"/></transactions>`)
+	assertStatus(t, store, "1", "executed", "0")
+	assertStatus(t, store, "2", "executed", "0")
+	assertStatus(t, store, "3", "executed", "0")
+	assertBalance(t, store, "1", "9495")
+	assertBalance(t, store, "2", "1010")
+	assertBalance(t, store, "3", "9495")
+	assertPosition(t, store, "1", "SPY", "5")
+	assertPosition(t, store, "2", "SPY", "10")
+	assertPosition(t, store, "3", "SPY", "5")
+}
@@ -0,0 +1,47 @@
+package server_test
+
+import (
+	"StockOverflow/internal/database"
+	"testing"
+)
+
+// TestSelfTradePrevention tests what each mode leaves of a buy crossing a sell
+// of the same account, and that the account gets back what was canceled
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode     string
+		sell     string // status and open shares of the resting sell
+		sellLeft string
+		buy      string // status and open shares of the incoming buy
+		buyLeft  string
+		balance  string
+		position string
+	}{
+		{"CN", "open", "10", "canceled", "4", "10000", "10"},
+		{"CO", "canceled", "10", "open", "4", "9600", "20"},
+		{"CB", "canceled", "10", "canceled", "4", "10000", "20"},
+		{"DC", "open", "6", "canceled", "4", "10000", "14"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			store := database.NewMemoryStore()
+			_, addr, _ := startServer(t, store)
+			send(t, addr, `<create><account id="1" balance="10000"/>`+
+				`<symbol sym="SPY"><account id="1">20</account></symbol></create>`)
+
+			send(t, addr, `<transactions id="1"><order sym="SPY" amount="-10" limit="100"/></transactions>`)
+			send(t, addr, `<transactions id="1"><order sym="SPY" amount="4" limit="100" stp="`+tt.mode+`"/></transactions>`)
+
+			assertStatus(t, store, "1", tt.sell, tt.sellLeft)
+			assertStatus(t, store, "2", tt.buy, tt.buyLeft)
+			assertBalance(t, store, "1", tt.balance)
+			assertPosition(t, store, "1", "SPY", tt.position)
+
+			events, err := store.GetSTPEventsByAccount("1")
+			if err != nil || len(events) != 1 || events[0].Mode != tt.mode || events[0].Shares.String() != "4" {
+				t.Errorf("expected one prevented match of 4, but get %v %v\n", events, err)
+			}
+		})
+	}
+}